@@ -29,8 +29,7 @@ func (f *Bytes) ReadAt(b []byte, off int64) (int, error) {
 
 	end := int(off) + len(b)
 	if end > len(f.bytes) {
-		end = len(f.bytes)
-		return (end - int(off)), io.ErrUnexpectedEOF
+		return copy(b, f.bytes[off:]), io.ErrUnexpectedEOF
 	}
 
 	return copy(b, f.bytes[off:end]), nil
@@ -1,6 +1,8 @@
 package input
 
 import (
+	"bytes"
+	"io"
 	"testing"
 )
 
@@ -23,3 +25,16 @@ func TestBytesSeek(t *testing.T) {
 	in := FromBytes([]byte{1, 2, 3, 4, 5, 6, 7, 8})
 	testSeek(t, in)
 }
+
+func TestBytesReadAtShort(t *testing.T) {
+	in := FromBytes([]byte{1, 2, 3})
+
+	buf := make([]byte, 4, 4)
+	n, err := in.ReadAt(buf, 1)
+	if n != 2 || err != io.ErrUnexpectedEOF {
+		t.Errorf("in.ReadAt(...) = %d, <%v>, want 2, <ErrUnexpectedEOF>", n, err)
+	}
+	if !bytes.Equal(buf[:n], []byte{2, 3}) {
+		t.Errorf("buf = %v want %v", buf[:n], []byte{2, 3})
+	}
+}
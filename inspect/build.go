@@ -0,0 +1,49 @@
+package main
+
+import (
+	"bramp.net/dsector/ufwb"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// buildMain implements "inspect build [grammar] [json] -o [output]".
+func buildMain(args []string) {
+	fs := flag.NewFlagSet("build", flag.ExitOnError)
+	output := fs.String("o", "", "write the built file here, instead of stdout")
+	fs.Usage = func() {
+		fmt.Println("inspect build [grammar] [json] -o [output]")
+		fs.PrintDefaults()
+	}
+
+	args = parseInterspersed(fs, args)
+	if len(args) != 2 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	g := openGrammar(args[0])
+
+	var in io.Reader = os.Stdin
+	if args[1] != "-" {
+		f, err := os.Open(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to open %q: %s\n", args[1], err.Error())
+			os.Exit(1)
+		}
+		defer f.Close()
+		in = f
+	}
+
+	b, _, err := ufwb.NewEncoder(g).EncodeJson(in)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to build %q: %s\n", args[1], err.Error())
+		os.Exit(1)
+	}
+
+	writeOutput(*output, func(w io.Writer) error {
+		_, err := w.Write(b)
+		return err
+	})
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bramp.net/dsector/input"
+	"bramp.net/dsector/ufwb"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+// carveMain implements "inspect carve [target] -o [dir]", which finds files embedded in the
+// target using the grammars in -grammars.
+func carveMain(args []string) {
+	fs := flag.NewFlagSet("carve", flag.ExitOnError)
+	output := fs.String("o", "", "extract each carved file into this directory")
+	maxLen := fs.Int64("max", 0, "maximum length of a carved file, 0 for no limit")
+	nested := fs.Bool("nested", false, "also report files found inside other carved files")
+	fs.Usage = func() {
+		fmt.Println("inspect [flags] carve [target] -o [dir]")
+		fs.PrintDefaults()
+	}
+
+	args = parseInterspersed(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	d := loadDetector()
+	d.CarveNested = *nested
+
+	file, err := input.OpenOSFile(args[0])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open target %q: %s\n", args[0], err.Error())
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	if *output != "" {
+		if err := os.MkdirAll(*output, 0755); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %q: %s\n", *output, err.Error())
+			os.Exit(1)
+		}
+	}
+
+	type carved struct {
+		Name   string `json:"grammar"`
+		Offset int64  `json:"offset"`
+		Len    int64  `json:"length"`
+		Path   string `json:"path,omitempty"`
+	}
+	var results []carved
+
+	err = d.Carve(file, *maxLen, func(c *ufwb.Carved) error {
+		r := carved{Name: c.Name, Offset: c.Offset, Len: c.Len}
+		if *output != "" {
+			r.Path = filepath.Join(*output, carvedFilename(c))
+			if err := extract(file, c, r.Path); err != nil {
+				return err
+			}
+		}
+
+		if *format == "text" {
+			fmt.Printf("0x%08x\t%d\t%s\t%s\n", r.Offset, r.Len, r.Name, r.Path)
+		}
+		results = append(results, r)
+		return nil
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to carve: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+	case "json":
+		if results == nil {
+			results = []carved{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(results); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with carve\n", *format)
+		os.Exit(1)
+	}
+}
+
+// carvedFilename returns the filename for a carved file, named after its offset, and the
+// first extension of its grammar.
+func carvedFilename(c *ufwb.Carved) string {
+	ext := c.Name
+	if exts := c.Grammar.Grammar.Extensions(); len(exts) > 0 {
+		ext = exts[0]
+	}
+	return fmt.Sprintf("%08x.%s", c.Offset, ext)
+}
+
+// extract copies the carved file to path.
+func extract(file io.ReaderAt, c *ufwb.Carved, path string) error {
+	out, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, io.NewSectionReader(file, c.Offset, c.Len)); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bramp.net/dsector/input"
+	"bramp.net/dsector/ufwb"
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// openLibrary returns the Library of grammars in the -grammars directories, or if not set,
+// the directories from ufwb.LibraryDirs.
+func openLibrary() *ufwb.Library {
+	if *grammars == "" {
+		lib, err := ufwb.DefaultLibrary()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load grammars: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return lib
+	}
+
+	lib := ufwb.NewLibrary()
+	for _, dir := range filepath.SplitList(*grammars) {
+		if err := lib.AddDir(dir); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to load grammars: %s\n", err.Error())
+			os.Exit(1)
+		}
+	}
+	return lib
+}
+
+// loadDetector returns a Detector for every grammar in the Library. Grammars that fail to
+// parse are reported and skipped.
+func loadDetector() *ufwb.Detector {
+	d, errs := openLibrary().Detector()
+	for _, err := range errs {
+		fmt.Fprintf(os.Stderr, "Skipping %s\n", err.Error())
+	}
+
+	if d.Len() == 0 {
+		fmt.Fprintf(os.Stderr, "No grammars found, use -grammars or $%s to pick a directory\n", ufwb.GrammarsEnv)
+		os.Exit(1)
+	}
+	return d
+}
+
+// detectMain implements "inspect [target]", picking the grammar automatically. With -detect the
+// candidates are printed instead of the decoded file.
+func detectMain(target string) {
+	d := loadDetector()
+
+	file, err := input.OpenOSFile(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open target %q: %s\n", target, err.Error())
+		os.Exit(1)
+	}
+	defer file.Close()
+
+	candidates, err := d.Detect(file, target, "")
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to detect grammar: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if *detect {
+		printCandidates(candidates)
+		return
+	}
+
+	if len(candidates) == 0 || !candidates[0].Confirmed {
+		fmt.Fprintf(os.Stderr, "Unable to detect the grammar for %q\n", target)
+		os.Exit(1)
+	}
+
+	fmt.Fprintf(os.Stderr, "Using grammar %q\n", candidates[0].Name)
+	decode(candidates[0].Grammar, file, target)
+}
+
+func printCandidates(candidates []*ufwb.Candidate) {
+	out := bufio.NewWriter(os.Stdout)
+	for _, c := range candidates {
+		status := "untried"
+		if c.Confirmed {
+			status = "ok"
+		} else if c.Tried {
+			status = fmt.Sprintf("failed: %s", c.Err)
+		}
+		fmt.Fprintf(out, "%s\tscore:%d\t%s\t(%s)\n", c.Name, c.Score, status, strings.Join(c.Reasons, ", "))
+	}
+	if err := out.Flush(); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
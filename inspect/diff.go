@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bramp.net/dsector/input"
+	"bramp.net/dsector/ufwb"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// openAndDecode decodes the target file, exiting on error.
+func openAndDecode(g *ufwb.Ufwb, target string) (*input.OSFile, *ufwb.Value) {
+	file, err := input.OpenOSFile(target)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to open target %q: %s\n", target, err.Error())
+		os.Exit(1)
+	}
+
+	value, err := ufwb.NewDecoder(g, file).Decode()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to parse target %q: %s\n", target, err.Error())
+		os.Exit(1)
+	}
+
+	return file, value
+}
+
+// diffMain implements "inspect diff [grammar] [old] [new]". It exits with a non-zero status if
+// the files differ.
+func diffMain(args []string) {
+	if len(args) != 3 {
+		flag.Usage()
+		os.Exit(1)
+	}
+
+	g := openGrammar(args[0])
+
+	oldFile, oldValue := openAndDecode(g, args[1])
+	defer oldFile.Close()
+
+	newFile, newValue := openAndDecode(g, args[2])
+	defer newFile.Close()
+
+	changes, err := ufwb.Diff(oldFile, oldValue, newFile, newValue)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to diff: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	switch *format {
+	case "text":
+		err = ufwb.WriteDiff(os.Stdout, changes)
+
+	case "json":
+		if changes == nil {
+			changes = []ufwb.Change{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(changes)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with diff\n", *format)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write diff: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	if len(changes) > 0 {
+		os.Exit(1)
+	}
+}
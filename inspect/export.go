@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bramp.net/dsector/ufwb"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// exportMain implements "inspect [name] [grammar] -o [output]", which exports the grammar with
+// write, for example as a Kaitai Struct .ksy file. Constructs that can't be expressed in the
+// output are printed to stderr, and with -strict cause a non-zero exit status.
+func exportMain(name string, args []string, write func(io.Writer, *ufwb.Ufwb) ([]*ufwb.LintIssue, error)) {
+	fs := flag.NewFlagSet(name, flag.ExitOnError)
+	output := fs.String("o", "", "write the output here, instead of stdout")
+	strict := fs.Bool("strict", false, "exit with a non-zero status if the grammar can't be fully expressed")
+	fs.Usage = func() {
+		fmt.Printf("inspect %s [grammar] -o [output]\n", name)
+		fs.PrintDefaults()
+	}
+
+	args = parseInterspersed(fs, args)
+	if len(args) != 1 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	g := openGrammar(args[0])
+
+	var issues []*ufwb.LintIssue
+	writeOutput(*output, func(w io.Writer) error {
+		var err error
+		issues, err = write(w, g)
+		return err
+	})
+
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "%s:%s\n", args[0], issue.Error())
+	}
+	if *strict && ufwb.LintErrors(issues) {
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bramp.net/dsector/ufwb"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+)
+
+// lintIssue is a single problem found in a grammar, as output with -format json.
+type lintIssue struct {
+	Grammar  string `json:"grammar"`
+	Line     int    `json:"line,omitempty"`
+	Col      int    `json:"col,omitempty"`
+	Severity string `json:"severity"`
+	Id       int    `json:"id,omitempty"`
+	Name     string `json:"name,omitempty"`
+	Message  string `json:"message"`
+}
+
+// lintMain implements "inspect lint [grammar]...", which checks the grammars for problems.
+// It exits with a non-zero status if any errors are found.
+func lintMain(args []string) {
+	fs := flag.NewFlagSet("lint", flag.ExitOnError)
+	werror := fs.Bool("werror", false, "treat warnings as errors")
+	fs.Usage = func() {
+		fmt.Println("inspect [flags] lint [grammar]...")
+		fs.PrintDefaults()
+	}
+
+	args = parseInterspersed(fs, args)
+	if len(args) == 0 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	var issues []lintIssue
+	failed := false
+	for _, grammar := range args {
+		for _, issue := range lintGrammar(grammar) {
+			if issue.Severity == ufwb.Error.String() || *werror {
+				failed = true
+			}
+			issues = append(issues, issue)
+		}
+	}
+
+	switch *format {
+	case "text":
+		for _, issue := range issues {
+			fmt.Printf("%s:", issue.Grammar)
+			if issue.Line != 0 {
+				fmt.Printf("%d:%d:", issue.Line, issue.Col)
+			}
+			fmt.Printf(" %s: ", issue.Severity)
+			if issue.Id != 0 || issue.Name != "" {
+				fmt.Printf("<id=%d name=%q>: ", issue.Id, issue.Name)
+			}
+			fmt.Println(issue.Message)
+		}
+	case "json":
+		if issues == nil {
+			issues = []lintIssue{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(issues); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+			os.Exit(1)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with lint\n", *format)
+		os.Exit(1)
+	}
+
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// lintGrammar returns the problems found in the grammar file, or the grammar with that name
+// from the Library. Errors parsing the grammar are returned as issues.
+func lintGrammar(grammar string) []lintIssue {
+	parseErrors := func(errs []error) []lintIssue {
+		var issues []lintIssue
+		for _, err := range errs {
+			issues = append(issues, lintIssue{
+				Grammar:  grammar,
+				Severity: ufwb.Error.String(),
+				Message:  err.Error(),
+			})
+		}
+		return issues
+	}
+
+	var u *ufwb.Ufwb
+	if _, err := os.Stat(grammar); os.IsNotExist(err) {
+		if u, err = openLibrary().Get(grammar); err != nil {
+			if err, ok := err.(*ufwb.LibraryError); ok {
+				return parseErrors(err.Errs)
+			}
+			return parseErrors([]error{err})
+		}
+	} else {
+		file, err := os.Open(grammar)
+		if err != nil {
+			return parseErrors([]error{err})
+		}
+		defer file.Close()
+
+		var errs []error
+		if u, errs = ufwb.ParseXmlGrammar(file); len(errs) > 0 {
+			return parseErrors(errs)
+		}
+	}
+
+	var issues []lintIssue
+	for _, issue := range ufwb.Lint(u) {
+		i := lintIssue{
+			Grammar:  grammar,
+			Severity: issue.Severity.String(),
+			Message:  issue.Message,
+		}
+		if issue.Element != nil {
+			i.Id, i.Name = issue.Element.Id(), issue.Element.Name()
+		}
+		if pos := issue.Pos(); pos != nil {
+			i.Line, i.Col = pos.Line, pos.Col
+		}
+		issues = append(issues, i)
+	}
+	return issues
+}
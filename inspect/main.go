@@ -4,12 +4,27 @@ package main
 import (
 	"bramp.net/dsector/input"
 	"bramp.net/dsector/ufwb"
+	"bufio"
+	"encoding/json"
 	"flag"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
 )
 
+// openGrammar parses the grammar file, or if there is no such file, the grammar with that name
+// from the Library.
 func openGrammar(grammar string) *ufwb.Ufwb {
+	if _, err := os.Stat(grammar); os.IsNotExist(err) {
+		g, err := openLibrary().Get(grammar)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "failed to open grammar %q: %s\n", grammar, err)
+			os.Exit(1)
+		}
+		return g
+	}
+
 	file, err := os.Open(grammar)
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "failed to open grammar %q: %s\n", grammar, err)
@@ -29,7 +44,59 @@ func openGrammar(grammar string) *ufwb.Ufwb {
 	return g
 }
 
-func decode(u *ufwb.Ufwb, f input.Input) {
+// writeOutput calls write with the file at path, or stdout if path is empty, exiting if
+// anything fails. Stdout is left open.
+func writeOutput(path string, write func(w io.Writer) error) {
+	var out io.Writer = os.Stdout
+	var file *os.File
+	if path != "" {
+		var err error
+		if file, err = os.Create(path); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to create %q: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+		out = file
+	}
+
+	err := write(out)
+	if file != nil {
+		if cerr := file.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
+
+var (
+	format   = flag.String("format", "text", "output format, one of text, json or html")
+	hexdump  = flag.Bool("hexdump", false, "print a hexdump coloured by the grammar")
+	colours  = flag.String("colours", "256", "hexdump colours, one of none, 256 or truecolour")
+	coverage = flag.Bool("coverage", false, "print the byte ranges not explained by the grammar")
+	at       = flag.String("at", "", "only print the value at this byte offset, e.g. 0x1a3f")
+	query    = flag.String("select", "", "only print the values matching this path, e.g. \"PNG File/Chunk[0]/Length\"")
+	grammars = flag.String("grammars", "", "directories of grammars, defaults to $"+ufwb.GrammarsEnv+" or \"grammars\"")
+	detect   = flag.Bool("detect", false, "print the grammars that may decode the target, instead of decoding it")
+)
+
+func colourMode(s string) ufwb.ColourMode {
+	switch s {
+	case "none":
+		return ufwb.NoColours
+	case "256":
+		return ufwb.Colours256
+	case "truecolour", "truecolor":
+		return ufwb.TrueColours
+	}
+
+	fmt.Fprintf(os.Stderr, "Unknown colours %q\n", s)
+	os.Exit(1)
+	return ufwb.NoColours
+}
+
+func decode(u *ufwb.Ufwb, f input.Input, name string) {
 	decoder := ufwb.NewDecoder(u, f)
 	value, err := decoder.Decode()
 	if err != nil {
@@ -37,23 +104,247 @@ func decode(u *ufwb.Ufwb, f input.Input) {
 		os.Exit(1)
 	}
 
-	str, err := value.Format(f)
+	if *hexdump {
+		if err := ufwb.WriteHexDump(os.Stdout, f, value, colourMode(*colours)); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write hexdump: %s\n", err.Error())
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *query != "" {
+		selectValues(f, value)
+		return
+	}
+
+	if *at != "" {
+		valueAt(f, value)
+		return
+	}
+
+	if *coverage {
+		printCoverage(f, value)
+		return
+	}
+
+	switch *format {
+	case "text":
+		out := bufio.NewWriter(os.Stdout)
+		err := value.FormatTo(out, f)
+		if err == nil {
+			err = out.Flush()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format parsed output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "json":
+		if err := ufwb.WriteJson(os.Stdout, f, value); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format parsed output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "html":
+		if err := ufwb.WriteHtml(os.Stdout, f, value, name); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format parsed output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown output format %q\n", *format)
+		os.Exit(1)
+	}
+}
+
+// selectValues prints the values matching the -select query, exiting with a non-zero status
+// if there are none.
+func selectValues(f input.Input, value *ufwb.Value) {
+	matches, err := value.Select(f, *query)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Failed to format parsed output: %s\n", err.Error())
+		fmt.Fprintf(os.Stderr, "Failed to select values: %s\n", err.Error())
 		os.Exit(1)
 	}
 
-	fmt.Print(str)
+	switch *format {
+	case "text":
+		out := bufio.NewWriter(os.Stdout)
+		for _, m := range matches {
+			s, err := m.Format(m.File)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", m.Path, err.Error())
+				os.Exit(1)
+			}
+			fmt.Fprintf(out, "%s: %s\n", m.Path, s)
+		}
+		if err := out.Flush(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	case "json":
+		var values []*ufwb.JsonValue
+		for _, m := range matches {
+			j, err := ufwb.NewJsonValue(m.File, m.Value)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", m.Path, err.Error())
+				os.Exit(1)
+			}
+			j.Path = m.Path
+			values = append(values, j)
+		}
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(values); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with -select\n", *format)
+		os.Exit(1)
+	}
+
+	if len(matches) == 0 {
+		os.Exit(1)
+	}
+}
+
+// valueAt prints the value at the -at offset.
+func valueAt(f input.Input, value *ufwb.Value) {
+	offset, err := strconv.ParseInt(*at, 0, 64)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Invalid offset %q: %s\n", *at, err.Error())
+		os.Exit(1)
+	}
+
+	chain := ufwb.NewIndex(value).At(offset)
+	if chain == nil {
+		fmt.Fprintf(os.Stderr, "Offset 0x%x is outside the decoded values\n", offset)
+		os.Exit(1)
+	}
+
+	v := chain[len(chain)-1]
+	path := ufwb.PathOf(chain)
+
+	switch *format {
+	case "text":
+		s, err := v.Format(f)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+		fmt.Printf("path:   %s\n", path)
+		fmt.Printf("bounds: 0x%x-0x%x (%d bytes)\n", v.Offset, v.Offset+v.Len, v.Len)
+		fmt.Printf("value:  %s\n", s)
+
+	case "json":
+		j, err := ufwb.NewJsonValue(f, v)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to format %s: %s\n", path, err.Error())
+			os.Exit(1)
+		}
+		j.Path = path
+
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(j); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to write output: %s\n", err.Error())
+			os.Exit(1)
+		}
+
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with -at\n", *format)
+		os.Exit(1)
+	}
+}
+
+// printCoverage prints the byte ranges not explained by the grammar.
+func printCoverage(f input.Input, value *ufwb.Value) {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to find the target's size: %s\n", err.Error())
+		os.Exit(1)
+	}
+
+	c := ufwb.NewCoverage(size, value)
+
+	switch *format {
+	case "text":
+		err = ufwb.WriteCoverage(os.Stdout, f, c, 64)
+
+	case "json":
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(c)
+
+	default:
+		fmt.Fprintf(os.Stderr, "Output format %q is not supported with -coverage\n", *format)
+		os.Exit(1)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to write coverage: %s\n", err.Error())
+		os.Exit(1)
+	}
 }
 
 func main() {
 
-	flag.Parse()
 	flag.Usage = func() {
-		fmt.Println("inspect [grammar] [target]")
+		fmt.Println("inspect [flags] [grammar] [target]")
+		fmt.Println("inspect [flags] [target]")
+		fmt.Println("inspect [flags] diff [grammar] [old target] [new target]")
+		fmt.Println("inspect set [grammar] [target] [path=value]... -o [output]")
+		fmt.Println("inspect build [grammar] [json] -o [output]")
+		fmt.Println("inspect [flags] carve [target] -o [dir]")
+		fmt.Println("inspect [flags] lint [grammar]...")
+		fmt.Println("inspect kaitai [grammar] -o [output]")
+		fmt.Println("inspect wireshark [grammar] -o [output]")
+		fmt.Println("inspect cheader [grammar] -o [output]")
+		flag.PrintDefaults()
 	}
+	flag.Parse()
 
 	args := flag.Args()
+	if len(args) > 0 && args[0] == "diff" {
+		diffMain(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "set" {
+		setMain(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "build" {
+		buildMain(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "carve" {
+		carveMain(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "lint" {
+		lintMain(args[1:])
+		return
+	}
+	if len(args) > 0 && args[0] == "kaitai" {
+		exportMain("kaitai", args[1:], ufwb.WriteKaitai)
+		return
+	}
+	if len(args) > 0 && args[0] == "wireshark" {
+		exportMain("wireshark", args[1:], ufwb.WriteWireshark)
+		return
+	}
+	if len(args) > 0 && args[0] == "cheader" {
+		exportMain("cheader", args[1:], ufwb.WriteCHeader)
+		return
+	}
+
+	if len(args) == 1 {
+		detectMain(args[0])
+		return
+	}
 	if len(args) < 2 {
 		flag.Usage()
 		os.Exit(1)
@@ -71,5 +362,5 @@ func main() {
 	}
 	defer file.Close()
 
-	decode(g, file)
+	decode(g, file, target)
 }
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bramp.net/dsector/ufwb"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+)
+
+// parseInterspersed parses the flags, allowing them to appear between the positional arguments.
+func parseInterspersed(fs *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			os.Exit(2)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// splitAssignment splits "path=value" at the first '=' outside of a [...] filter.
+func splitAssignment(s string) (path, value string, ok bool) {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '[':
+			depth++
+		case ']':
+			depth--
+		case '=':
+			if depth == 0 {
+				return s[:i], s[i+1:], true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// setMain implements "inspect set [grammar] [target] [path=value]... -o [output]".
+func setMain(args []string) {
+	fs := flag.NewFlagSet("set", flag.ExitOnError)
+	output := fs.String("o", "", "write the edited file here, instead of stdout")
+	fs.Usage = func() {
+		fmt.Println("inspect set [grammar] [target] [path=value]... -o [output]")
+		fs.PrintDefaults()
+	}
+
+	args = parseInterspersed(fs, args)
+	if len(args) < 3 {
+		fs.Usage()
+		os.Exit(1)
+	}
+
+	g := openGrammar(args[0])
+	file, value := openAndDecode(g, args[1])
+	defer file.Close()
+
+	editor, err := ufwb.NewEditor(file, value)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read target %q: %s\n", args[1], err.Error())
+		os.Exit(1)
+	}
+
+	for _, assignment := range args[2:] {
+		path, text, ok := splitAssignment(assignment)
+		if !ok {
+			fmt.Fprintf(os.Stderr, "Invalid assignment %q, expected path=value\n", assignment)
+			os.Exit(1)
+		}
+
+		matches, err := value.Select(editor, path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to select values: %s\n", err.Error())
+			os.Exit(1)
+		}
+		if len(matches) == 0 {
+			fmt.Fprintf(os.Stderr, "No values match %q\n", path)
+			os.Exit(1)
+		}
+
+		for _, m := range matches {
+			if err := editor.Set(m.Value, text); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to set %s: %s\n", m.Path, err.Error())
+				os.Exit(1)
+			}
+		}
+	}
+
+	writeOutput(*output, func(w io.Writer) error {
+		_, err := editor.WriteTo(w)
+		return err
+	})
+}
@@ -0,0 +1,798 @@
+// Decodergen is a tool to compile a grammar into Go source. It generates one struct type per
+// structure, with typed fields for each number, string and binary, and a Decode function that
+// decodes the same way the ufwb.Decoder does, but without interpreting the grammar at runtime.
+//
+// It is designed to be used with go generate, for example:
+//
+//	//go:generate decodergen -grammar png.grammar
+//
+// which writes png_decoder.go into the current package.
+
+package main // import "bramp.net/dsector/tools/decodergen"
+
+import (
+	"bufio"
+	"bytes"
+	"flag"
+	"fmt"
+	"go/build"
+	"go/format"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode"
+
+	"bramp.net/dsector/ufwb"
+)
+
+var (
+	grammar     = flag.String("grammar", "", "grammar file to generate a decoder for; must be set")
+	packageName = flag.String("package", "", "package name of the generated code; defaults to the package in the current directory")
+	output      = flag.String("o", "", "output file; defaults to <grammar>_decoder.go")
+
+	header1 = "// Code generated by \"decodergen "
+	header2 = "\"; DO NOT EDIT\n"
+)
+
+// Usage is a replacement usage function for the flags package.
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tdecodergen [flags] -grammar file.grammar\n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	log.SetFlags(0)
+	log.SetPrefix("decodergen: ")
+	flag.Usage = Usage
+	flag.Parse()
+	if len(*grammar) == 0 || flag.NArg() > 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if *packageName == "" {
+		pkg, err := build.Default.ImportDir(".", 0)
+		if err != nil {
+			log.Fatalf("cannot find the package name, use -package: %s", err)
+		}
+		*packageName = pkg.Name
+	}
+
+	outputName := *output
+	if outputName == "" {
+		base := strings.TrimSuffix(filepath.Base(*grammar), filepath.Ext(*grammar))
+		outputName = strings.ToLower(base) + "_decoder.go"
+	}
+
+	if f, err := os.Open(outputName); err == nil {
+		generated, err := isGeneratedFile(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("reading existing output file: %s", err)
+		}
+		if !generated {
+			log.Fatalf("will not override files not generated by me")
+		}
+	}
+
+	g := Generator{
+		args: os.Args[1:],
+		pkg:  *packageName,
+	}
+	src, errs := g.generateFile(*grammar)
+	if len(errs) > 0 {
+		for _, err := range errs {
+			log.Print(err)
+		}
+		os.Exit(1)
+	}
+
+	if err := ioutil.WriteFile(outputName, src, 0644); err != nil {
+		log.Fatalf("writing output: %s", err)
+	}
+}
+
+// isGeneratedFile returns true if the file starts with our header.
+func isGeneratedFile(r io.Reader) (bool, error) {
+	line, err := bufio.NewReader(r).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	return strings.HasPrefix(line, header1), nil
+}
+
+// Generator holds the state of the generation. Primarily used to buffer
+// the output for format.Source.
+type Generator struct {
+	buf bytes.Buffer // Accumulated output.
+
+	args []string // Arguments recorded in the header.
+	pkg  string   // Package name of the generated code.
+
+	types map[*ufwb.Structure]string // Go type name of each structure.
+	queue []*ufwb.Structure          // Structures waiting to be generated.
+	names map[string]bool            // Package level identifiers in use.
+	math  bool                       // If the generated code uses the math package.
+
+	errs []error
+}
+
+func (g *Generator) Printf(format string, args ...interface{}) {
+	fmt.Fprintf(&g.buf, format, args...)
+}
+
+// errorf records that the element can't be generated.
+func (g *Generator) errorf(e ufwb.Element, format string, args ...interface{}) {
+	pos := "-"
+	if p, ok := e.(interface {
+		Pos() *ufwb.Position
+	}); ok {
+		pos = p.Pos().String()
+	}
+	g.errs = append(g.errs, fmt.Errorf("%s: <%T id=%d name=%q>: %s", pos, e, e.Id(), e.Name(), fmt.Sprintf(format, args...)))
+}
+
+// field is a single field in a generated struct.
+type field struct {
+	elem ufwb.Element
+	name string // Go name of the field.
+	typ  string // Go type of a single value.
+	fn   string // Name of the func that decodes a single value.
+}
+
+// generateFile parses the grammar file and generates the decoder for it.
+func (g *Generator) generateFile(filename string) ([]byte, []error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, []error{err}
+	}
+	defer f.Close()
+
+	u, errs := ufwb.ParseXmlGrammar(f)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return g.generate(u)
+}
+
+// generate returns the formatted source of the decoder for the grammar.
+func (g *Generator) generate(u *ufwb.Ufwb) ([]byte, []error) {
+	start := u.Grammar.Start
+	if start == nil {
+		return nil, []error{fmt.Errorf("grammar %q has no start structure", u.Grammar.Name())}
+	}
+
+	g.buf.Reset()
+	g.types = make(map[*ufwb.Structure]string)
+	g.queue = nil
+	g.names = map[string]bool{"Decode": true, "DecodeError": true}
+	g.math = false
+	g.errs = nil
+
+	startType := g.typeName(start)
+
+	g.Printf("// Decode decodes b with the %s grammar. The returned values may refer to b.\n", u.Grammar.Name())
+	g.Printf("func Decode(b []byte) (*%s, error) {\n", startType)
+	g.Printf("d := &decoder{b: b, prev: make(map[string]int64)}\n")
+	g.Printf("v := &%s{}\n", startType)
+	g.Printf("if err := v.decode(d, int64(len(b))); err != nil {\n")
+	g.Printf("return nil, err\n")
+	g.Printf("}\n")
+	g.Printf("return v, nil\n")
+	g.Printf("}\n\n")
+
+	for len(g.queue) > 0 {
+		s := g.queue[0]
+		g.queue = g.queue[1:]
+		g.structure(s)
+	}
+
+	g.Printf("%s", runtime)
+
+	if len(g.errs) > 0 {
+		return nil, g.errs
+	}
+
+	body := g.buf.String()
+	g.buf.Reset()
+
+	g.Printf("%s%s%s", header1, strings.Join(g.args, " "), header2)
+	g.Printf("\n")
+	g.Printf("package %s\n\n", g.pkg)
+	g.Printf("import (\n")
+	g.Printf("\"bytes\"\n")
+	g.Printf("\"fmt\"\n")
+	g.Printf("\"io\"\n")
+	if g.math {
+		g.Printf("\"math\"\n")
+	}
+	g.Printf(")\n\n")
+	g.Printf("%s", body)
+
+	return g.format()
+}
+
+// format returns the gofmt-ed contents of the Generator's buffer.
+func (g *Generator) format() ([]byte, []error) {
+	src, err := format.Source(g.buf.Bytes())
+	if err != nil {
+		// Should never happen, but can arise when developing this code.
+		return nil, []error{fmt.Errorf("internal error: invalid Go generated: %s\n%s", err, g.buf.String())}
+	}
+	return src, nil
+}
+
+// typeName returns the Go type name for the structure, queuing it to be generated if needed.
+func (g *Generator) typeName(s *ufwb.Structure) string {
+	if name, found := g.types[s]; found {
+		return name
+	}
+	name := unique(goName(s.Name()), g.names)
+	g.types[s] = name
+	g.queue = append(g.queue, s)
+	return name
+}
+
+// structure generates the type, constants and decode funcs for the structure.
+func (g *Generator) structure(s *ufwb.Structure) {
+	name := g.types[s]
+
+	if s.Order() == ufwb.VariableOrder {
+		g.errorf(s, "variable order can't be generated")
+	}
+
+	fieldNames := make(map[string]bool)
+	var fields []*field
+	for _, e := range s.Elements() {
+		f := &field{
+			elem: e,
+			name: unique(goName(e.Name()), fieldNames),
+		}
+		f.fn = unique("decode"+name+f.name, g.names)
+		if f.typ = g.fieldType(e); f.typ == "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+
+	g.Printf("// %s is the %s structure.\n", name, s.Name())
+	if strings.TrimSpace(s.Description()) != "" {
+		g.Printf("//\n")
+		g.comment(s.Description())
+	}
+	g.Printf("type %s struct {\n", name)
+	for _, f := range fields {
+		g.comment(f.elem.Description())
+		typ := f.typ
+		if !isOne(f.elem) {
+			typ = "[]" + typ
+		}
+		g.Printf("%s %s\n", f.name, typ)
+	}
+	g.Printf("}\n\n")
+
+	for _, f := range fields {
+		g.constants(name, f)
+	}
+
+	g.Printf("// decode decodes the %s structure from d, without reading past end.\n", s.Name())
+	g.Printf("func (v *%s) decode(d *decoder, end int64) (err error) {\n", name)
+	g.Printf("defer d.wrap(%q, d.pos, &err)\n", s.Name())
+	if s.Length() != nil {
+		g.eval(s, "length", "length", s.Length(), s.LengthUnit(), "err")
+		g.Printf("if d.pos+length < end {\n")
+		g.Printf("end = d.pos + length\n")
+		g.Printf("}\n")
+	}
+	for _, f := range fields {
+		g.decodeField(s, f)
+	}
+	if s.Length() != nil {
+		g.Printf("d.pos = end\n")
+	}
+	g.Printf("return nil\n")
+	g.Printf("}\n\n")
+
+	for _, f := range fields {
+		g.element(s, f)
+	}
+}
+
+// comment prints the description as a comment, if there is one.
+func (g *Generator) comment(description string) {
+	description = strings.TrimSpace(description)
+	if description == "" {
+		return
+	}
+	for _, line := range strings.Split(description, "\n") {
+		g.Printf("// %s\n", strings.TrimSpace(line))
+	}
+}
+
+// fieldType returns the Go type of a single value of the element, or "" if the element can't be
+// generated.
+func (g *Generator) fieldType(e ufwb.Element) string {
+	switch e := e.(type) {
+	case *ufwb.Number:
+		typ, _ := numberType(e)
+		if typ == "" {
+			g.errorf(e, "%s numbers of length %s can't be generated", e.Type, exprString(e.Length()))
+		}
+		return typ
+
+	case *ufwb.String:
+		return "string"
+
+	case *ufwb.Binary:
+		if e.Transform() != "" {
+			g.errorf(e, "transformed binaries can't be generated")
+			return ""
+		}
+		if e.Structure() != nil {
+			g.errorf(e, "binaries decoded with a structure can't be generated")
+			return ""
+		}
+		return "[]byte"
+
+	case *ufwb.Structure:
+		return "*" + g.typeName(e)
+
+	case *ufwb.StructRef:
+		return "*" + g.typeName(e.Structure())
+	}
+
+	g.errorf(e, "%s elements can't be generated", strings.ToLower(strings.TrimPrefix(fmt.Sprintf("%T", e), "*ufwb.")))
+	return ""
+}
+
+// numberType returns the Go type, and length in bytes of the number, or "" if it has no Go type.
+func numberType(n *ufwb.Number) (string, int64) {
+	length, ok := n.Length().(ufwb.ConstExpression)
+	if !ok {
+		return "", 0
+	}
+	bytes := int64(length)
+	if n.LengthUnit() == ufwb.BitLengthUnit {
+		if bytes%8 != 0 {
+			return "", 0
+		}
+		bytes /= 8
+	}
+
+	switch n.Type {
+	case "integer":
+		// Only the lengths the Decoder supports
+		if bytes != 1 && bytes != 2 && bytes != 4 && bytes != 8 {
+			return "", 0
+		}
+		if n.Signed() {
+			return fmt.Sprintf("int%d", bytes*8), bytes
+		}
+		return fmt.Sprintf("uint%d", bytes*8), bytes
+
+	case "float":
+		if bytes == 4 || bytes == 8 {
+			return fmt.Sprintf("float%d", bytes*8), bytes
+		}
+	}
+	return "", 0
+}
+
+// constants prints a constant for each of the number's fixed values that fits in its type.
+func (g *Generator) constants(typeName string, f *field) {
+	n, ok := f.elem.(*ufwb.Number)
+	if !ok || n.Type != "integer" || len(n.Values()) == 0 {
+		return
+	}
+
+	var lines []string
+	for _, v := range n.Values() {
+		if !fits(v.Value(), f.typ) {
+			continue
+		}
+		name := unique(typeName+f.name+goName(v.Name()), g.names)
+		lines = append(lines, fmt.Sprintf("%s %s = %d\n", name, f.typ, v.Value()))
+	}
+	if len(lines) == 0 {
+		return
+	}
+
+	g.Printf("// Fixed values of %s.%s.\n", typeName, f.name)
+	g.Printf("const (\n")
+	for _, line := range lines {
+		g.Printf("%s", line)
+	}
+	g.Printf(")\n\n")
+}
+
+// fits returns true if the int64 or uint64 value can be held in the Go integer type.
+func fits(value interface{}, typ string) bool {
+	var bits uint
+	fmt.Sscanf(strings.TrimPrefix(strings.TrimPrefix(typ, "u"), "int"), "%d", &bits)
+	signed := !strings.HasPrefix(typ, "u")
+
+	switch v := value.(type) {
+	case int64:
+		if signed {
+			return bits == 64 || (v >= -1<<(bits-1) && v < 1<<(bits-1))
+		}
+		return v >= 0 && (bits == 64 || v < 1<<bits)
+	case uint64:
+		if signed {
+			return v < 1<<(bits-1)
+		}
+		return bits == 64 || v < 1<<bits
+	}
+	return false
+}
+
+// decodeField prints the code, within the structure's decode func, to decode the field.
+func (g *Generator) decodeField(s *ufwb.Structure, f *field) {
+	if isOne(f.elem) {
+		g.Printf("if v.%s, err = %s(d, end); err != nil {\n", f.name, f.fn)
+		g.Printf("return err\n")
+		g.Printf("}\n")
+		return
+	}
+
+	repeats := f.elem.(ufwb.Repeatable)
+	g.Printf("{\n")
+	g.eval(f.elem, "repeatmin", "repeatMin", repeats.RepeatMin(), ufwb.ByteLengthUnit, "err")
+	g.eval(f.elem, "repeatmax", "repeatMax", repeats.RepeatMax(), ufwb.ByteLengthUnit, "err")
+	g.Printf("for n := int64(0); n < repeatMax; n++ {\n")
+	g.Printf("pos := d.pos\n")
+	g.Printf("x, err := %s(d, end)\n", f.fn)
+	g.Printf("if err != nil {\n")
+	g.Printf("d.pos = pos\n")
+	g.Printf("if n >= repeatMin {\n")
+	g.Printf("break\n")
+	g.Printf("}\n")
+	g.Printf("return err\n")
+	g.Printf("}\n")
+	g.Printf("v.%s = append(v.%s, x)\n", f.name, f.name)
+	if repeats.RepeatMax() == ufwb.StringExpression("unlimited") {
+		g.Printf("if d.pos == pos {\n")
+		g.Printf("break // Avoid looping forever on empty values\n")
+		g.Printf("}\n")
+	}
+	g.Printf("}\n")
+	g.Printf("}\n")
+}
+
+// element prints the func that decodes a single value of the field.
+func (g *Generator) element(s *ufwb.Structure, f *field) {
+	zero := "nil"
+	switch f.typ {
+	case "string":
+		zero = `""`
+	case "[]byte":
+	default:
+		if !strings.HasPrefix(f.typ, "*") {
+			zero = "0"
+		}
+	}
+	ret := zero + ", err"
+	path := s.Name() + "." + f.elem.Name()
+
+	g.Printf("// %s decodes %s.\n", f.fn, path)
+	g.Printf("func %s(d *decoder, end int64) (x %s, err error) {\n", f.fn, f.typ)
+
+	switch e := f.elem.(type) {
+	case *ufwb.Number:
+		g.Printf("defer d.wrap(%q, d.pos, &err)\n", path)
+		g.number(e, f, ret)
+
+	case *ufwb.String:
+		g.Printf("defer d.wrap(%q, d.pos, &err)\n", path)
+		switch e.Typ() {
+		case "fixed-length":
+			g.eval(e, "length", "length", e.Length(), e.LengthUnit(), ret)
+			g.Printf("b, err := d.bytes(length, end)\n")
+		case "zero-terminated", "delimiter-terminated":
+			g.Printf("b, err := d.until(0x%02x, end)\n", e.Delimiter())
+		case "pascal":
+			g.Printf("b, err := d.pascal(end)\n")
+		default:
+			g.errorf(e, "%q strings can't be generated", e.Typ())
+			g.Printf("var b []byte\n")
+		}
+		g.Printf("if err != nil {\n")
+		g.Printf("return %s\n", ret)
+		g.Printf("}\n")
+		g.Printf("return string(b), nil\n")
+
+	case *ufwb.Binary:
+		g.Printf("defer d.wrap(%q, d.pos, &err)\n", path)
+		g.eval(e, "length", "length", e.Length(), e.LengthUnit(), ret)
+		g.Printf("if x, err = d.bytes(length, end); err != nil {\n")
+		g.Printf("return %s\n", ret)
+		g.Printf("}\n")
+		if values := e.Values(); len(values) > 0 && e.MustMatch() == ufwb.True {
+			var conds []string
+			for _, v := range values {
+				conds = append(conds, fmt.Sprintf("!bytes.Equal(x, %s)", byteSlice(v.Value())))
+			}
+			g.Printf("if %s {\n", strings.Join(conds, " && "))
+			g.Printf("return nil, fmt.Errorf(\"%% x does not match any of the fixed values\", x)\n")
+			g.Printf("}\n")
+		}
+		g.Printf("return x, nil\n")
+
+	default:
+		// Structures wrap their own errors
+		g.Printf("x = &%s{}\n", strings.TrimPrefix(f.typ, "*"))
+		g.Printf("return x, x.decode(d, end)\n")
+	}
+
+	g.Printf("}\n\n")
+}
+
+// number prints the body of the func decoding the number.
+func (g *Generator) number(n *ufwb.Number, f *field, ret string) {
+	_, length := numberType(n)
+
+	bigEndian := false
+	switch n.Endian() {
+	case ufwb.BigEndian:
+		bigEndian = true
+	case ufwb.LittleEndian:
+	default:
+		g.errorf(n, "dynamic endian can't be generated")
+	}
+
+	if n.Type == "float" {
+		g.math = true
+		g.Printf("i, err := d.uint(%d, end, %t)\n", length, bigEndian)
+		g.Printf("if err != nil {\n")
+		g.Printf("return %s\n", ret)
+		g.Printf("}\n")
+		if length == 4 {
+			g.Printf("return math.Float32frombits(uint32(i)), nil\n")
+		} else {
+			g.Printf("return math.Float64frombits(i), nil\n")
+		}
+		if len(n.Values()) > 0 {
+			g.errorf(n, "fixed values of float numbers can't be generated")
+		}
+		return
+	}
+
+	read := "uint"
+	if n.Signed() {
+		read = "int"
+	}
+	g.Printf("i, err := d.%s(%d, end, %t)\n", read, length, bigEndian)
+	g.Printf("if err != nil {\n")
+	g.Printf("return %s\n", ret)
+	g.Printf("}\n")
+	g.Printf("x = %s(i)\n", f.typ)
+
+	if values := n.Values(); len(values) > 0 && n.MustMatch() == ufwb.True {
+		// Fixed values are compared as 64 bit integers, the same as the Decoder.
+		var conds []string
+		for _, v := range values {
+			conds = append(conds, fmt.Sprintf("uint64(x) != %#x", toUint64(v.Value())))
+		}
+		g.Printf("if %s {\n", strings.Join(conds, " && "))
+		g.Printf("return 0, fmt.Errorf(\"%%d does not match any of the fixed values\", x)\n")
+		g.Printf("}\n")
+	}
+
+	g.Printf("d.prev[%q] = int64(x)\n", n.Name())
+	g.Printf("return x, nil\n")
+}
+
+// eval prints code that assigns the value of the expression to a new int64 variable. ret is
+// returned if the expression can't be evaluated.
+func (g *Generator) eval(e ufwb.Element, attr, variable string, expr ufwb.Expression, unit ufwb.LengthUnit, ret string) {
+	switch expr := expr.(type) {
+	case ufwb.ConstExpression:
+		i := int64(expr)
+		if unit == ufwb.BitLengthUnit {
+			if i%8 != 0 {
+				g.errorf(e, "%s of %d bits can't be generated", attr, i)
+			}
+			i /= 8
+		}
+		g.Printf("%s := int64(%d)\n", variable, i)
+		return
+
+	case ufwb.StringExpression:
+		switch {
+		case expr == "remaining":
+			g.Printf("%s := end - d.pos\n", variable)
+			return
+
+		case expr == "unlimited":
+			g.math = true
+			g.Printf("%s := int64(math.MaxInt64)\n", variable)
+			return
+
+		case strings.HasPrefix(string(expr), "prev.") && unit != ufwb.BitLengthUnit:
+			g.Printf("%s, err := d.get(%q)\n", variable, strings.TrimPrefix(string(expr), "prev."))
+			g.Printf("if err != nil {\n")
+			g.Printf("return %s\n", ret)
+			g.Printf("}\n")
+			return
+		}
+	}
+
+	g.errorf(e, "%s %s can't be generated", attr, exprString(expr))
+	g.Printf("var %s int64\n", variable)
+}
+
+// exprString returns the expression as it appears in a grammar.
+func exprString(expr ufwb.Expression) string {
+	switch expr := expr.(type) {
+	case ufwb.ConstExpression:
+		return fmt.Sprintf("%d", int64(expr))
+	case ufwb.StringExpression:
+		return fmt.Sprintf("%q", string(expr))
+	}
+	return "<nil>"
+}
+
+// isOne returns true if the element is not repeated.
+func isOne(e ufwb.Element) bool {
+	r, ok := e.(ufwb.Repeatable)
+	return !ok || (r.RepeatMin() == ufwb.ConstExpression(1) && r.RepeatMax() == ufwb.ConstExpression(1))
+}
+
+// toUint64 returns the int64 or uint64 value as a uint64.
+func toUint64(value interface{}) uint64 {
+	switch v := value.(type) {
+	case int64:
+		return uint64(v)
+	case uint64:
+		return v
+	}
+	panic(fmt.Sprintf("unexpected fixed value %T", value))
+}
+
+// byteSlice returns a Go []byte literal of the bytes.
+func byteSlice(b []byte) string {
+	var elems []string
+	for _, c := range b {
+		elems = append(elems, fmt.Sprintf("0x%02x", c))
+	}
+	return "[]byte{" + strings.Join(elems, ", ") + "}"
+}
+
+// goName returns the name as a exported Go identifier, for example "PNG file" becomes "PNGFile".
+func goName(name string) string {
+	var buf bytes.Buffer
+	upper := true
+	for _, r := range name {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			upper = true
+			continue
+		}
+		if buf.Len() == 0 && unicode.IsDigit(r) {
+			buf.WriteRune('N')
+		}
+		if upper {
+			r = unicode.ToUpper(r)
+			upper = false
+		}
+		buf.WriteRune(r)
+	}
+	if buf.Len() == 0 {
+		return "Unnamed"
+	}
+	return buf.String()
+}
+
+// unique returns name, or name suffixed with a number, such that it's not already used.
+func unique(name string, used map[string]bool) string {
+	id := name
+	for i := 2; used[id]; i++ {
+		id = fmt.Sprintf("%s%d", name, i)
+	}
+	used[id] = true
+	return id
+}
+
+// runtime is included in every generated file, and implements the reading of values.
+const runtime = `// DecodeError is returned when a element can't be decoded.
+type DecodeError struct {
+	Element string // Name of the element, for example "Header.Length".
+	Offset  int64  // Offset the element starts at.
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s at 0x%x: %s", e.Element, e.Offset, e.Err)
+}
+
+// decoder holds the state while decoding.
+type decoder struct {
+	b    []byte
+	pos  int64
+	prev map[string]int64 // Last value of each number, by name.
+}
+
+// wrap wraps *err in a DecodeError, unless it already is one.
+func (d *decoder) wrap(element string, offset int64, err *error) {
+	if *err == nil {
+		return
+	}
+	if _, ok := (*err).(*DecodeError); !ok {
+		*err = &DecodeError{Element: element, Offset: offset, Err: *err}
+	}
+}
+
+// get returns the value of the last number decoded with this name.
+func (d *decoder) get(name string) (int64, error) {
+	i, found := d.prev[name]
+	if !found {
+		return 0, fmt.Errorf("no previous element named %q found", name)
+	}
+	return i, nil
+}
+
+// bytes returns the next n bytes, without reading past end.
+func (d *decoder) bytes(n, end int64) ([]byte, error) {
+	if d.pos >= end {
+		return nil, io.EOF
+	}
+	if n < 0 || n > end-d.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint returns the next n byte unsigned integer.
+func (d *decoder) uint(n, end int64, bigEndian bool) (uint64, error) {
+	b, err := d.bytes(n, end)
+	if err != nil {
+		return 0, err
+	}
+	var i uint64
+	for j, c := range b {
+		if bigEndian {
+			i = i<<8 | uint64(c)
+		} else {
+			i |= uint64(c) << (8 * uint(j))
+		}
+	}
+	return i, nil
+}
+
+// int returns the next n byte signed integer.
+func (d *decoder) int(n, end int64, bigEndian bool) (int64, error) {
+	i, err := d.uint(n, end, bigEndian)
+	shift := uint(64 - 8*n)
+	return int64(i<<shift) >> shift, err
+}
+
+// until returns the bytes up to the delimiter, without reading past end. The delimiter is
+// consumed but not returned.
+func (d *decoder) until(delim byte, end int64) ([]byte, error) {
+	if d.pos >= end {
+		return nil, io.EOF
+	}
+	i := int64(bytes.IndexByte(d.b[d.pos:end], delim))
+	if i < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.b[d.pos : d.pos+i]
+	d.pos += i + 1
+	return b, nil
+}
+
+// pascal returns the bytes of a string prefixed with a one byte length.
+func (d *decoder) pascal(end int64) ([]byte, error) {
+	n, err := d.uint(1, end, false)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return d.bytes(int64(n), end)
+}
+`
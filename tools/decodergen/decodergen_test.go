@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bramp.net/dsector/ufwb"
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	g := Generator{
+		args: []string{"-grammar", "sample.grammar"},
+		pkg:  "sample",
+	}
+
+	got, errs := g.generateFile("sample/sample.grammar")
+	if len(errs) > 0 {
+		t.Fatalf("generateFile(...) = %q want nil error", errs)
+	}
+
+	want, err := ioutil.ReadFile("sample/sample_decoder.go")
+	if err != nil {
+		t.Fatalf("ReadFile(...) = %q want nil error", err)
+	}
+
+	if !bytes.Equal(got, want) {
+		t.Errorf("generateFile(...) differs from sample/sample_decoder.go, run go generate:\n%s", pretty.Compare(string(got), string(want)))
+	}
+}
+
+func TestGenerateUnsupported(t *testing.T) {
+	xml := `<ufwb>
+<grammar name="Bad" start="id:1">
+	<structure name="File" id="1" order="variable">
+		<number name="Odd" id="2" type="integer" length="3"/>
+		<binary name="Packed" id="3" length="remaining" transform="zlib"/>
+		<binary name="Nested" id="6" length="2" structure="id:1"/>
+		<string name="Text" id="4" type="fixed-length" length="Odd"/>
+		<scriptelement name="Check" id="5">
+			<script name="Check"><source language="Lua">print(1)</source></script>
+		</scriptelement>
+	</structure>
+</grammar>
+</ufwb>`
+
+	u, errs := ufwb.ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	g := Generator{pkg: "bad"}
+	_, errs = g.generate(u)
+
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+	want := []string{
+		`3:2: <*ufwb.Structure id=1 name="File">: variable order can't be generated`,
+		`4:3: <*ufwb.Number id=2 name="Odd">: integer numbers of length 3 can't be generated`,
+		`5:3: <*ufwb.Binary id=3 name="Packed">: transformed binaries can't be generated`,
+		`6:3: <*ufwb.Binary id=6 name="Nested">: binaries decoded with a structure can't be generated`,
+		`8:3: <*ufwb.Script id=5 name="Check">: script elements can't be generated`,
+		`7:3: <*ufwb.String id=4 name="Text">: length "Odd" can't be generated`,
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("generate(...) errors = -got +want:\n%s", diff)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	tests := map[string]string{
+		"PNG File": "PNGFile",
+		"count":    "Count",
+		"a--b__c":  "ABC",
+		"1st":      "N1st",
+		"Größe":    "Größe",
+		"":         "Unnamed",
+	}
+	for name, want := range tests {
+		if got := goName(name); got != want {
+			t.Errorf("goName(%q) = %q want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,5 @@
+// Package sample is a example of a decoder generated by decodergen, and is used to test that
+// the generated code decodes the same as the ufwb.Decoder.
+package sample // import "bramp.net/dsector/tools/decodergen/sample"
+
+//go:generate decodergen -grammar sample.grammar
@@ -0,0 +1,429 @@
+// Code generated by "decodergen -grammar sample.grammar"; DO NOT EDIT
+
+package sample
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Decode decodes b with the Sample grammar. The returned values may refer to b.
+func Decode(b []byte) (*File, error) {
+	d := &decoder{b: b, prev: make(map[string]int64)}
+	v := &File{}
+	if err := v.decode(d, int64(len(b))); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
+
+// File is the File structure.
+type File struct {
+	Magic   []byte
+	Version uint16
+	Count   uint8
+	// A length prefixed record.
+	Record []*Record
+	Name   string
+	Header *Header
+	Chunk  []*Chunk
+}
+
+// Fixed values of File.Version.
+const (
+	FileVersionV1 uint16 = 1
+	FileVersionV2 uint16 = 2
+)
+
+// decode decodes the File structure from d, without reading past end.
+func (v *File) decode(d *decoder, end int64) (err error) {
+	defer d.wrap("File", d.pos, &err)
+	if v.Magic, err = decodeFileMagic(d, end); err != nil {
+		return err
+	}
+	if v.Version, err = decodeFileVersion(d, end); err != nil {
+		return err
+	}
+	if v.Count, err = decodeFileCount(d, end); err != nil {
+		return err
+	}
+	{
+		repeatMin, err := d.get("Count")
+		if err != nil {
+			return err
+		}
+		repeatMax, err := d.get("Count")
+		if err != nil {
+			return err
+		}
+		for n := int64(0); n < repeatMax; n++ {
+			pos := d.pos
+			x, err := decodeFileRecord(d, end)
+			if err != nil {
+				d.pos = pos
+				if n >= repeatMin {
+					break
+				}
+				return err
+			}
+			v.Record = append(v.Record, x)
+		}
+	}
+	if v.Name, err = decodeFileName(d, end); err != nil {
+		return err
+	}
+	if v.Header, err = decodeFileHeader(d, end); err != nil {
+		return err
+	}
+	{
+		repeatMin := int64(0)
+		repeatMax := int64(math.MaxInt64)
+		for n := int64(0); n < repeatMax; n++ {
+			pos := d.pos
+			x, err := decodeFileChunk(d, end)
+			if err != nil {
+				d.pos = pos
+				if n >= repeatMin {
+					break
+				}
+				return err
+			}
+			v.Chunk = append(v.Chunk, x)
+			if d.pos == pos {
+				break // Avoid looping forever on empty values
+			}
+		}
+	}
+	return nil
+}
+
+// decodeFileMagic decodes File.Magic.
+func decodeFileMagic(d *decoder, end int64) (x []byte, err error) {
+	defer d.wrap("File.Magic", d.pos, &err)
+	length := int64(4)
+	if x, err = d.bytes(length, end); err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(x, []byte{0x53, 0x4d, 0x50, 0x46}) {
+		return nil, fmt.Errorf("% x does not match any of the fixed values", x)
+	}
+	return x, nil
+}
+
+// decodeFileVersion decodes File.Version.
+func decodeFileVersion(d *decoder, end int64) (x uint16, err error) {
+	defer d.wrap("File.Version", d.pos, &err)
+	i, err := d.uint(2, end, false)
+	if err != nil {
+		return 0, err
+	}
+	x = uint16(i)
+	if uint64(x) != 0x1 && uint64(x) != 0x2 {
+		return 0, fmt.Errorf("%d does not match any of the fixed values", x)
+	}
+	d.prev["Version"] = int64(x)
+	return x, nil
+}
+
+// decodeFileCount decodes File.Count.
+func decodeFileCount(d *decoder, end int64) (x uint8, err error) {
+	defer d.wrap("File.Count", d.pos, &err)
+	i, err := d.uint(1, end, true)
+	if err != nil {
+		return 0, err
+	}
+	x = uint8(i)
+	d.prev["Count"] = int64(x)
+	return x, nil
+}
+
+// decodeFileRecord decodes File.Record.
+func decodeFileRecord(d *decoder, end int64) (x *Record, err error) {
+	x = &Record{}
+	return x, x.decode(d, end)
+}
+
+// decodeFileName decodes File.Name.
+func decodeFileName(d *decoder, end int64) (x string, err error) {
+	defer d.wrap("File.Name", d.pos, &err)
+	b, err := d.until(0x00, end)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// decodeFileHeader decodes File.Header.
+func decodeFileHeader(d *decoder, end int64) (x *Header, err error) {
+	x = &Header{}
+	return x, x.decode(d, end)
+}
+
+// decodeFileChunk decodes File.Chunk.
+func decodeFileChunk(d *decoder, end int64) (x *Chunk, err error) {
+	x = &Chunk{}
+	return x, x.decode(d, end)
+}
+
+// Record is the Record structure.
+//
+// A length prefixed record.
+type Record struct {
+	Length uint16
+	Text   string
+	Delta  int32
+}
+
+// decode decodes the Record structure from d, without reading past end.
+func (v *Record) decode(d *decoder, end int64) (err error) {
+	defer d.wrap("Record", d.pos, &err)
+	if v.Length, err = decodeRecordLength(d, end); err != nil {
+		return err
+	}
+	if v.Text, err = decodeRecordText(d, end); err != nil {
+		return err
+	}
+	if v.Delta, err = decodeRecordDelta(d, end); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeRecordLength decodes Record.Length.
+func decodeRecordLength(d *decoder, end int64) (x uint16, err error) {
+	defer d.wrap("Record.Length", d.pos, &err)
+	i, err := d.uint(2, end, true)
+	if err != nil {
+		return 0, err
+	}
+	x = uint16(i)
+	d.prev["Length"] = int64(x)
+	return x, nil
+}
+
+// decodeRecordText decodes Record.Text.
+func decodeRecordText(d *decoder, end int64) (x string, err error) {
+	defer d.wrap("Record.Text", d.pos, &err)
+	length, err := d.get("Length")
+	if err != nil {
+		return "", err
+	}
+	b, err := d.bytes(length, end)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// decodeRecordDelta decodes Record.Delta.
+func decodeRecordDelta(d *decoder, end int64) (x int32, err error) {
+	defer d.wrap("Record.Delta", d.pos, &err)
+	i, err := d.int(4, end, true)
+	if err != nil {
+		return 0, err
+	}
+	x = int32(i)
+	d.prev["Delta"] = int64(x)
+	return x, nil
+}
+
+// Header is the Header structure.
+type Header struct {
+	Scale float32
+	Flags []uint8
+}
+
+// decode decodes the Header structure from d, without reading past end.
+func (v *Header) decode(d *decoder, end int64) (err error) {
+	defer d.wrap("Header", d.pos, &err)
+	length := int64(8)
+	if d.pos+length < end {
+		end = d.pos + length
+	}
+	if v.Scale, err = decodeHeaderScale(d, end); err != nil {
+		return err
+	}
+	{
+		repeatMin := int64(0)
+		repeatMax := int64(4)
+		for n := int64(0); n < repeatMax; n++ {
+			pos := d.pos
+			x, err := decodeHeaderFlags(d, end)
+			if err != nil {
+				d.pos = pos
+				if n >= repeatMin {
+					break
+				}
+				return err
+			}
+			v.Flags = append(v.Flags, x)
+		}
+	}
+	d.pos = end
+	return nil
+}
+
+// decodeHeaderScale decodes Header.Scale.
+func decodeHeaderScale(d *decoder, end int64) (x float32, err error) {
+	defer d.wrap("Header.Scale", d.pos, &err)
+	i, err := d.uint(4, end, true)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(uint32(i)), nil
+}
+
+// decodeHeaderFlags decodes Header.Flags.
+func decodeHeaderFlags(d *decoder, end int64) (x uint8, err error) {
+	defer d.wrap("Header.Flags", d.pos, &err)
+	i, err := d.uint(1, end, true)
+	if err != nil {
+		return 0, err
+	}
+	x = uint8(i)
+	d.prev["Flags"] = int64(x)
+	return x, nil
+}
+
+// Chunk is the Chunk structure.
+type Chunk struct {
+	Size uint32
+	Data []byte
+}
+
+// decode decodes the Chunk structure from d, without reading past end.
+func (v *Chunk) decode(d *decoder, end int64) (err error) {
+	defer d.wrap("Chunk", d.pos, &err)
+	if v.Size, err = decodeChunkSize(d, end); err != nil {
+		return err
+	}
+	if v.Data, err = decodeChunkData(d, end); err != nil {
+		return err
+	}
+	return nil
+}
+
+// decodeChunkSize decodes Chunk.Size.
+func decodeChunkSize(d *decoder, end int64) (x uint32, err error) {
+	defer d.wrap("Chunk.Size", d.pos, &err)
+	i, err := d.uint(4, end, false)
+	if err != nil {
+		return 0, err
+	}
+	x = uint32(i)
+	d.prev["Size"] = int64(x)
+	return x, nil
+}
+
+// decodeChunkData decodes Chunk.Data.
+func decodeChunkData(d *decoder, end int64) (x []byte, err error) {
+	defer d.wrap("Chunk.Data", d.pos, &err)
+	length, err := d.get("Size")
+	if err != nil {
+		return nil, err
+	}
+	if x, err = d.bytes(length, end); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// DecodeError is returned when a element can't be decoded.
+type DecodeError struct {
+	Element string // Name of the element, for example "Header.Length".
+	Offset  int64  // Offset the element starts at.
+	Err     error
+}
+
+func (e *DecodeError) Error() string {
+	return fmt.Sprintf("%s at 0x%x: %s", e.Element, e.Offset, e.Err)
+}
+
+// decoder holds the state while decoding.
+type decoder struct {
+	b    []byte
+	pos  int64
+	prev map[string]int64 // Last value of each number, by name.
+}
+
+// wrap wraps *err in a DecodeError, unless it already is one.
+func (d *decoder) wrap(element string, offset int64, err *error) {
+	if *err == nil {
+		return
+	}
+	if _, ok := (*err).(*DecodeError); !ok {
+		*err = &DecodeError{Element: element, Offset: offset, Err: *err}
+	}
+}
+
+// get returns the value of the last number decoded with this name.
+func (d *decoder) get(name string) (int64, error) {
+	i, found := d.prev[name]
+	if !found {
+		return 0, fmt.Errorf("no previous element named %q found", name)
+	}
+	return i, nil
+}
+
+// bytes returns the next n bytes, without reading past end.
+func (d *decoder) bytes(n, end int64) ([]byte, error) {
+	if d.pos >= end {
+		return nil, io.EOF
+	}
+	if n < 0 || n > end-d.pos {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.b[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+// uint returns the next n byte unsigned integer.
+func (d *decoder) uint(n, end int64, bigEndian bool) (uint64, error) {
+	b, err := d.bytes(n, end)
+	if err != nil {
+		return 0, err
+	}
+	var i uint64
+	for j, c := range b {
+		if bigEndian {
+			i = i<<8 | uint64(c)
+		} else {
+			i |= uint64(c) << (8 * uint(j))
+		}
+	}
+	return i, nil
+}
+
+// int returns the next n byte signed integer.
+func (d *decoder) int(n, end int64, bigEndian bool) (int64, error) {
+	i, err := d.uint(n, end, bigEndian)
+	shift := uint(64 - 8*n)
+	return int64(i<<shift) >> shift, err
+}
+
+// until returns the bytes up to the delimiter, without reading past end. The delimiter is
+// consumed but not returned.
+func (d *decoder) until(delim byte, end int64) ([]byte, error) {
+	if d.pos >= end {
+		return nil, io.EOF
+	}
+	i := int64(bytes.IndexByte(d.b[d.pos:end], delim))
+	if i < 0 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	b := d.b[d.pos : d.pos+i]
+	d.pos += i + 1
+	return b, nil
+}
+
+// pascal returns the bytes of a string prefixed with a one byte length.
+func (d *decoder) pascal(end int64) ([]byte, error) {
+	n, err := d.uint(1, end, false)
+	if err != nil || n == 0 {
+		return nil, err
+	}
+	return d.bytes(int64(n), end)
+}
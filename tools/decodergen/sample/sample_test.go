@@ -0,0 +1,157 @@
+package sample
+
+import (
+	"bramp.net/dsector/input"
+	"bramp.net/dsector/ufwb"
+	"encoding/hex"
+	"fmt"
+	"github.com/kylelemons/godebug/pretty"
+	"math"
+	"os"
+	"testing"
+)
+
+var sampleFile = []byte("SMPF\x02\x00\x02" +
+	"\x00\x03abc\xff\xff\xff\xfe" + // Record
+	"\x00\x01x\xff\xff\xff\x9c" + // Record
+	"hi\x00" + // Name
+	"\x3f\x80\x00\x00\x07\x08\x09\x0a" + // Header
+	"\x02\x00\x00\x00zz" + // Chunk
+	"\x01\x00\x00\x00q") // Chunk
+
+// flatten returns each leaf value decoded by the Decoder as "path=value".
+func flatten(file input.Input, value *ufwb.Value, path string, out *[]string) error {
+	path += "/" + value.Name()
+	if len(value.Children) > 0 {
+		for _, child := range value.Children {
+			if err := flatten(file, child, path, out); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	switch value.Element.(type) {
+	case *ufwb.Number:
+		i, err := value.Int(file)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, fmt.Sprintf("%s=%d", path, i))
+
+	case *ufwb.String:
+		s, err := value.Format(file)
+		if err != nil {
+			return err
+		}
+		*out = append(*out, fmt.Sprintf("%s=%s", path, s))
+
+	default:
+		b := make([]byte, value.Len)
+		if _, err := file.ReadAt(b, value.Offset); err != nil {
+			return err
+		}
+		*out = append(*out, fmt.Sprintf("%s=%s", path, hex.EncodeToString(b)))
+	}
+	return nil
+}
+
+func readGrammar(t *testing.T) *ufwb.Ufwb {
+	f, err := os.Open("sample.grammar")
+	if err != nil {
+		t.Fatalf("os.Open(...) = %q want nil error", err)
+	}
+	defer f.Close()
+
+	u, errs := ufwb.ParseXmlGrammar(f)
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+	return u
+}
+
+func TestDecode(t *testing.T) {
+	got, err := Decode(sampleFile)
+	if err != nil {
+		t.Fatalf("Decode(...) = %q want nil error", err)
+	}
+
+	// Flatten the generated structs the same way as the Decoder's values
+	var gotValues []string
+	add := func(path string, value interface{}) {
+		gotValues = append(gotValues, fmt.Sprintf("/Sample/File/%s=%v", path, value))
+	}
+	add("Magic", hex.EncodeToString(got.Magic))
+	add("Version", got.Version)
+	add("Count", got.Count)
+	for _, r := range got.Record {
+		add("Record/Length", r.Length)
+		add("Record/Text", r.Text)
+		add("Record/Delta", r.Delta)
+	}
+	add("Name", got.Name)
+	add("Header/Scale", math.Float32bits(got.Header.Scale)) // The Decoder only reads the bits
+	for _, flags := range got.Header.Flags {
+		add("Header/Flags", flags)
+	}
+	for _, c := range got.Chunk {
+		add("Chunk/Size", c.Size)
+		add("Chunk/Data", hex.EncodeToString(c.Data))
+	}
+
+	file := input.FromBytes(sampleFile)
+	value, err := ufwb.NewDecoder(readGrammar(t), file).Decode()
+	if err != nil {
+		t.Fatalf("Decoder.Decode() = %q want nil error", err)
+	}
+	var want []string
+	if err := flatten(file, value, "", &want); err != nil {
+		t.Fatalf("flatten(...) = %q want nil error", err)
+	}
+
+	if diff := pretty.Compare(gotValues, want); diff != "" {
+		t.Errorf("Decode(...) = -got +want:\n%s", diff)
+	}
+
+	if got.Version != FileVersionV2 {
+		t.Errorf("Decode(...).Version = %d want %d", got.Version, FileVersionV2)
+	}
+	if got.Header.Scale != 1.0 {
+		t.Errorf("Decode(...).Header.Scale = %f want 1.0", got.Header.Scale)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	u := readGrammar(t)
+
+	tests := []struct {
+		data []byte
+		want string
+	}{
+		{
+			data: []byte("SMPX\x01\x00\x00"),
+			want: "File.Magic at 0x0: 53 4d 50 58 does not match any of the fixed values",
+		}, {
+			data: []byte("SMPF\x03\x00\x00"),
+			want: "File.Version at 0x4: 3 does not match any of the fixed values",
+		}, {
+			data: []byte("SMPF\x01\x00\x01\x00\x05ab"),
+			want: "Record.Text at 0x9: unexpected EOF",
+		},
+	}
+
+	for _, test := range tests {
+		_, err := Decode(test.data)
+		if err == nil || err.Error() != test.want {
+			t.Errorf("Decode(%q) = %v want %q", test.data, err, test.want)
+		}
+		if _, ok := err.(*DecodeError); !ok {
+			t.Errorf("Decode(%q) = %T want *DecodeError", test.data, err)
+		}
+
+		// The Decoder should fail too
+		if _, err := ufwb.NewDecoder(u, input.FromBytes(test.data)).Decode(); err == nil {
+			t.Errorf("Decoder.Decode(%q) = nil want error", test.data)
+		}
+	}
+}
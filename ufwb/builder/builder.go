@@ -0,0 +1,657 @@
+// Package builder constructs grammars in Go, instead of parsing them from XML. For example:
+//
+//	g := builder.New("Example").Extensions("ex")
+//
+//	file := g.Structure("File").BigEndian()
+//	file.Binary("Magic").Length(4).Fixed("magic", []byte("EXMP"))
+//	file.Number("Count").Integer(2).Signed(false)
+//	file.String("Names").ZeroTerminated().RepeatExpr("0", "prev.Count")
+//
+//	u, errs := g.Build()
+//
+// Every element is given a unique id, and the grammar is checked by the same code that checks
+// parsed grammars.
+package builder
+
+import (
+	"bramp.net/dsector/ufwb"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Unlimited can be passed as the maximum to Repeat.
+const Unlimited = -1
+
+// Grammar builds a ufwb grammar.
+type Grammar struct {
+	x      *ufwb.XmlGrammar
+	nextId int
+
+	start *Structure
+}
+
+// New returns a builder for a grammar with this name.
+func New(name string) *Grammar {
+	return &Grammar{
+		x: &ufwb.XmlGrammar{
+			XmlIdName: ufwb.XmlIdName{Name: name},
+		},
+	}
+}
+
+func (g *Grammar) id() int {
+	g.nextId++
+	return g.nextId
+}
+
+func (g *Grammar) Description(description string) *Grammar {
+	g.x.Description = description
+	return g
+}
+
+func (g *Grammar) Author(author string) *Grammar {
+	g.x.Author = author
+	return g
+}
+
+func (g *Grammar) Email(email string) *Grammar {
+	g.x.Email = email
+	return g
+}
+
+// Extensions sets the file extensions for this grammar, without the leading dot.
+func (g *Grammar) Extensions(exts ...string) *Grammar {
+	g.x.Ext = strings.Join(exts, ",")
+	return g
+}
+
+func (g *Grammar) Uti(uti string) *Grammar {
+	g.x.Uti = uti
+	return g
+}
+
+func (g *Grammar) Mime(mime string) *Grammar {
+	g.x.Mime = mime
+	return g
+}
+
+// Start sets the structure decoding begins with. Defaults to the first structure.
+func (g *Grammar) Start(s *Structure) *Grammar {
+	g.start = s
+	return g
+}
+
+// Structure adds a top level structure.
+func (g *Grammar) Structure(name string) *Structure {
+	s := newStructure(g, name)
+	g.x.Structures = append(g.x.Structures, s.x)
+	return s
+}
+
+// Script adds a script to the grammar, which can be used by Custom elements.
+func (g *Grammar) Script(name, language, source string) *Script {
+	s := &Script{
+		x: &ufwb.XmlScript{
+			XmlIdName: ufwb.XmlIdName{Id: g.id(), Name: name},
+			Type:      "DataType",
+			Source: &ufwb.XmlSource{
+				Language: language,
+				Text:     source,
+			},
+		},
+	}
+	g.x.Scripts = append(g.x.Scripts, s.x)
+	return s
+}
+
+// Build returns the grammar, or the errors found while checking it.
+func (g *Grammar) Build() (*ufwb.Ufwb, []error) {
+	x := *g.x
+	if g.start != nil {
+		x.Start = ref(g.start.x.Id)
+	} else if len(x.Structures) > 0 {
+		x.Start = ref(x.Structures[0].Id)
+	}
+
+	return ufwb.FromXml(&ufwb.XmlUfwb{
+		Version: "1.0",
+		Grammar: &x,
+	})
+}
+
+// MustBuild is like Build, but panics if the grammar has errors. It simplifies initialising
+// global variables holding grammars.
+func (g *Grammar) MustBuild() *ufwb.Ufwb {
+	u, errs := g.Build()
+	if len(errs) > 0 {
+		panic(fmt.Sprintf("builder: grammar %q: %s", g.x.Name, errs[0]))
+	}
+	return u
+}
+
+func ref(id int) string {
+	return "id:" + strconv.Itoa(id)
+}
+
+func yesno(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func repeats(x *ufwb.XmlRepeats, min, max int64) {
+	x.RepeatMin = strconv.FormatInt(min, 10)
+	if max == Unlimited {
+		x.RepeatMax = "unlimited"
+	} else {
+		x.RepeatMax = strconv.FormatInt(max, 10)
+	}
+}
+
+// Structure builds a structure, which contains other elements.
+type Structure struct {
+	g *Grammar
+	x *ufwb.XmlStructure
+}
+
+func newStructure(g *Grammar, name string) *Structure {
+	return &Structure{
+		g: g,
+		x: &ufwb.XmlStructure{
+			XmlIdName: ufwb.XmlIdName{Id: g.id(), Name: name},
+		},
+	}
+}
+
+func (s *Structure) Id() int {
+	return s.x.Id
+}
+
+func (s *Structure) Name() string {
+	return s.x.Name
+}
+
+func (s *Structure) Description(description string) *Structure {
+	s.x.Description = description
+	return s
+}
+
+// Extends makes this structure derive from parent. Only top level structures may extend.
+func (s *Structure) Extends(parent *Structure) *Structure {
+	s.x.Extends = ref(parent.x.Id)
+	return s
+}
+
+func (s *Structure) Length(n int64) *Structure {
+	s.x.Length = strconv.FormatInt(n, 10)
+	return s
+}
+
+// LengthExpr sets the length to a expression, such as "prev.Size".
+func (s *Structure) LengthExpr(expr string) *Structure {
+	s.x.Length = expr
+	return s
+}
+
+// Bits makes the length of this structure in bits, instead of bytes.
+func (s *Structure) Bits() *Structure {
+	s.x.LengthUnit = "bit"
+	return s
+}
+
+// Repeat sets the minimum and maximum number of times this structure repeats. The max may
+// be Unlimited.
+func (s *Structure) Repeat(min, max int64) *Structure {
+	repeats(&s.x.XmlRepeats, min, max)
+	return s
+}
+
+func (s *Structure) RepeatExpr(min, max string) *Structure {
+	s.x.RepeatMin, s.x.RepeatMax = min, max
+	return s
+}
+
+func (s *Structure) BigEndian() *Structure {
+	s.x.Endian = "big"
+	return s
+}
+
+func (s *Structure) LittleEndian() *Structure {
+	s.x.Endian = "little"
+	return s
+}
+
+func (s *Structure) Signed(signed bool) *Structure {
+	s.x.Signed = yesno(signed)
+	return s
+}
+
+func (s *Structure) Encoding(encoding string) *Structure {
+	s.x.Encoding = encoding
+	return s
+}
+
+// VariableOrder allows the children of this structure to appear in any order.
+func (s *Structure) VariableOrder() *Structure {
+	s.x.Order = "variable"
+	return s
+}
+
+func (s *Structure) add(e ufwb.XmlElement) {
+	s.x.Elements = append(s.x.Elements, e)
+}
+
+// Structure adds a child structure.
+func (s *Structure) Structure(name string) *Structure {
+	child := newStructure(s.g, name)
+	s.add(child.x)
+	return child
+}
+
+// StructRef adds a reference to another structure.
+func (s *Structure) StructRef(name string, structure *Structure) *StructRef {
+	r := &StructRef{
+		x: &ufwb.XmlStructRef{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+			Structure: ref(structure.x.Id),
+		},
+	}
+	s.add(r.x)
+	return r
+}
+
+func (s *Structure) Number(name string) *Number {
+	n := &Number{
+		x: &ufwb.XmlNumber{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+			Type:      "integer",
+		},
+	}
+	s.add(n.x)
+	return n
+}
+
+func (s *Structure) String(name string) *String {
+	str := &String{
+		x: &ufwb.XmlString{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+		},
+	}
+	s.add(str.x)
+	return str
+}
+
+func (s *Structure) Binary(name string) *Binary {
+	b := &Binary{
+		x: &ufwb.XmlBinary{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+		},
+	}
+	s.add(b.x)
+	return b
+}
+
+// Custom adds a element decoded by the CustomType registered with ufwb.RegisterCustom.
+func (s *Structure) Custom(name, typ string) *Custom {
+	c := &Custom{
+		x: &ufwb.XmlCustom{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+			Type:      typ,
+		},
+	}
+	s.add(c.x)
+	return c
+}
+
+// CustomScript adds a element decoded by a script added with Grammar.Script.
+func (s *Structure) CustomScript(name string, script *Script) *Custom {
+	c := &Custom{
+		x: &ufwb.XmlCustom{
+			XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+			Script:    ref(script.x.Id),
+		},
+	}
+	s.add(c.x)
+	return c
+}
+
+// ScriptElement adds a script that is run when the element is decoded.
+func (s *Structure) ScriptElement(name, language, source string) *Structure {
+	s.add(&ufwb.XmlScriptElement{
+		XmlIdName: ufwb.XmlIdName{Id: s.g.id(), Name: name},
+		Script: &ufwb.XmlScript{
+			Type: "Generic",
+			Source: &ufwb.XmlSource{
+				Language: language,
+				Text:     source,
+			},
+		},
+	})
+	return s
+}
+
+// StructRef builds a reference to a structure.
+type StructRef struct {
+	x *ufwb.XmlStructRef
+}
+
+func (r *StructRef) Name() string {
+	return r.x.Name
+}
+
+func (r *StructRef) Description(description string) *StructRef {
+	r.x.Description = description
+	return r
+}
+
+func (r *StructRef) Repeat(min, max int64) *StructRef {
+	repeats(&r.x.XmlRepeats, min, max)
+	return r
+}
+
+func (r *StructRef) RepeatExpr(min, max string) *StructRef {
+	r.x.RepeatMin, r.x.RepeatMax = min, max
+	return r
+}
+
+// Number builds a integer or float, which defaults to a integer.
+type Number struct {
+	x *ufwb.XmlNumber
+}
+
+func (n *Number) Name() string {
+	return n.x.Name
+}
+
+func (n *Number) Description(description string) *Number {
+	n.x.Description = description
+	return n
+}
+
+// Integer makes this a integer of this many bytes.
+func (n *Number) Integer(bytes int64) *Number {
+	n.x.Type = "integer"
+	n.x.Length = strconv.FormatInt(bytes, 10)
+	return n
+}
+
+// Float makes this a float of this many bytes.
+func (n *Number) Float(bytes int64) *Number {
+	n.x.Type = "float"
+	n.x.Length = strconv.FormatInt(bytes, 10)
+	return n
+}
+
+// Bits makes this a integer of this many bits.
+func (n *Number) Bits(bits int64) *Number {
+	n.x.Type = "integer"
+	n.x.Length = strconv.FormatInt(bits, 10)
+	n.x.LengthUnit = "bit"
+	return n
+}
+
+func (n *Number) Repeat(min, max int64) *Number {
+	repeats(&n.x.XmlRepeats, min, max)
+	return n
+}
+
+func (n *Number) RepeatExpr(min, max string) *Number {
+	n.x.RepeatMin, n.x.RepeatMax = min, max
+	return n
+}
+
+func (n *Number) BigEndian() *Number {
+	n.x.Endian = "big"
+	return n
+}
+
+func (n *Number) LittleEndian() *Number {
+	n.x.Endian = "little"
+	return n
+}
+
+func (n *Number) Signed(signed bool) *Number {
+	n.x.Signed = yesno(signed)
+	return n
+}
+
+func (n *Number) Hex() *Number {
+	n.x.Display = "hex"
+	return n
+}
+
+// Range sets the minimum and maximum allowed values.
+func (n *Number) Range(min, max int64) *Number {
+	n.x.MinVal = strconv.FormatInt(min, 10)
+	n.x.MaxVal = strconv.FormatInt(max, 10)
+	return n
+}
+
+// Fixed adds a named value. Unless MustMatch(false) is used, the number must be one of the
+// fixed values.
+func (n *Number) Fixed(name string, value int64) *Number {
+	n.x.Values = append(n.x.Values, &ufwb.XmlFixedValue{
+		Name:  name,
+		Value: strconv.FormatInt(value, 10),
+	})
+	return n
+}
+
+func (n *Number) MustMatch(mustMatch bool) *Number {
+	n.x.MustMatch = yesno(mustMatch)
+	return n
+}
+
+// Checksum makes this number the checksum of the named siblings, see ufwb.Checksums.
+func (n *Number) Checksum(algorithm string, of ...string) *Number {
+	n.x.Checksum = algorithm
+	n.x.ChecksumOf = strings.Join(of, ",")
+	return n
+}
+
+// Mask adds a bit mask, whose values can be named with Mask.Fixed.
+func (n *Number) Mask(name string, mask uint64) *Mask {
+	m := &Mask{
+		x: &ufwb.XmlMask{
+			Name:  name,
+			Value: fmt.Sprintf("0x%X", mask),
+		},
+	}
+	n.x.Masks = append(n.x.Masks, m.x)
+	return m
+}
+
+// Mask builds a bit mask of a Number.
+type Mask struct {
+	x *ufwb.XmlMask
+}
+
+func (m *Mask) Description(description string) *Mask {
+	m.x.Description = description
+	return m
+}
+
+// Fixed adds a named value for the masked bits.
+func (m *Mask) Fixed(name string, value uint64) *Mask {
+	m.x.Values = append(m.x.Values, &ufwb.XmlFixedValue{
+		Name:  name,
+		Value: strconv.FormatUint(value, 10),
+	})
+	return m
+}
+
+// String builds a string, which must be given a type with FixedLength, LengthExpr,
+// ZeroTerminated, Pascal or Delimited.
+type String struct {
+	x *ufwb.XmlString
+}
+
+func (s *String) Name() string {
+	return s.x.Name
+}
+
+func (s *String) Description(description string) *String {
+	s.x.Description = description
+	return s
+}
+
+// FixedLength makes this a string of this many bytes.
+func (s *String) FixedLength(n int64) *String {
+	s.x.Type = "fixed-length"
+	s.x.Length = strconv.FormatInt(n, 10)
+	return s
+}
+
+// LengthExpr makes this a string whose length in bytes is given by the expression.
+func (s *String) LengthExpr(expr string) *String {
+	s.x.Type = "fixed-length"
+	s.x.Length = expr
+	return s
+}
+
+func (s *String) ZeroTerminated() *String {
+	s.x.Type = "zero-terminated"
+	return s
+}
+
+// Pascal makes this a string prefixed by its length.
+func (s *String) Pascal() *String {
+	s.x.Type = "pascal"
+	return s
+}
+
+// Delimited makes this a string terminated by the delimiter.
+func (s *String) Delimited(delimiter byte) *String {
+	s.x.Type = "delimiter-terminated"
+	s.x.Delimiter = fmt.Sprintf("%02X", delimiter)
+	return s
+}
+
+func (s *String) Encoding(encoding string) *String {
+	s.x.Encoding = encoding
+	return s
+}
+
+func (s *String) Repeat(min, max int64) *String {
+	repeats(&s.x.XmlRepeats, min, max)
+	return s
+}
+
+func (s *String) RepeatExpr(min, max string) *String {
+	s.x.RepeatMin, s.x.RepeatMax = min, max
+	return s
+}
+
+func (s *String) Fixed(name, value string) *String {
+	s.x.Values = append(s.x.Values, &ufwb.XmlFixedValue{
+		Name:  name,
+		Value: value,
+	})
+	return s
+}
+
+func (s *String) MustMatch(mustMatch bool) *String {
+	s.x.MustMatch = yesno(mustMatch)
+	return s
+}
+
+// Binary builds a run of bytes.
+type Binary struct {
+	x *ufwb.XmlBinary
+}
+
+func (b *Binary) Name() string {
+	return b.x.Name
+}
+
+func (b *Binary) Description(description string) *Binary {
+	b.x.Description = description
+	return b
+}
+
+func (b *Binary) Length(n int64) *Binary {
+	b.x.Length = strconv.FormatInt(n, 10)
+	return b
+}
+
+// LengthExpr sets the length to a expression, such as "remaining".
+func (b *Binary) LengthExpr(expr string) *Binary {
+	b.x.Length = expr
+	return b
+}
+
+func (b *Binary) Repeat(min, max int64) *Binary {
+	repeats(&b.x.XmlRepeats, min, max)
+	return b
+}
+
+func (b *Binary) RepeatExpr(min, max string) *Binary {
+	b.x.RepeatMin, b.x.RepeatMax = min, max
+	return b
+}
+
+func (b *Binary) Fixed(name string, value []byte) *Binary {
+	b.x.Values = append(b.x.Values, &ufwb.XmlFixedValue{
+		Name:  name,
+		Value: fmt.Sprintf("%X", value),
+	})
+	return b
+}
+
+func (b *Binary) MustMatch(mustMatch bool) *Binary {
+	b.x.MustMatch = yesno(mustMatch)
+	return b
+}
+
+// Checksum makes these bytes the checksum of the named siblings, see ufwb.Checksums.
+func (b *Binary) Checksum(algorithm string, of ...string) *Binary {
+	b.x.Checksum = algorithm
+	b.x.ChecksumOf = strings.Join(of, ",")
+	return b
+}
+
+// Transform decodes the bytes with the transform, such as "zlib", and then with the
+// structure. Either may be empty or nil.
+func (b *Binary) Transform(transform string, structure *Structure) *Binary {
+	b.x.Transform = transform
+	if structure != nil {
+		b.x.Structure = ref(structure.x.Id)
+	}
+	return b
+}
+
+// Custom builds a element implemented by a script or a ufwb.CustomType.
+type Custom struct {
+	x *ufwb.XmlCustom
+}
+
+func (c *Custom) Name() string {
+	return c.x.Name
+}
+
+func (c *Custom) Description(description string) *Custom {
+	c.x.Description = description
+	return c
+}
+
+func (c *Custom) Length(n int64) *Custom {
+	c.x.Length = strconv.FormatInt(n, 10)
+	return c
+}
+
+func (c *Custom) LengthExpr(expr string) *Custom {
+	c.x.Length = expr
+	return c
+}
+
+// Script builds a grammar level script.
+type Script struct {
+	x *ufwb.XmlScript
+}
+
+func (s *Script) Description(description string) *Script {
+	s.x.Description = description
+	return s
+}
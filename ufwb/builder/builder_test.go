@@ -0,0 +1,100 @@
+package builder
+
+import (
+	"bramp.net/dsector/input"
+	"bramp.net/dsector/ufwb"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testGrammar() *Grammar {
+	g := New("Test").Extensions("tst", "test").Mime("application/x-test")
+
+	record := g.Structure("Record").BigEndian()
+	record.Number("Length").Integer(2).Signed(false)
+	record.String("Text").LengthExpr("prev.Length")
+
+	file := g.Structure("File").BigEndian()
+	file.Binary("Magic").Length(2).Fixed("magic", []byte{0xCA, 0xFE})
+	file.Number("Flags").Integer(1).Hex().Mask("High", 0xF0).Fixed("set", 0x10)
+	file.Number("Count").Integer(1).Signed(false)
+	file.StructRef("Records", record).RepeatExpr("0", "prev.Count")
+	file.Number("Crc").Integer(4).Signed(false).Checksum("crc32", "Magic", "Flags", "Count")
+
+	return g.Start(file)
+}
+
+func TestBuild(t *testing.T) {
+	u, errs := testGrammar().Build()
+	if len(errs) > 0 {
+		t.Fatalf("Build() = %q want nil error", errs)
+	}
+
+	if got, want := u.Grammar.Start.Name(), "File"; got != want {
+		t.Errorf("Grammar.Start = %q want %q", got, want)
+	}
+	if got, want := u.Grammar.Extensions(), []string{"tst", "test"}; strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("Grammar.Extensions() = %q want %q", got, want)
+	}
+
+	data := []byte("\xca\xfe\x10\x02\x00\x02hi\x00\x03bye\x23\x22\xfc\xd9")
+	file := input.FromBytes(data)
+	value, err := ufwb.NewDecoder(u, file).Decode()
+	if err != nil {
+		t.Fatalf("Decode() error = %q want nil error", err)
+	}
+
+	matches, err := value.Select(file, "File/Records[1]/Text")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("value.Select(...) = %v, %v want one match", matches, err)
+	}
+	if got, err := matches[0].Format(file); err != nil || got != "bye" {
+		t.Errorf("Text = %q, %v want %q", got, err, "bye")
+	}
+
+	// The grammar can be saved, and parsed again
+	var out bytes.Buffer
+	if err := ufwb.WriteXmlGrammar(&out, u); err != nil {
+		t.Fatalf("WriteXmlGrammar(...) error = %q want nil error", err)
+	}
+	if _, errs := ufwb.ParseXmlGrammar(&out); len(errs) > 0 {
+		t.Errorf("ParseXmlGrammar(WriteXmlGrammar(...)) = %q want nil error", errs)
+	}
+}
+
+func TestBuildErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		build func(g *Grammar)
+	}{
+		{"unknown custom", func(g *Grammar) {
+			g.Structure("File").Custom("Field", "not-registered")
+		}},
+		{"nested extends", func(g *Grammar) {
+			base := g.Structure("Base")
+			g.Structure("File").Structure("Child").Extends(base)
+		}},
+		{"unknown checksum", func(g *Grammar) {
+			g.Structure("File").Number("Crc").Integer(4).Checksum("crc99")
+		}},
+		{"no structures", func(g *Grammar) {}},
+	}
+
+	for _, test := range tests {
+		g := New("Test")
+		test.build(g)
+		if _, errs := g.Build(); len(errs) == 0 {
+			t.Errorf("%s: Build() = nil errors want errors", test.name)
+		}
+	}
+}
+
+func TestMustBuild(t *testing.T) {
+	defer func() {
+		if r := recover(); r == nil {
+			t.Errorf("MustBuild() did not panic on a invalid grammar")
+		}
+	}()
+	New("Test").MustBuild()
+}
@@ -0,0 +1,127 @@
+package ufwb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"bramp.net/dsector/input"
+	log "github.com/Sirupsen/logrus"
+)
+
+// carveBlockSize is the number of bytes read at a time while scanning.
+const carveBlockSize = 64 * 1024
+
+// Carved is a file found embedded within another.
+type Carved struct {
+	Name    string // Name the grammar was added to the Detector with
+	Grammar *Ufwb
+	Offset  int64
+	Len     int64
+	Value   *Value // Offsets are relative to the scanned input
+}
+
+// Carve scans f for the start signatures of every grammar in the Detector, and attempts a
+// decode where all of a grammar's signatures match. The decode is bounded by the end of f, or
+// maxLen bytes if maxLen > 0. fn is called, in the order the signatures are found, for each
+// file that decoded without error. Hits inside a file already found are skipped, unless
+// CarveNested is set. Grammars without a signature are never carved.
+func (d *Detector) Carve(f input.Input, maxLen int64, fn func(*Carved) error) error {
+	size, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return err
+	}
+
+	carvedEnd := int64(0) // End of the furthest file found so far
+	block := make([]byte, carveBlockSize)
+	for pos := int64(0); pos < size; pos += carveBlockSize {
+		n, err := input.ReadFullAt(f, block, pos)
+		if err != nil && n == 0 {
+			return err
+		}
+
+		for i, b := range block[:n] {
+			for _, e := range d.byFirst[b] {
+				start := pos + int64(i) - e.sigs[0].Offset
+				if start < 0 || (!d.CarveNested && start < carvedEnd) {
+					continue
+				}
+				if !signaturesAt(f, block[:n], pos, e.sigs, start) {
+					continue
+				}
+
+				c, err := d.carveAt(f, e, start, size, maxLen)
+				if err != nil {
+					return err
+				}
+				if c == nil {
+					continue
+				}
+				if end := c.Offset + c.Len; end > carvedEnd {
+					carvedEnd = end
+				}
+				if err := fn(c); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	return nil
+}
+
+// signaturesAt returns true if all the signatures are found in f at start. block holds the
+// bytes of f starting at pos, and is checked without reading f where possible.
+func signaturesAt(f io.ReaderAt, block []byte, pos int64, sigs []Signature, start int64) bool {
+	for _, sig := range sigs {
+		offset := start + sig.Offset - pos
+		end := offset + int64(len(sig.Bytes))
+
+		var b []byte
+		if offset >= 0 && end <= int64(len(block)) {
+			b = block[offset:end]
+		} else {
+			b = make([]byte, len(sig.Bytes))
+			if _, err := input.ReadFullAt(f, b, start+sig.Offset); err != nil {
+				return false
+			}
+		}
+		if !bytes.Equal(b, sig.Bytes) {
+			return false
+		}
+	}
+	return true
+}
+
+// carveAt attempts to decode the grammar at start, returning nil if it isn't there.
+func (d *Detector) carveAt(f input.Input, e *detectEntry, start, size, maxLen int64) (*Carved, error) {
+	end := size
+	if maxLen > 0 && start+maxLen < end {
+		end = start + maxLen
+	}
+
+	value, err := decodeSafely(NewDecoderWithBounds(e.u, f, start, end))
+	if err != nil || value == nil || value.Len == 0 {
+		log.Debugf("[0x%x] Not carving %s: %v", start, e.name, err)
+		return nil, nil
+	}
+
+	return &Carved{
+		Name:    e.name,
+		Grammar: e.u,
+		Offset:  start,
+		Len:     value.Len,
+		Value:   value,
+	}, nil
+}
+
+// decodeSafely decodes, turning any panic from the decoder into a error, as grammars may hit
+// unimplemented parts of the decoder.
+func decodeSafely(d *Decoder) (value *Value, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("decoder panic: %v", r)
+		}
+	}()
+	return d.Decode()
+}
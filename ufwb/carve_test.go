@@ -0,0 +1,77 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"github.com/kylelemons/godebug/pretty"
+	"testing"
+)
+
+func TestCarve(t *testing.T) {
+	d := newTestDetector(t)
+
+	data := []byte("junk" +
+		"MAGK\x00\x01body" + // magic at 4
+		"MAGK\x00\x02" + // Wrong version
+		"\x04\x00\x00\x00RIFF" + // later at 20
+		"\x00\x00\x00\x00\x00\x00\x00" +
+		"\xCA\xFE\xBA\xBE\x00") // java, but too short
+
+	type carved struct {
+		Name   string
+		Offset int64
+		Len    int64
+	}
+
+	tests := []struct {
+		maxLen int64
+		want   []carved
+	}{
+		{0, []carved{{"magic", 4, 10}, {"later", 20, 8}}},
+		{8, []carved{{"later", 20, 8}}},
+	}
+
+	for _, test := range tests {
+		var got []carved
+		err := d.Carve(input.FromBytes(data), test.maxLen, func(c *Carved) error {
+			if c.Value == nil || c.Value.Offset != c.Offset {
+				t.Errorf("Carve(...) %s Value = %s want a value at 0x%x", c.Name, c.Value, c.Offset)
+			}
+			got = append(got, carved{c.Name, c.Offset, c.Len})
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Carve(..., %d) error = %q want nil error", test.maxLen, err)
+		}
+		if diff := pretty.Compare(got, test.want); diff != "" {
+			t.Errorf("Carve(..., %d) = -got +want:\n%s", test.maxLen, diff)
+		}
+	}
+}
+
+func TestCarveNested(t *testing.T) {
+	d := newTestDetector(t)
+
+	// A java class starting inside the magic file's Body
+	data := []byte("MAGK\x00\x01\xCA\xFE\xBA\xBE\x00\x00\x00\x34")
+
+	for _, nested := range []bool{false, true} {
+		d.CarveNested = nested
+
+		var got []string
+		err := d.Carve(input.FromBytes(data), 0, func(c *Carved) error {
+			got = append(got, c.Name)
+			return nil
+		})
+		if err != nil {
+			t.Errorf("Carve(...) error = %q want nil error", err)
+		}
+
+		want := []string{"magic"}
+		if nested {
+			want = append(want, "java")
+		}
+		if diff := pretty.Compare(got, want); diff != "" {
+			t.Errorf("Carve(...) with CarveNested = %v = -got +want:\n%s", nested, diff)
+		}
+	}
+}
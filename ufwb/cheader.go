@@ -0,0 +1,474 @@
+package ufwb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// cKeywords are reserved in C, and can't be used as field names.
+var cKeywords = map[string]bool{
+	"auto": true, "break": true, "case": true, "char": true, "const": true, "continue": true,
+	"default": true, "do": true, "double": true, "else": true, "enum": true, "extern": true,
+	"float": true, "for": true, "goto": true, "if": true, "inline": true, "int": true,
+	"long": true, "register": true, "restrict": true, "return": true, "short": true,
+	"signed": true, "sizeof": true, "static": true, "struct": true, "switch": true,
+	"typedef": true, "union": true, "unsigned": true, "void": true, "volatile": true,
+	"while": true,
+}
+
+// cField is a single field of a C struct.
+type cField struct {
+	typ     string
+	name    string
+	dims    []int64 // Array dimensions, if any
+	comment []string
+}
+
+func (f *cField) String() string {
+	decl := f.typ + " " + f.name
+	for _, d := range f.dims {
+		decl += fmt.Sprintf("[%d]", d)
+	}
+	decl += ";"
+	if len(f.comment) > 0 {
+		decl += " /* " + strings.Join(f.comment, ", ") + " */"
+	}
+	return decl
+}
+
+// cStruct is the C layout of a structure.
+type cStruct struct {
+	name   string
+	fields []*cField
+	consts []string     // #define and enum declarations for the fields
+	deps   []*Structure // Structures that must be declared first
+	size   int64        // In bytes
+
+	reason string // Why the layout isn't static, or "" if it is
+	busy   bool   // Set while the layout is being worked out, to detect cycles
+}
+
+// cHeaderWriter converts a grammar into a C header.
+type cHeaderWriter struct {
+	issues []*LintIssue
+
+	structs map[*Structure]*cStruct
+	written map[*Structure]bool
+	tags    map[string]bool // struct and enum tags already used
+	idents  map[string]bool // Constant names already used
+
+	lines []string
+}
+
+// WriteCHeader writes the structures of the grammar with a static size and layout, as packed
+// C structs, to w. Fixed values of numbers become enums, and masks, and the fixed values of
+// strings and binaries become #defines. Fields are left in the byte order of the file, which
+// is noted on each multi-byte field.
+//
+// Structures that can't be expressed, for example because they contain a field with a
+// variable length, are omitted and returned as issues.
+func WriteCHeader(w io.Writer, u *Ufwb) ([]*LintIssue, error) {
+	g := u.Grammar
+	if g == nil {
+		return nil, errors.New("no grammar")
+	}
+
+	cw := &cHeaderWriter{
+		structs: make(map[*Structure]*cStruct),
+		written: make(map[*Structure]bool),
+		tags:    make(map[string]bool),
+		idents:  make(map[string]bool),
+	}
+
+	guard := strings.ToUpper(snakeCase(g.Name())) + "_H"
+
+	cw.line("/*")
+	cw.line(" * C structures for the %s grammar, generated by dsector.", g.Name())
+	if d := strings.TrimSpace(g.Description()); d != "" {
+		cw.line(" *")
+		for _, l := range strings.Split(d, "\n") {
+			cw.line(" * %s", strings.TrimSpace(l))
+		}
+	}
+	cw.line(" *")
+	cw.line(" * Only structures with a static size and layout are included. Fields are in the")
+	cw.line(" * byte order of the file, as noted on each multi-byte field.")
+	cw.line(" */")
+	cw.line("#ifndef %s", guard)
+	cw.line("#define %s", guard)
+	cw.line("")
+	cw.line("#include <stdint.h>")
+	cw.line("")
+	cw.line("#pragma pack(push, 1)")
+
+	var walk func(elements []Element)
+	walk = func(elements []Element) {
+		for _, e := range elements {
+			if s, ok := e.(*Structure); ok {
+				cw.write(s)
+				walk(s.Elements())
+			}
+		}
+	}
+	walk(g.Elements)
+
+	cw.line("")
+	cw.line("#pragma pack(pop)")
+	cw.line("")
+	cw.line("#endif /* %s */", guard)
+
+	_, err := io.WriteString(w, strings.Join(cw.lines, "\n")+"\n")
+	return cw.issues, err
+}
+
+func (cw *cHeaderWriter) line(format string, args ...interface{}) {
+	cw.lines = append(cw.lines, fmt.Sprintf(format, args...))
+}
+
+func (cw *cHeaderWriter) add(severity Severity, e ElementId, format string, args ...interface{}) {
+	cw.issues = append(cw.issues, &LintIssue{
+		Severity: severity,
+		Element:  e,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// write writes the structure, after the structures it depends on.
+func (cw *cHeaderWriter) write(s *Structure) {
+	if cw.written[s] {
+		return
+	}
+	cw.written[s] = true
+
+	c := cw.layout(s)
+	if c.reason != "" {
+		cw.add(Error, s, "structure has no static layout, omitting it: %s", c.reason)
+		return
+	}
+
+	for _, dep := range c.deps {
+		cw.write(dep)
+	}
+
+	for _, consts := range c.consts {
+		cw.line("")
+		cw.lines = append(cw.lines, strings.Split(consts, "\n")...)
+	}
+
+	cw.line("")
+	if d := strings.TrimSpace(s.Description()); d != "" {
+		cw.line("/* %s structure, %d bytes.", s.Name(), c.size)
+		for _, l := range strings.Split(d, "\n") {
+			cw.line(" * %s", strings.TrimSpace(l))
+		}
+		cw.line(" */")
+	} else {
+		cw.line("/* %s structure, %d bytes. */", s.Name(), c.size)
+	}
+	cw.line("struct %s {", c.name)
+	for _, f := range c.fields {
+		cw.line("\t%s", f)
+	}
+	cw.line("};")
+}
+
+// layout returns the C layout of the structure, working it out if needed.
+func (cw *cHeaderWriter) layout(s *Structure) *cStruct {
+	if c, found := cw.structs[s]; found {
+		if c.busy {
+			return &cStruct{reason: "it contains itself"}
+		}
+		return c
+	}
+
+	c := &cStruct{
+		name: unique(snakeCase(s.Name()), cw.tags),
+		busy: true,
+	}
+	cw.structs[s] = c
+	defer func() { c.busy = false }()
+
+	if s.Order() == VariableOrder {
+		c.reason = "it has variable order"
+		return c
+	}
+
+	used := make(map[string]bool)
+	for _, e := range s.Elements() {
+		name := snakeCase(e.Name())
+		if cKeywords[name] {
+			name += "_"
+		}
+		f := &cField{name: unique(name, used)}
+
+		size, reason := cw.field(c, s, e, f)
+		if reason != "" {
+			c.reason = fmt.Sprintf("%q %s", e.Name(), reason)
+			return c
+		}
+
+		if !isOne(e) {
+			min, ok1 := e.RepeatMin().(ConstExpression)
+			max, ok2 := e.RepeatMax().(ConstExpression)
+			if !ok1 || !ok2 || min != max {
+				c.reason = fmt.Sprintf("%q is repeated %s to %s times", e.Name(), exprString(e.RepeatMin()), exprString(e.RepeatMax()))
+				return c
+			}
+			f.dims = append([]int64{int64(max)}, f.dims...)
+			size *= int64(max)
+		}
+
+		c.fields = append(c.fields, f)
+		c.size += size
+	}
+
+	if len(c.fields) == 0 {
+		c.reason = "it has no elements" // Empty structs aren't allowed in C
+		return c
+	}
+
+	if s.Length() != nil {
+		bits, ok := bitLength(s)
+		if !ok || bits%8 != 0 {
+			c.reason = fmt.Sprintf("it has length %s", exprString(s.Length()))
+			return c
+		}
+		if length := bits / 8; length < c.size {
+			c.reason = fmt.Sprintf("its length %d is shorter than its elements", length)
+		} else if length > c.size {
+			c.fields = append(c.fields, &cField{
+				typ:     "uint8_t",
+				name:    unique("padding", used),
+				dims:    []int64{length - c.size},
+				comment: []string{"unused"},
+			})
+			c.size = length
+		}
+	}
+
+	return c
+}
+
+// field sets the type of the field, returning its size in bytes, or the reason it's not static.
+func (cw *cHeaderWriter) field(c *cStruct, s *Structure, e Element, f *cField) (int64, string) {
+	switch e := e.(type) {
+	case *Number:
+		return cw.number(c, e, f)
+
+	case *String:
+		if e.Typ() != "fixed-length" {
+			return 0, fmt.Sprintf("is a %s string", e.Typ())
+		}
+		size, reason := cw.size(e)
+		if reason != "" {
+			return 0, reason
+		}
+		f.typ = "char"
+		f.dims = []int64{size}
+		if enc := e.Encoding(); enc != "" && enc != "UTF-8" {
+			f.comment = append(f.comment, enc)
+		}
+		c.consts = append(c.consts, cw.stringDefines(c, f, e.Values())...)
+		return size, ""
+
+	case *Binary:
+		size, reason := cw.size(e)
+		if reason != "" {
+			return 0, reason
+		}
+		f.typ = "uint8_t"
+		f.dims = []int64{size}
+		if t := e.Transform(); t != "" {
+			f.comment = append(f.comment, t+" transformed")
+		}
+		c.consts = append(c.consts, cw.binaryDefines(c, f, e.Values())...)
+		return size, ""
+
+	case *Structure:
+		return cw.nested(c, e, f)
+
+	case *StructRef:
+		if e.Structure() == nil {
+			return 0, "refers to a missing structure"
+		}
+		return cw.nested(c, e.Structure(), f)
+	}
+
+	return 0, fmt.Sprintf("is a %s element", strings.ToLower(elemType(e)))
+}
+
+// nested sets the field to the nested structure.
+func (cw *cHeaderWriter) nested(c *cStruct, s *Structure, f *cField) (int64, string) {
+	nested := cw.layout(s)
+	if nested.reason != "" {
+		return 0, "has no static layout"
+	}
+	f.typ = "struct " + nested.name
+	c.deps = append(c.deps, s)
+	return nested.size, ""
+}
+
+// size returns the constant length in bytes of the element.
+func (cw *cHeaderWriter) size(e Lengthable) (int64, string) {
+	bits, ok := bitLength(e)
+	if !ok {
+		return 0, fmt.Sprintf("has length %s", exprString(e.Length()))
+	}
+	if bits%8 != 0 {
+		return 0, fmt.Sprintf("has length of %d bits", bits)
+	}
+	return bits / 8, ""
+}
+
+// number sets the type of a number field.
+func (cw *cHeaderWriter) number(c *cStruct, n *Number, f *cField) (int64, string) {
+	size, reason := cw.size(n)
+	if reason != "" {
+		return 0, reason
+	}
+
+	switch n.Type {
+	case "integer":
+		switch size {
+		case 1, 2, 4, 8:
+			f.typ = fmt.Sprintf("int%d_t", size*8)
+			if !n.Signed() {
+				f.typ = "u" + f.typ
+			}
+		default:
+			f.typ = "uint8_t"
+			f.dims = []int64{size}
+			signed := "unsigned"
+			if n.Signed() {
+				signed = "signed"
+			}
+			f.comment = append(f.comment, fmt.Sprintf("%d bit %s integer", size*8, signed))
+		}
+	case "float":
+		switch size {
+		case 4:
+			f.typ = "float"
+		case 8:
+			f.typ = "double"
+		default:
+			return 0, fmt.Sprintf("is a %d byte float", size)
+		}
+	default:
+		return 0, fmt.Sprintf("is a %q number", n.Type)
+	}
+
+	if size > 1 {
+		switch n.Endian() {
+		case BigEndian:
+			f.comment = append(f.comment, "big endian")
+		case LittleEndian:
+			f.comment = append(f.comment, "little endian")
+		default:
+			f.comment = append(f.comment, "dynamic endian")
+			cw.add(Warning, n, "dynamic endian can't be expressed, the byte order must be checked at runtime")
+		}
+	}
+
+	if n.Type == "integer" && len(n.Values()) > 0 {
+		c.consts = append(c.consts, cw.enum(c, f, n))
+	}
+	if len(n.Masks()) > 0 {
+		prefix := strings.ToUpper(c.name + "_" + f.name + "_")
+		consts := []string{fmt.Sprintf("/* Masks of %s.%s */", c.name, f.name)}
+		for _, m := range n.Masks() {
+			name := unique(prefix+strings.ToUpper(snakeCase(m.name)), cw.idents)
+			consts = append(consts, fmt.Sprintf("#define %s 0x%x", name, m.value))
+		}
+		c.consts = append(c.consts, strings.Join(consts, "\n"))
+	}
+	return size, ""
+}
+
+// enum returns the declaration of the fixed values of the number. Values that don't fit in a
+// C enum are declared with #define instead.
+func (cw *cHeaderWriter) enum(c *cStruct, f *cField, n *Number) string {
+	prefix := strings.ToUpper(c.name + "_" + f.name + "_")
+
+	isEnum := true
+	for _, v := range n.Values() {
+		switch v := v.value.(type) {
+		case int64:
+			isEnum = isEnum && v >= -1<<31 && v < 1<<31
+		case uint64:
+			isEnum = isEnum && v < 1<<31
+		}
+	}
+
+	consts := []string{fmt.Sprintf("/* Fixed values of %s.%s */", c.name, f.name)}
+	if isEnum {
+		tag := unique(c.name+"_"+f.name, cw.tags)
+		f.comment = append(f.comment, "enum "+tag)
+		consts = append(consts, fmt.Sprintf("enum %s {", tag))
+		for _, v := range n.Values() {
+			name := unique(prefix+strings.ToUpper(snakeCase(v.name)), cw.idents)
+			consts = append(consts, fmt.Sprintf("\t%s = %v,", name, v.value))
+		}
+		return strings.Join(append(consts, "};"), "\n")
+	}
+
+	for _, v := range n.Values() {
+		name := unique(prefix+strings.ToUpper(snakeCase(v.name)), cw.idents)
+		if i, ok := v.value.(uint64); ok {
+			consts = append(consts, fmt.Sprintf("#define %s UINT64_C(%#x)", name, i))
+		} else {
+			consts = append(consts, fmt.Sprintf("#define %s INT64_C(%v)", name, v.value))
+		}
+	}
+	return strings.Join(consts, "\n")
+}
+
+// stringDefines returns #defines for the fixed values of a string.
+func (cw *cHeaderWriter) stringDefines(c *cStruct, f *cField, values []*FixedStringValue) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	prefix := strings.ToUpper(c.name + "_" + f.name + "_")
+	consts := []string{fmt.Sprintf("/* Fixed values of %s.%s */", c.name, f.name)}
+	for _, v := range values {
+		name := unique(prefix+strings.ToUpper(snakeCase(v.name)), cw.idents)
+		consts = append(consts, fmt.Sprintf("#define %s %s", name, cString([]byte(v.value))))
+	}
+	return []string{strings.Join(consts, "\n")}
+}
+
+// binaryDefines returns #defines for the fixed values of a binary.
+func (cw *cHeaderWriter) binaryDefines(c *cStruct, f *cField, values []*FixedBinaryValue) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	prefix := strings.ToUpper(c.name + "_" + f.name + "_")
+	consts := []string{fmt.Sprintf("/* Fixed values of %s.%s */", c.name, f.name)}
+	for _, v := range values {
+		name := unique(prefix+strings.ToUpper(snakeCase(v.name)), cw.idents)
+		consts = append(consts, fmt.Sprintf("#define %s %s", name, cString(v.value)))
+	}
+	return []string{strings.Join(consts, "\n")}
+}
+
+// cString returns b as a quoted C string. Octal escapes are used, as unlike hex escapes,
+// they can't run into the following character.
+func cString(b []byte) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for _, c := range b {
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c >= 0x20 && c < 0x7f && c != '?': // '?' could form a trigraph
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "\\%03o", c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
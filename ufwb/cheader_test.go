@@ -0,0 +1,164 @@
+package ufwb
+
+import (
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+const cHeaderTestGrammar = `<ufwb>
+<grammar name="Test Header" start="id:1">
+	<description>A test grammar</description>
+	<structure name="Header" id="1" endian="big">
+		<binary name="Magic" id="2" length="4">
+			<fixedvalue name="magic" value="89504E47"/>
+		</binary>
+		<number name="Version" id="3" type="integer" length="2" signed="no">
+			<fixedvalue name="V1" value="1"/>
+			<fixedvalue name="V2" value="2"/>
+		</number>
+		<number name="Flags" id="4" type="integer" length="1" signed="no">
+			<mask name="Compressed" value="0x01"/>
+			<mask name="Level" value="0x06"/>
+		</number>
+		<number name="Offset" id="5" type="integer" length="3" endian="little"/>
+		<string name="Name" id="6" type="fixed-length" length="8"/>
+		<structure name="Point" id="7" repeatmin="2" repeatmax="2" length="10">
+			<description>A point on the plane</description>
+			<number name="X" id="8" type="integer" length="4"/>
+			<number name="Y" id="9" type="float" length="4"/>
+		</structure>
+		<structref name="Default" id="10" structure="id:11"/>
+	</structure>
+	<structure name="Trailer" id="11">
+		<number name="Checksum" id="12" type="integer" length="8" signed="no">
+			<fixedvalue name="Big" value="0xFFFFFFFFFFFFFFFF"/>
+		</number>
+		<string name="Tag" id="13" type="fixed-length" length="4">
+			<fixedvalue name="end" value="END?"/>
+		</string>
+	</structure>
+	<structure name="Entry" id="14">
+		<number name="Size" id="15" type="integer" length="4"/>
+		<binary name="Data" id="16" length="prev.Size"/>
+	</structure>
+	<structure name="List" id="17">
+		<structref name="Entry" id="18" structure="id:14" repeatmax="3"/>
+	</structure>
+	<structure name="Bits" id="19">
+		<number name="Low" id="20" type="integer" length="3" lengthunit="bit"/>
+	</structure>
+	<structure name="Empty" id="21"/>
+</grammar>
+</ufwb>`
+
+func TestWriteCHeader(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(cHeaderTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	issues, err := WriteCHeader(&buf, u)
+	if err != nil {
+		t.Fatalf("WriteCHeader(...) = %q want nil error", err)
+	}
+
+	want := `/*
+ * C structures for the Test Header grammar, generated by dsector.
+ *
+ * A test grammar
+ *
+ * Only structures with a static size and layout are included. Fields are in the
+ * byte order of the file, as noted on each multi-byte field.
+ */
+#ifndef TEST_HEADER_H
+#define TEST_HEADER_H
+
+#include <stdint.h>
+
+#pragma pack(push, 1)
+
+/* Point structure, 10 bytes.
+ * A point on the plane
+ */
+struct point {
+	int32_t x; /* big endian */
+	float y; /* big endian */
+	uint8_t padding[2]; /* unused */
+};
+
+/* Fixed values of trailer.checksum */
+#define TRAILER_CHECKSUM_BIG UINT64_C(0xffffffffffffffff)
+
+/* Fixed values of trailer.tag */
+#define TRAILER_TAG_END "END\077"
+
+/* Trailer structure, 12 bytes. */
+struct trailer {
+	uint64_t checksum; /* little endian */
+	char tag[4];
+};
+
+/* Fixed values of header.magic */
+#define HEADER_MAGIC_MAGIC "\211PNG"
+
+/* Fixed values of header.version */
+enum header_version {
+	HEADER_VERSION_V1 = 1,
+	HEADER_VERSION_V2 = 2,
+};
+
+/* Masks of header.flags */
+#define HEADER_FLAGS_COMPRESSED 0x1
+#define HEADER_FLAGS_LEVEL 0x6
+
+/* Header structure, 50 bytes. */
+struct header {
+	uint8_t magic[4];
+	uint16_t version; /* big endian, enum header_version */
+	uint8_t flags;
+	uint8_t offset[3]; /* 24 bit signed integer, little endian */
+	char name[8];
+	struct point point[2];
+	struct trailer default_;
+};
+
+#pragma pack(pop)
+
+#endif /* TEST_HEADER_H */
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCHeader(...) =\n%s\nwant:\n%s", got, want)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Error())
+	}
+	wantIssues := []string{
+		`33:2: error: <*ufwb.Structure id=14 name="Entry">: structure has no static layout, omitting it: "Data" has length "prev.Size"`,
+		`37:2: error: <*ufwb.Structure id=17 name="List">: structure has no static layout, omitting it: "Entry" has no static layout`,
+		`40:2: error: <*ufwb.Structure id=19 name="Bits">: structure has no static layout, omitting it: "Low" has length of 3 bits`,
+		`43:2: error: <*ufwb.Structure id=21 name="Empty">: structure has no static layout, omitting it: it has no elements`,
+	}
+	if diff := pretty.Compare(got, wantIssues); diff != "" {
+		t.Errorf("WriteCHeader(...) issues = -got +want:\n%s", diff)
+	}
+}
+
+func TestCString(t *testing.T) {
+	tests := map[string]string{
+		"abc":        `"abc"`,
+		"\x89PNG":    `"\211PNG"`,
+		`a"b\c`:      `"a\"b\\c"`,
+		"??=":        `"\077\077="`,
+		"\x00\xcafe": `"\000\312fe"`,
+	}
+	for s, want := range tests {
+		if got := cString([]byte(s)); got != want {
+			t.Errorf("cString(%q) = %s want %s", s, got, want)
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package ufwb
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"hash/adler32"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+
+	"bramp.net/dsector/input"
+)
+
+// checksums maps the algorithm names usable in a checksum="..." attribute to their hash.
+var checksums = map[string]func() hash.Hash{
+	"adler32":     func() hash.Hash { return adler32.New() },
+	"crc16":       func() hash.Hash { return &crc16{poly: 0xA001, reflected: true} },           // CRC-16/ARC
+	"crc16-ccitt": func() hash.Hash { return &crc16{poly: 0x1021, init: 0xFFFF, crc: 0xFFFF} }, // CRC-16/CCITT-FALSE
+	"crc32":       func() hash.Hash { return crc32.NewIEEE() },
+	"crc32c":      func() hash.Hash { return crc32.New(crc32.MakeTable(crc32.Castagnoli)) },
+	"md5":         md5.New,
+	"sha1":        sha1.New,
+	"sha256":      sha256.New,
+	"sha512":      sha512.New,
+}
+
+// Checksums returns a sorted list of the supported checksum algorithms.
+func Checksums() []string {
+	var names []string
+	for name := range checksums {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Checksum is the result of verifying a Number or Binary with a checksum attribute, for example:
+//
+//	<number name="CRC" type="integer" length="4" checksum="crc32" checksumof="Type,Data"/>
+//
+// checksumof is a comma separated list of sibling names, and the checksum is computed from the
+// start of the first to the end of the last. If checksumof is missing, the checksum covers all
+// the preceding siblings.
+type Checksum struct {
+	Algorithm string
+	Offset    int64 // Start of the checksummed bytes
+	Len       int64 // Length of the checksummed bytes
+
+	Sum   []byte // The computed checksum
+	Valid bool   // True if the value matches the computed checksum
+
+	want []byte // The bytes the value should contain
+}
+
+func (c *Checksum) String() string {
+	return fmt.Sprintf("%s %x", c.Algorithm, c.Sum)
+}
+
+// badChecksum returns a short description of value's checksum if it's wrong, otherwise "".
+func badChecksum(value *Value) string {
+	if value.Checksum == nil || value.Checksum.Valid {
+		return ""
+	}
+	return fmt.Sprintf("bad %s, want %x", value.Checksum.Algorithm, value.Checksum.Sum)
+}
+
+// checksummer is implemented by the elements that may have a checksum attribute.
+type checksummer interface {
+	Checksum() string
+	ChecksumOf() string
+}
+
+// VerifyChecksums computes every checksum in the value tree, setting each Value's Checksum.
+// A error is returned if a checksum could not be computed, not if the checksum is wrong.
+func VerifyChecksums(file io.ReaderAt, root *Value) error {
+	return walkChecksums(file, root, func(*Value) error { return nil })
+}
+
+// walkChecksums computes each checksum in the tree in order, calling fn after each one.
+func walkChecksums(file io.ReaderAt, value *Value, fn func(*Value) error) error {
+	for i, child := range value.Children {
+		if err := walkChecksums(file, child, fn); err != nil {
+			return err
+		}
+
+		if c, ok := child.Element.(checksummer); ok && c.Checksum() != "" {
+			sum, err := computeChecksum(file, value, i)
+			if err != nil {
+				return err
+			}
+			child.Checksum = sum
+			if err := fn(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// computeChecksum returns the Checksum for the i'th child of parent.
+func computeChecksum(file io.ReaderAt, parent *Value, i int) (*Checksum, error) {
+	value := parent.Children[i]
+	c := value.Element.(checksummer)
+
+	newHash, found := checksums[c.Checksum()]
+	if !found {
+		return nil, &validationError{e: value.Element, err: fmt.Errorf("unknown checksum %q", c.Checksum())}
+	}
+
+	start, end := parent.Offset, value.Offset
+	if c.ChecksumOf() != "" {
+		start, end = -1, -1
+		for _, name := range strings.Split(c.ChecksumOf(), ",") {
+			sibling := checksumSibling(parent, i, strings.TrimSpace(name))
+			if sibling == nil {
+				return nil, &validationError{e: value.Element, err: fmt.Errorf("no sibling named %q to checksum", name)}
+			}
+			if start < 0 || sibling.Offset < start {
+				start = sibling.Offset
+			}
+			if end < 0 || sibling.Offset+sibling.Len > end {
+				end = sibling.Offset + sibling.Len
+			}
+		}
+		if start < value.Offset+value.Len && value.Offset < end {
+			return nil, &validationError{e: value.Element, err: fmt.Errorf("checksum can not cover itself")}
+		}
+	}
+
+	h := newHash()
+	if _, err := io.Copy(h, io.NewSectionReader(file, start, end-start)); err != nil {
+		return nil, err
+	}
+
+	sum := &Checksum{
+		Algorithm: c.Checksum(),
+		Offset:    start,
+		Len:       end - start,
+		Sum:       h.Sum(nil),
+	}
+
+	switch elem := value.Element.(type) {
+	case *Number:
+		if len(sum.Sum) > 8 {
+			return nil, &validationError{e: elem, err: fmt.Errorf("%s is too large for a Number", sum.Algorithm)}
+		}
+		var u uint64
+		for _, b := range sum.Sum {
+			u = u<<8 | uint64(b)
+		}
+
+		order := value.ByteOrder
+		if order == nil {
+			order = binary.BigEndian
+		}
+		want, err := encodeInt(u, value.Len, false, order)
+		if err != nil {
+			return nil, &validationError{e: elem, err: err}
+		}
+		sum.want = want
+
+	default:
+		if int64(len(sum.Sum)) != value.Len {
+			return nil, &validationError{e: value.Element, err: fmt.Errorf("%s is %d bytes want %d", sum.Algorithm, len(sum.Sum), value.Len)}
+		}
+		sum.want = sum.Sum
+	}
+
+	b := make([]byte, value.Len)
+	if _, err := input.ReadFullAt(file, b, value.Offset); err != nil {
+		return nil, err
+	}
+	sum.Valid = bytes.Equal(b, sum.want)
+
+	return sum, nil
+}
+
+// checksumSibling returns the sibling named name closest before the i'th child, or if there
+// are none before, the first after.
+func checksumSibling(parent *Value, i int, name string) *Value {
+	for j := i - 1; j >= 0; j-- {
+		if parent.Children[j].Name() == name {
+			return parent.Children[j]
+		}
+	}
+	for _, sibling := range parent.Children[i+1:] {
+		if sibling.Name() == name {
+			return sibling
+		}
+	}
+	return nil
+}
+
+// crc16 implements hash.Hash for the common 16 bit CRCs.
+type crc16 struct {
+	poly      uint16
+	init      uint16
+	reflected bool
+
+	crc uint16
+}
+
+func (c *crc16) Write(p []byte) (int, error) {
+	for _, b := range p {
+		if c.reflected {
+			c.crc ^= uint16(b)
+			for i := 0; i < 8; i++ {
+				if c.crc&1 != 0 {
+					c.crc = c.crc>>1 ^ c.poly
+				} else {
+					c.crc >>= 1
+				}
+			}
+		} else {
+			c.crc ^= uint16(b) << 8
+			for i := 0; i < 8; i++ {
+				if c.crc&0x8000 != 0 {
+					c.crc = c.crc<<1 ^ c.poly
+				} else {
+					c.crc <<= 1
+				}
+			}
+		}
+	}
+	return len(p), nil
+}
+
+func (c *crc16) Sum(b []byte) []byte {
+	return append(b, byte(c.crc>>8), byte(c.crc))
+}
+
+func (c *crc16) Reset()         { c.crc = c.init }
+func (c *crc16) Size() int      { return 2 }
+func (c *crc16) BlockSize() int { return 1 }
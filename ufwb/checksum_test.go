@@ -0,0 +1,173 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"strings"
+	"testing"
+)
+
+const checksumTestGrammar = testHeader +
+	`<structure name="File" id="99" endian="big" signed="no">
+		<structure name="Chunk" id="1" repeatmax="unlimited">
+			<number name="Length" id="2" type="integer" length="4"/>
+			<string name="Type" id="3" type="fixed-length" length="4"/>
+			<binary name="Data" id="4" length="prev.Length"/>
+			<number name="CRC" id="5" type="integer" length="4" display="hex" checksum="crc32" checksumof="Type,Data"/>
+		</structure>
+	</structure>` + testFooter
+
+// chunk returns a PNG style chunk, with a valid CRC.
+func chunk(typ, data string) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, uint32(len(data)))
+	crc := make([]byte, 4)
+	binary.BigEndian.PutUint32(crc, crc32.ChecksumIEEE([]byte(typ+data)))
+	return string(b) + typ + data + string(crc)
+}
+
+func TestChecksums(t *testing.T) {
+	tests := []struct {
+		algorithm string
+		want      string
+	}{
+		// The standard check values
+		{"adler32", "091e01de"},
+		{"crc16", "bb3d"},
+		{"crc16-ccitt", "29b1"},
+		{"crc32", "cbf43926"},
+		{"crc32c", "e3069283"},
+		{"md5", "25f9e794323b453885f5181f1b624d0b"},
+		{"sha1", "f7c3bc1d808e04732adf679965ccc34ca7ae3441"},
+	}
+
+	for _, test := range tests {
+		h := checksums[test.algorithm]()
+		h.Write([]byte("123456789"))
+		if got := fmt.Sprintf("%x", h.Sum(nil)); got != test.want {
+			t.Errorf("%s(123456789) = %s want %s", test.algorithm, got, test.want)
+		}
+	}
+}
+
+func TestChecksumVerify(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(checksumTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+	crc, _ := grammar.Get("id:5")
+
+	data := []byte(chunk("IHDR", "ab") + chunk("IDAT", "cde"))
+	data[len(data)-1] ^= 0xFF // Break the second CRC
+
+	value, err := NewDecoder(grammar, input.FromBytes(data)).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	chunks := value.Children[0].Children
+	if len(chunks) != 2 {
+		t.Fatalf("len(chunks) = %d want 2", len(chunks))
+	}
+	for i, want := range []bool{true, false} {
+		v, found := chunks[i].find(crc)
+		if !found || v.Checksum == nil {
+			t.Fatalf("chunk[%d] CRC checksum not found", i)
+		}
+		if v.Checksum.Valid != want {
+			t.Errorf("chunk[%d] CRC Checksum.Valid = %t want %t", i, v.Checksum.Valid, want)
+		}
+		if v.Checksum.Offset != chunks[i].Offset+4 || v.Checksum.Len != v.Offset-chunks[i].Offset-4 {
+			t.Errorf("chunk[%d] CRC Checksum = [0x%x len:%d] want Type and Data", i, v.Checksum.Offset, v.Checksum.Len)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := FormatTo(&buf, input.FromBytes(data), value); err != nil {
+		t.Fatalf("FormatTo(...) error = %q want nil error", err)
+	}
+	if got := strings.Count(buf.String(), "[bad crc32, want "); got != 1 {
+		t.Errorf("FormatTo(...) contains %d bad checksums want 1:\n%s", got, buf.String())
+	}
+
+	j, err := NewJsonValue(input.FromBytes(data), value)
+	if err != nil {
+		t.Fatalf("NewJsonValue(...) error = %q want nil error", err)
+	}
+	if c := j.Children[0].Children[1].Children[3].Checksum; c == nil || c.Valid || c.Algorithm != "crc32" {
+		t.Errorf("NewJsonValue(...) CRC checksum = %+v want a invalid crc32", c)
+	}
+
+	// Editing fixes the checksums
+	editor, err := NewEditor(input.FromBytes(data), value)
+	if err != nil {
+		t.Fatalf("NewEditor(...) error = %q want nil error", err)
+	}
+	elem, _ := grammar.Get("id:4")
+	data0, _ := chunks[0].find(elem)
+	if err := editor.Set(data0, "0x78797a"); err != nil {
+		t.Fatalf("editor.Set(Data) error = %q want nil error", err)
+	}
+
+	want := []byte(chunk("IHDR", "xyz") + chunk("IDAT", "cde"))
+	if got := editor.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("editor.Bytes() = %q want %q", got, want)
+	}
+}
+
+func TestChecksumEncode(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(checksumTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	root := &JsonValue{Name: "File", Children: []*JsonValue{
+		{Name: "Chunk", Children: []*JsonValue{
+			{Name: "Type", Formatted: "IEND"},
+			{Name: "Data", Raw: "0102"},
+		}},
+	}}
+
+	got, _, err := NewEncoder(grammar).Encode(root)
+	if err != nil {
+		t.Fatalf("encoder.Encode(...) error = %q want nil error", err)
+	}
+	if want := []byte(chunk("IEND", "\x01\x02")); !bytes.Equal(got, want) {
+		t.Errorf("encoder.Encode(...) = %q want %q", got, want)
+	}
+}
+
+func TestChecksumErrors(t *testing.T) {
+	tests := []struct {
+		attrs string
+		want  string
+	}{
+		{`checksum="crc99"`, "unknown checksum"},
+		{`checksum="crc32" checksumof="Missing"`, "no sibling"},
+		{`checksum="crc32" checksumof="Data,After"`, "cover itself"},
+		{`checksum="sha256"`, "too large"},
+	}
+
+	for _, test := range tests {
+		xml := testHeader + `<structure name="File" id="99">
+			<binary name="Data" id="1" length="2"/>
+			<number name="CRC" id="2" type="integer" length="4" ` + test.attrs + `/>
+			<binary name="After" id="3" length="1"/>
+		</structure>` + testFooter
+
+		grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+		var err error
+		if len(errs) > 0 {
+			err = errs[0]
+		} else {
+			_, err = NewDecoder(grammar, input.FromBytes([]byte("abcdefg"))).Decode()
+		}
+
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s Decode() error = %v want %q", test.attrs, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package ufwb
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"bramp.net/dsector/input"
+)
+
+// GapKind describes why a range of bytes was not explained by the grammar.
+type GapKind string
+
+const (
+	GapUnclaimed GapKind = "unclaimed" // Not covered by any element
+	GapPadding   GapKind = "padding"   // Covered by Padding, inserted when a structure was larger than its children
+	GapTrailing  GapKind = "trailing"  // After the last decoded value
+)
+
+// Gap is a range of bytes not claimed by any leaf element.
+type Gap struct {
+	Kind   GapKind `json:"kind"`
+	Offset int64   `json:"offset"`
+	Len    int64   `json:"length"`
+
+	// Parent is the path of the inner most value containing the gap, or "" if none does.
+	Parent string `json:"parent,omitempty"`
+}
+
+// Coverage describes how much of a file was explained by the decoded values.
+type Coverage struct {
+	Path    string `json:"path,omitempty"` // Of the transformed Binary, or "" for the file
+	Size    int64  `json:"size"`           // Of the file
+	Covered int64  `json:"covered"`        // Bytes claimed by a leaf element
+	Gaps    []Gap  `json:"gaps,omitempty"`
+
+	// Transformed is the coverage of the bytes of each transformed Binary that was decoded
+	// with a structure. Offsets are within the transformed bytes.
+	Transformed []*Coverage `json:"transformed,omitempty"`
+
+	file io.ReaderAt // The transformed bytes, or nil for the file
+}
+
+// Percent returns the percentage of the file covered.
+func (c *Coverage) Percent() float64 {
+	if c.Size == 0 {
+		return 100
+	}
+	return 100 * float64(c.Covered) / float64(c.Size)
+}
+
+// NewCoverage returns the byte ranges of a file of the given size, that are not explained by
+// a leaf element in the value tree.
+func NewCoverage(size int64, value *Value) *Coverage {
+	return newCoverage(size, value, NewIndex(value), "")
+}
+
+// newCoverage returns the coverage of value, prefixing each gap's parent with prefix.
+func newCoverage(size int64, value *Value, idx *Index, prefix string) *Coverage {
+	var leaves, padding []*Value
+	leafValues(value, &leaves, &padding)
+
+	// Leaves are normally in order, but Offset elements can move around.
+	sort.SliceStable(leaves, func(i, j int) bool {
+		return leaves[i].Offset < leaves[j].Offset
+	})
+	sort.SliceStable(padding, func(i, j int) bool {
+		return padding[i].Offset < padding[j].Offset
+	})
+
+	c := &Coverage{Size: size}
+
+	next := 0 // Index of the first padding that may overlap the next gap
+	addGap := func(kind GapKind, start, end int64) {
+		if end > size {
+			end = size
+		}
+		if start >= end {
+			return
+		}
+
+		// Padding Values are gaps too, so split any overlapping range. Gaps are added in
+		// increasing order, so padding ending before this gap will never be needed again.
+		for ; next < len(padding) && padding[next].Offset < end; next++ {
+			p := padding[next]
+			pend := p.Offset + p.Len
+			if pend <= start {
+				continue
+			}
+			if start < p.Offset {
+				c.Gaps = append(c.Gaps, newGap(idx, prefix, kind, start, p.Offset))
+			}
+			c.Gaps = append(c.Gaps, newGap(idx, prefix, GapPadding, max64(start, p.Offset), min64(end, pend)))
+			if pend > end {
+				// The padding continues into the next gap.
+				return
+			}
+			start = pend
+		}
+		if start < end {
+			c.Gaps = append(c.Gaps, newGap(idx, prefix, kind, start, end))
+		}
+	}
+
+	pos := int64(0)
+	for _, leaf := range leaves {
+		if leaf.Offset > pos {
+			addGap(GapUnclaimed, pos, leaf.Offset)
+		}
+		if end := leaf.Offset + leaf.Len; end > pos {
+			c.Covered += min64(end, size) - max64(leaf.Offset, pos)
+			pos = end
+		}
+	}
+	addGap(GapTrailing, pos, size)
+
+	sort.SliceStable(c.Gaps, func(i, j int) bool {
+		return c.Gaps[i].Offset < c.Gaps[j].Offset
+	})
+
+	for _, leaf := range leaves {
+		t, tidx := leaf.Transformed(), idx.Transformed(leaf)
+		if t == nil || len(t.Value.Children) == 0 {
+			continue
+		}
+		path := joinPath(prefix, PathOf(idx.Range(leaf.Offset, leaf.Len)))
+		sub := newCoverage(int64(len(t.Data)), t.Value, tidx, joinPath(path, escapePath(t.Value.Name())))
+		sub.Path = path
+		sub.file = t.Input()
+		c.Transformed = append(c.Transformed, sub)
+	}
+	return c
+}
+
+func newGap(idx *Index, prefix string, kind GapKind, start, end int64) Gap {
+	gap := Gap{
+		Kind:   kind,
+		Offset: start,
+		Len:    end - start,
+	}
+	if kind != GapTrailing {
+		chain := idx.Range(start, end-start)
+		if n := len(chain); n > 0 {
+			// Padding isn't part of the grammar, so report the structure it pads.
+			if _, ok := chain[n-1].Element.(*Padding); ok {
+				chain = chain[:n-1]
+			}
+		}
+		gap.Parent = joinPath(prefix, PathOf(chain))
+	}
+	return gap
+}
+
+// leafValues appends all the non-empty leaf values to leaves, and Padding values to padding.
+func leafValues(value *Value, leaves, padding *[]*Value) {
+	if len(value.Children) == 0 {
+		if value.Len == 0 {
+			return
+		}
+		if _, ok := value.Element.(*Padding); ok {
+			*padding = append(*padding, value)
+		} else {
+			*leaves = append(*leaves, value)
+		}
+		return
+	}
+
+	for _, child := range value.Children {
+		leafValues(child, leaves, padding)
+	}
+}
+
+func min64(a, b int64) int64 {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func max64(a, b int64) int64 {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// WriteCoverage writes a report of the coverage, including a hexdump preview of up to preview
+// bytes from each gap, followed by the coverage of any transformed Binaries.
+func WriteCoverage(w io.Writer, file io.ReaderAt, c *Coverage, preview int64) error {
+	if c.Path != "" {
+		if _, err := fmt.Fprintf(w, "\nTransformed %s: ", c.Path); err != nil {
+			return err
+		}
+	}
+	_, err := fmt.Fprintf(w, "Covered %d of %d bytes (%.2f%%), %d gaps\n", c.Covered, c.Size, c.Percent(), len(c.Gaps))
+	if err != nil {
+		return err
+	}
+
+	for _, gap := range c.Gaps {
+		percent := 100 * float64(gap.Len) / float64(c.Size)
+		parent := ""
+		if gap.Parent != "" {
+			parent = " in " + gap.Parent
+		}
+		if _, err := fmt.Fprintf(w, "\n0x%08x-0x%08x %d bytes (%.2f%%) %s%s\n", gap.Offset, gap.Offset+gap.Len, gap.Len, percent, gap.Kind, parent); err != nil {
+			return err
+		}
+
+		n := min64(gap.Len, preview)
+		if n <= 0 {
+			continue
+		}
+
+		b := make([]byte, n)
+		if _, err := input.ReadFullAt(file, b, gap.Offset); err != nil {
+			return err
+		}
+
+		for i := int64(0); i < n; i += hexDumpWidth {
+			line := b[i:min64(i+hexDumpWidth, n)]
+
+			hex := make([]byte, 0, 3*hexDumpWidth)
+			ascii := make([]byte, 0, hexDumpWidth)
+			for _, c := range line {
+				hex = append(hex, fmt.Sprintf(" %02x", c)...)
+				ascii = append(ascii, printable(c))
+			}
+			if _, err := fmt.Fprintf(w, "  %08x %-48s  |%s|\n", gap.Offset+i, hex, ascii); err != nil {
+				return err
+			}
+		}
+		if n < gap.Len {
+			if _, err := fmt.Fprintf(w, "  ...\n"); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, sub := range c.Transformed {
+		if err := WriteCoverage(w, sub.file, sub, preview); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,98 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestCoverage(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<number name="Length" id="1" type="integer" length="1"/>
+			<binary name="Data" id="2" length="prev.Length"/>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	data := []byte("\x03abc!!!")
+	file := input.FromBytes(data)
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	// Pretend the grammar skipped over "ab"
+	binary, _ := grammar.Get("2")
+	v, _ := value.find(binary)
+	v.Offset, v.Len = 3, 1
+
+	got := NewCoverage(int64(len(data)), value)
+	want := &Coverage{
+		Size:    7,
+		Covered: 2,
+		Gaps: []Gap{
+			{Kind: GapUnclaimed, Offset: 1, Len: 2, Parent: "File"},
+			{Kind: GapTrailing, Offset: 4, Len: 3},
+		},
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("NewCoverage(...) = -got +want:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteCoverage(&buf, file, got, 2); err != nil {
+		t.Fatalf("WriteCoverage(...) error = %q want nil error", err)
+	}
+	for _, want := range []string{
+		"Covered 2 of 7 bytes (28.57%), 2 gaps",
+		"0x00000001-0x00000003 2 bytes (28.57%) unclaimed in File",
+		"0x00000004-0x00000007 3 bytes (42.86%) trailing",
+		"  00000004  21 21",
+		"  ...",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WriteCoverage(...) = %q does not contain %q", buf.String(), want)
+		}
+	}
+}
+
+func TestCoveragePadding(t *testing.T) {
+	header := &Value{
+		Offset:  0,
+		Len:     6,
+		Element: &Structure{Base: Base{elemType: "Structure", id: 2, name: "Header"}},
+		Children: []*Value{
+			{Offset: 0, Len: 2, Element: &Number{Base: Base{elemType: "Number", id: 3, name: "A"}}},
+			{Offset: 2, Len: 2, Element: padElement},
+		},
+	}
+	value := &Value{
+		Offset:  0,
+		Len:     8,
+		Element: &Structure{Base: Base{elemType: "Structure", id: 1, name: "Root"}},
+		Children: []*Value{
+			header,
+			{Offset: 6, Len: 2, Element: padElement},
+		},
+	}
+
+	got := NewCoverage(8, value)
+	want := &Coverage{
+		Size:    8,
+		Covered: 2,
+		Gaps: []Gap{
+			{Kind: GapPadding, Offset: 2, Len: 2, Parent: "Header"},
+			{Kind: GapTrailing, Offset: 4, Len: 2},
+			{Kind: GapPadding, Offset: 6, Len: 2},
+		},
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("NewCoverage(...) = -got +want:\n%s", diff)
+	}
+}
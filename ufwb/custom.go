@@ -0,0 +1,83 @@
+package ufwb
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+)
+
+// CustomType is a Element implemented in Go, which can be referenced by a grammar's
+// <custom type="name"/> element. This allows decoders for types that can't be easily
+// described by a grammar, such as varints or proprietary compression.
+//
+// The Reader must leave the file at Value.Offset + Value.Len. The returned Value's Element is
+// replaced with the Custom element that referenced this type.
+//
+// A CustomType may optionally implement Writer, to allow the Value to be written back out.
+type CustomType interface {
+	Reader
+	Formatter
+}
+
+// errCustomScript is returned when decoding a Custom element implemented by a script.
+var errCustomScript = errors.New("custom scripts are not supported")
+
+var (
+	customTypesMu sync.RWMutex
+	customTypes   = make(map[string]CustomType)
+)
+
+// RegisterCustom makes a CustomType available to grammars by the provided name.
+// If RegisterCustom is called twice with the same name, or if c is nil, it panics.
+func RegisterCustom(name string, c CustomType) {
+	customTypesMu.Lock()
+	defer customTypesMu.Unlock()
+
+	if c == nil {
+		panic("ufwb: RegisterCustom type is nil")
+	}
+	if _, found := customTypes[name]; found {
+		panic(fmt.Sprintf("ufwb: RegisterCustom called twice for type %q", name))
+	}
+	customTypes[name] = c
+}
+
+// LookupCustom returns the CustomType registered with this name.
+func LookupCustom(name string) (CustomType, bool) {
+	customTypesMu.RLock()
+	defer customTypesMu.RUnlock()
+
+	c, found := customTypes[name]
+	return c, found
+}
+
+// CustomTypes returns a sorted list of the names of the registered CustomTypes.
+func CustomTypes() []string {
+	customTypesMu.RLock()
+	defer customTypesMu.RUnlock()
+
+	var names []string
+	for name := range customTypes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// customName returns the name c was registered with.
+func customName(c CustomType) (string, bool) {
+	customTypesMu.RLock()
+	defer customTypesMu.RUnlock()
+
+	if !reflect.TypeOf(c).Comparable() {
+		return "", false
+	}
+	for name, t := range customTypes {
+		if reflect.TypeOf(t).Comparable() && t == c {
+			return name, true
+		}
+	}
+	return "", false
+}
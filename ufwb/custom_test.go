@@ -0,0 +1,129 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"encoding/binary"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// testVarint is a CustomType that reads a unsigned LEB128 varint.
+type testVarint struct{}
+
+func (testVarint) Read(d *Decoder) (*Value, error) {
+	f := d.Input()
+	start, err := f.Tell()
+	if err != nil {
+		return nil, err
+	}
+
+	max := d.ParentBounds().End - start
+	if max <= 0 {
+		return nil, io.EOF
+	}
+
+	for n := int64(1); n <= max; n++ {
+		b, err := f.ReadByte()
+		if err != nil {
+			return nil, err
+		}
+		if b&0x80 == 0 {
+			return &Value{Offset: start, Len: n}, nil
+		}
+	}
+	return nil, io.ErrUnexpectedEOF
+}
+
+func (testVarint) Format(file io.ReaderAt, value *Value) (string, error) {
+	b := make([]byte, value.Len)
+	if _, err := input.ReadFullAt(file, b, value.Offset); err != nil {
+		return "", err
+	}
+	i, _ := binary.Uvarint(b)
+	return strconv.FormatUint(i, 10), nil
+}
+
+func init() {
+	RegisterCustom("test-varint", testVarint{})
+}
+
+func TestCustomType(t *testing.T) {
+	xml := testStructHeader +
+		`<custom name="size" id="1" type="test-varint"/>
+		 <number name="after" id="2" type="integer" length="1"/>` +
+		testStructFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	custom, _ := grammar.Get("1")
+
+	file := input.FromBytes([]byte{0xac, 0x02, 0x07})
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	if err := value.validiate(); err != nil {
+		t.Fatalf("value.validiate() = %q want nil error", err)
+	}
+
+	v, found := value.find(custom)
+	if !found {
+		t.Fatalf("no Custom value decoded")
+	}
+
+	if v.Offset != 0 || v.Len != 2 {
+		t.Errorf("v{Offset: %d, Len: %d} want {Offset: 0, Len: 2}", v.Offset, v.Len)
+	}
+
+	got, err := v.Format(file)
+	if err != nil {
+		t.Errorf("v.Format(...) error = %q want nil error", err)
+	}
+	if want := "300"; got != want {
+		t.Errorf("v.Format(...) = %q want %q", got, want)
+	}
+}
+
+func TestCustomTypeNotRegistered(t *testing.T) {
+	xml := testStructHeader + `<custom name="size" id="1" type="unknown-type"/>` + testStructFooter
+
+	_, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) == 0 {
+		t.Errorf("ParseXmlGrammar(...) = nil want error")
+	}
+}
+
+func TestCustomScript(t *testing.T) {
+	xml := testHeader +
+		`<structure id="99">
+			<custom name="size" id="1" script="50"/>
+		</structure>
+		<scripts>
+			<script id="50" name="size" type="DataType">
+				<source language="Lua">-- Some code</source>
+			</script>
+		</scripts>` +
+		testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte{0x01})
+	_, err := NewDecoder(grammar, file).Decode()
+	if err == nil || !strings.Contains(err.Error(), errCustomScript.Error()) {
+		t.Errorf("decoder.Decode() error = %v want %q", err, errCustomScript)
+	}
+
+	custom, _ := grammar.Get("1")
+	if _, err := custom.Format(file, &Value{Element: custom, Len: 1}); err == nil {
+		t.Errorf("custom.Format(...) = nil want error")
+	}
+}
@@ -59,6 +59,9 @@ type Decoder struct {
 
 	// debugFunc hooks a "debug(...)" function into the script env
 	debugFunc func(interface{})
+
+	// depth is the number of transforms this decoder is nested within.
+	depth int
 }
 
 func getBounds(f input.Input) (int64, int64, error) {
@@ -108,6 +111,11 @@ func NewDecoderWithBounds(u *Ufwb, f input.Input, start, end int64) *Decoder {
 // Decode decodes the input using the given grammar, returning a Value for as much as could be parsed
 // as well as the first error encountered
 func (d *Decoder) Decode() (*Value, error) {
+	return d.decode(d.u.Grammar)
+}
+
+// decode decodes the input as the element.
+func (d *Decoder) decode(e Element) (*Value, error) {
 
 	if d.err != nil {
 		return nil, d.err
@@ -123,7 +131,7 @@ func (d *Decoder) Decode() (*Value, error) {
 	}
 
 	d.values = nil
-	v, err := d.u.Read(d)
+	v, err := d.read(e)
 
 	assert(len(d.stack) == 1, "Stack left in unclean state")
 
@@ -131,9 +139,20 @@ func (d *Decoder) Decode() (*Value, error) {
 		err = nil
 	}
 
+	if v != nil {
+		if cerr := VerifyChecksums(d.f, v); err == nil {
+			err = cerr
+		}
+	}
+
 	return v, err
 }
 
+// Input returns the input being decoded. This is mostly useful to a CustomType's Reader.
+func (d *Decoder) Input() input.Input {
+	return d.f
+}
+
 func (d *Decoder) ParentBounds() *ElementBounds {
 	if len(d.stack) > 0 {
 		return &d.stack[len(d.stack)-1]
@@ -0,0 +1,342 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"bramp.net/dsector/input"
+)
+
+// DefaultTrials is the number of candidates a Detector confirms with a trial decode.
+const DefaultTrials = 3
+
+// Scores given to each kind of match. Each byte of a matching signature scores one point.
+const (
+	extScore = 4
+	utiScore = 8
+)
+
+// Signature is a sequence of bytes, that every file described by a grammar contains at Offset.
+type Signature struct {
+	Offset int64
+	Bytes  []byte
+}
+
+func (s Signature) String() string {
+	return fmt.Sprintf("%x@%d", s.Bytes, s.Offset)
+}
+
+// Signatures returns the signatures found at the beginning of the grammar's start structure.
+// These are built from the must-match fixed values, such as the PNG eye catcher, that appear
+// at a fixed offset from the start of the file.
+func Signatures(u *Ufwb) []Signature {
+	if u.Grammar == nil || u.Grammar.Start == nil {
+		return nil
+	}
+	var sigs []Signature
+	signatures(u.Grammar.Start, 0, &sigs)
+	return sigs
+}
+
+// signatures appends the signatures found in elem, which starts at offset. It returns the
+// length of the element, and false if the length is not known, in which case no signatures
+// can be found after it.
+func signatures(elem Element, offset int64, sigs *[]Signature) (int64, bool) {
+	if min, ok := elem.RepeatMin().(ConstExpression); !ok || min != 1 {
+		return 0, false
+	}
+	if max, ok := elem.RepeatMax().(ConstExpression); !ok || max != 1 {
+		return 0, false
+	}
+
+	switch elem := elem.(type) {
+	case *StructRef:
+		return signatures(elem.Structure(), offset, sigs)
+
+	case *Structure:
+		if elem.Order() != FixedOrder {
+			return 0, false
+		}
+		start := offset
+		for _, e := range elem.Elements() {
+			n, ok := signatures(e, offset, sigs)
+			if !ok {
+				return 0, false
+			}
+			offset += n
+		}
+		if length, ok := elem.Length().(ConstExpression); ok && elem.LengthUnit() == ByteLengthUnit {
+			return int64(length), true
+		}
+		return offset - start, true
+	}
+
+	length, ok := elem.Length().(ConstExpression)
+	if !ok || elem.LengthUnit() != ByteLengthUnit {
+		return 0, false
+	}
+
+	var b []byte
+	switch elem := elem.(type) {
+	case *Number:
+		if len(elem.Values()) == 1 && elem.MustMatch().bool() && elem.Type == "integer" {
+			var order binary.ByteOrder = binary.BigEndian
+			switch elem.Endian() {
+			case LittleEndian:
+				order = binary.LittleEndian
+			case DynamicEndian:
+				return int64(length), true
+			}
+			b, _ = encodeInt(elem.Values()[0].value, int64(length), elem.Signed(), order)
+		}
+
+	case *Binary:
+		if len(elem.Values()) == 1 && elem.MustMatch().bool() {
+			b = elem.Values()[0].value
+		}
+
+	case *String:
+		if len(elem.Values()) == 1 && elem.MustMatch().bool() && elem.Typ() == "fixed-length" {
+			b, _ = encodeText(elem.Encoding(), elem.Values()[0].value)
+		}
+
+	case *Custom, *Script, *GrammarRef, *Offset:
+		return 0, false
+	}
+
+	if len(b) > 0 && int64(len(b)) == int64(length) {
+		// Join to the previous signature, if they are adjacent
+		if n := len(*sigs); n > 0 && (*sigs)[n-1].Offset+int64(len((*sigs)[n-1].Bytes)) == offset {
+			(*sigs)[n-1].Bytes = append((*sigs)[n-1].Bytes, b...)
+		} else {
+			*sigs = append(*sigs, Signature{Offset: offset, Bytes: b})
+		}
+	}
+
+	return int64(length), true
+}
+
+// detectEntry is a grammar known to the Detector.
+type detectEntry struct {
+	name string
+	u    *Ufwb
+	sigs []Signature
+}
+
+// Detector finds the grammars most likely to decode a file. Grammars are indexed by the
+// signatures at the start of the file, their file extensions, and their UTI.
+type Detector struct {
+	// Trials is the number of top candidates to confirm with a trial decode.
+	Trials int
+
+	// CarveNested makes Carve report files found inside other carved files.
+	CarveNested bool
+
+	entries   []*detectEntry
+	bySig     map[byte][]*detectEntry // Grammars with a signature at offset 0, by the first byte
+	unpinned  []*detectEntry          // Grammars with signatures only at later offsets
+	byFirst   map[byte][]*detectEntry // All grammars with signatures, by the first byte
+	byExt     map[string][]*detectEntry
+	byUti     map[string][]*detectEntry
+	sigLength int64 // Bytes needed to check every signature
+}
+
+// NewDetector returns a empty Detector.
+func NewDetector() *Detector {
+	return &Detector{
+		Trials:  DefaultTrials,
+		bySig:   make(map[byte][]*detectEntry),
+		byFirst: make(map[byte][]*detectEntry),
+		byExt:   make(map[string][]*detectEntry),
+		byUti:   make(map[string][]*detectEntry),
+	}
+}
+
+// Add adds the grammar under the given name.
+func (d *Detector) Add(name string, u *Ufwb) {
+	e := &detectEntry{
+		name: name,
+		u:    u,
+		sigs: Signatures(u),
+	}
+	d.entries = append(d.entries, e)
+
+	if len(e.sigs) > 0 {
+		first := e.sigs[0].Bytes[0]
+		d.byFirst[first] = append(d.byFirst[first], e)
+		if e.sigs[0].Offset == 0 {
+			d.bySig[first] = append(d.bySig[first], e)
+		} else {
+			d.unpinned = append(d.unpinned, e)
+		}
+
+		last := e.sigs[len(e.sigs)-1]
+		if end := last.Offset + int64(len(last.Bytes)); end > d.sigLength {
+			d.sigLength = end
+		}
+	}
+
+	if u.Grammar == nil {
+		return
+	}
+	for _, ext := range u.Grammar.Extensions() {
+		d.byExt[ext] = append(d.byExt[ext], e)
+	}
+	if uti := u.Grammar.Uti; uti != "" {
+		d.byUti[uti] = append(d.byUti[uti], e)
+	}
+}
+
+// Len returns the number of grammars in the Detector.
+func (d *Detector) Len() int {
+	return len(d.entries)
+}
+
+// Extensions returns the lower cased file extensions in the grammar's fileextension attribute,
+// which may be separated by commas or spaces.
+func (g *Grammar) Extensions() []string {
+	var exts []string
+	for _, ext := range strings.FieldsFunc(g.Ext, func(r rune) bool {
+		return r == ',' || r == ' ' || r == ';'
+	}) {
+		exts = append(exts, strings.ToLower(strings.TrimPrefix(ext, ".")))
+	}
+	return exts
+}
+
+// Candidate is a grammar that may decode a file.
+type Candidate struct {
+	Name    string
+	Grammar *Ufwb
+	Score   int      // Higher is a better match
+	Reasons []string // Why this grammar was picked, for example "signature 89504e47@0"
+
+	// Only set on candidates that were trial decoded.
+	Tried     bool
+	Confirmed bool   // True if the trial decode was successful
+	Value     *Value // The result of the trial decode
+	Err       error  // The error from the trial decode
+}
+
+// Detect returns the grammars that may decode f, best first. filename and uti are optional
+// hints, and may be "". The top Trials candidates are decoded, and those that decode without
+// error are moved to the front. The file is read from its current position, which is restored
+// afterwards.
+func (d *Detector) Detect(f input.Input, filename, uti string) ([]*Candidate, error) {
+	start, err := f.Tell()
+	if err != nil {
+		return nil, err
+	}
+
+	header := make([]byte, d.sigLength)
+	n, err := input.ReadFullAt(f, header, start)
+	if err != nil && n == 0 && d.sigLength > 0 {
+		return nil, err
+	}
+	header = header[:n]
+
+	candidates := make(map[*detectEntry]*Candidate)
+	candidate := func(e *detectEntry) *Candidate {
+		c, found := candidates[e]
+		if !found {
+			c = &Candidate{Name: e.name, Grammar: e.u}
+			candidates[e] = c
+		}
+		return c
+	}
+
+	var possible []*detectEntry
+	if len(header) > 0 {
+		possible = append(possible, d.bySig[header[0]]...)
+	}
+	possible = append(possible, d.unpinned...)
+	for _, e := range possible {
+		if score, reasons, ok := matchSignatures(e.sigs, header); ok {
+			c := candidate(e)
+			c.Score += score
+			c.Reasons = append(c.Reasons, reasons...)
+		}
+	}
+
+	if ext := strings.ToLower(strings.TrimPrefix(filepath.Ext(filename), ".")); ext != "" {
+		for _, e := range d.byExt[ext] {
+			// Don't suggest grammars whose signature doesn't match
+			if _, _, ok := matchSignatures(e.sigs, header); !ok && len(e.sigs) > 0 {
+				continue
+			}
+			c := candidate(e)
+			c.Score += extScore
+			c.Reasons = append(c.Reasons, "extension "+ext)
+		}
+	}
+
+	if uti != "" {
+		for _, e := range d.byUti[uti] {
+			c := candidate(e)
+			c.Score += utiScore
+			c.Reasons = append(c.Reasons, "uti "+uti)
+		}
+	}
+
+	var results []*Candidate
+	for _, c := range candidates {
+		results = append(results, c)
+	}
+	sortCandidates(results)
+
+	for i := 0; i < d.Trials && i < len(results); i++ {
+		if _, err := f.Seek(start, io.SeekStart); err != nil {
+			return nil, err
+		}
+		results[i].trial(f)
+	}
+	sortCandidates(results)
+
+	if _, err := f.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// matchSignatures returns the score for the signatures found in header, and false if any
+// don't match.
+func matchSignatures(sigs []Signature, header []byte) (int, []string, bool) {
+	score := 0
+	var reasons []string
+	for _, sig := range sigs {
+		end := sig.Offset + int64(len(sig.Bytes))
+		if end > int64(len(header)) || !bytes.Equal(header[sig.Offset:end], sig.Bytes) {
+			return 0, nil, false
+		}
+		score += len(sig.Bytes)
+		reasons = append(reasons, "signature "+sig.String())
+	}
+	return score, reasons, len(sigs) > 0
+}
+
+// sortCandidates sorts the candidates by confirmed, then score, then name.
+func sortCandidates(candidates []*Candidate) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Confirmed != b.Confirmed {
+			return a.Confirmed
+		}
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		return a.Name < b.Name
+	})
+}
+
+// trial decodes f with the candidate's grammar.
+func (c *Candidate) trial(f input.Input) {
+	c.Tried = true
+	c.Value, c.Err = decodeSafely(NewDecoder(c.Grammar, f))
+	c.Confirmed = c.Err == nil && c.Value != nil
+}
@@ -0,0 +1,139 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+var detectTestGrammars = map[string]string{
+	"magic": `<ufwb><grammar name="Magic" start="99" fileextension="mgc">
+		<structure name="File" id="99" endian="big">
+			<structure name="Header" id="1">
+				<binary name="Magic" id="2" length="4">
+					<fixedvalue name="magic" value="4d41474b"/>
+				</binary>
+				<number name="Version" id="3" type="integer" length="2">
+					<fixedvalue name="v1" value="1"/>
+				</number>
+			</structure>
+			<binary name="Body" id="4" length="4"/>
+		</structure>
+	</grammar></ufwb>`,
+
+	"java": `<ufwb><grammar name="Java" start="99" fileextension="class" uti="com.sun.java-class">
+		<structure name="File" id="99" endian="big" signed="no">
+			<number name="Magic" id="1" type="integer" length="4">
+				<fixedvalue name="magic" value="0xCAFEBABE"/>
+			</number>
+			<number name="Version" id="2" type="integer" length="4"/>
+		</structure>
+	</grammar></ufwb>`,
+
+	"later": `<ufwb><grammar name="Later" start="99">
+		<structure name="File" id="99" endian="little">
+			<number name="Size" id="1" type="integer" length="4"/>
+			<string name="Tag" id="2" type="fixed-length" length="4">
+				<fixedvalue name="tag" value="RIFF"/>
+			</string>
+		</structure>
+	</grammar></ufwb>`,
+
+	"text": `<ufwb><grammar name="Text" start="99" fileextension="txt, text">
+		<structure name="File" id="99">
+			<string name="Line" id="1" type="zero-terminated" repeatmax="unlimited"/>
+		</structure>
+	</grammar></ufwb>`,
+}
+
+func newTestDetector(t *testing.T) *Detector {
+	d := NewDetector()
+	for _, name := range []string{"java", "later", "magic", "text"} {
+		g, errs := ParseXmlGrammar(strings.NewReader(detectTestGrammars[name]))
+		if len(errs) > 0 {
+			t.Fatalf("ParseXmlGrammar(%s) = %q want nil error", name, errs)
+		}
+		d.Add(name, g)
+	}
+	return d
+}
+
+func TestSignatures(t *testing.T) {
+	tests := map[string][]Signature{
+		"magic": {{Offset: 0, Bytes: []byte("MAGK\x00\x01")}},
+		"java":  {{Offset: 0, Bytes: []byte{0xCA, 0xFE, 0xBA, 0xBE}}},
+		"later": {{Offset: 4, Bytes: []byte("RIFF")}},
+		"text":  nil,
+	}
+
+	for name, want := range tests {
+		g, errs := ParseXmlGrammar(strings.NewReader(detectTestGrammars[name]))
+		if len(errs) > 0 {
+			t.Fatalf("ParseXmlGrammar(%s) = %q want nil error", name, errs)
+		}
+		if diff := pretty.Compare(Signatures(g), want); diff != "" {
+			t.Errorf("Signatures(%s) = -got +want:\n%s", name, diff)
+		}
+	}
+}
+
+func TestDetect(t *testing.T) {
+	d := newTestDetector(t)
+
+	tests := []struct {
+		data     string
+		filename string
+		uti      string
+		want     []string // Candidate names, best first
+	}{
+		{"MAGK\x00\x01body", "", "", []string{"magic"}},
+		{"MAGK\x00\x01body", "file.txt", "", []string{"magic", "text"}},
+		{"\xCA\xFE\xBA\xBE\x00\x00\x00\x34", "A.class", "", []string{"java"}},
+		{"\x04\x00\x00\x00RIFF", "", "", []string{"later"}},
+		{"hello\x00", "README.TEXT", "", []string{"text"}},
+		{"\xCA\xFE\xBA\xBE", "", "com.sun.java-class", []string{"java"}}, // Too short to decode
+		{"nothing", "", "", nil},
+	}
+
+	for _, test := range tests {
+		candidates, err := d.Detect(input.FromBytes([]byte(test.data)), test.filename, test.uti)
+		if err != nil {
+			t.Errorf("Detect(%q) error = %q want nil error", test.data, err)
+			continue
+		}
+
+		var got []string
+		for _, c := range candidates {
+			got = append(got, c.Name)
+		}
+		if diff := pretty.Compare(got, test.want); diff != "" {
+			t.Errorf("Detect(%q, %q, %q) = -got +want:\n%s", test.data, test.filename, test.uti, diff)
+		}
+	}
+}
+
+func TestDetectConfirms(t *testing.T) {
+	d := newTestDetector(t)
+
+	// Matches the java signature, but is too short to decode, so text should be preferred.
+	f := input.FromBytes([]byte("\xCA\xFE\xBA\xBE\x00"))
+	candidates, err := d.Detect(f, "x.txt", "")
+	if err != nil {
+		t.Fatalf("Detect(...) error = %q want nil error", err)
+	}
+	if len(candidates) != 2 {
+		t.Fatalf("Detect(...) = %d candidates want 2", len(candidates))
+	}
+
+	if c := candidates[0]; c.Name != "text" || !c.Confirmed || c.Value == nil {
+		t.Errorf("Detect(...)[0] = %s confirmed:%t want a confirmed text", c.Name, c.Confirmed)
+	}
+	if c := candidates[1]; c.Name != "java" || c.Confirmed || !c.Tried || c.Err == nil {
+		t.Errorf("Detect(...)[1] = %s confirmed:%t err:%v want a failed java", c.Name, c.Confirmed, c.Err)
+	}
+
+	if pos, _ := f.Tell(); pos != 0 {
+		t.Errorf("Detect(...) left the file at %d want 0", pos)
+	}
+}
@@ -0,0 +1,202 @@
+package ufwb
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+
+	"bramp.net/dsector/input"
+)
+
+// ChangeKind is the type of difference found by Diff.
+type ChangeKind string
+
+const (
+	Added   ChangeKind = "added"
+	Removed ChangeKind = "removed"
+	Changed ChangeKind = "changed"
+)
+
+// Change is a single difference between two Value trees.
+type Change struct {
+	Kind ChangeKind `json:"kind"`
+	Path string     `json:"path"`
+
+	Old *ChangedValue `json:"old,omitempty"` // nil if Added
+	New *ChangedValue `json:"new,omitempty"` // nil if Removed
+}
+
+// ChangedValue is one side of a Change. For values decoded from a transformed Binary, the
+// Offset is within the transformed bytes.
+type ChangedValue struct {
+	Offset    int64  `json:"offset"`
+	Len       int64  `json:"length"`
+	Formatted string `json:"formatted"`
+}
+
+// diffKey identifies a child by its element, and how many times that element has been
+// repeated before it.
+type diffKey struct {
+	element Element
+	repeat  int
+}
+
+func diffKeys(children []*Value) []diffKey {
+	keys := make([]diffKey, len(children))
+	counts := make(map[Element]int)
+	for i, child := range children {
+		keys[i] = diffKey{child.Element, counts[child.Element]}
+		counts[child.Element]++
+	}
+	return keys
+}
+
+type differ struct {
+	oldFile, newFile io.ReaderAt
+	changes          []Change
+}
+
+// Diff compares two Value trees, decoded with the same grammar, and returns the fields that
+// were added, removed or changed. Children are aligned by element and repeat index, and values
+// that only moved to a different offset are not reported. If a transformed Binary changed, the
+// Values decoded from it are compared too.
+func Diff(oldFile io.ReaderAt, old *Value, newFile io.ReaderAt, new *Value) ([]Change, error) {
+	d := &differ{oldFile: oldFile, newFile: newFile}
+	if err := d.diff("", old, new); err != nil {
+		return nil, err
+	}
+	return d.changes, nil
+}
+
+func (d *differ) diff(path string, old, new *Value) error {
+	if len(old.Children) == 0 && len(new.Children) == 0 {
+		n := len(d.changes)
+		if err := d.diffLeaf(path, old, new); err != nil {
+			return err
+		}
+		if len(d.changes) > n {
+			return d.diffTransformed(path, old, new)
+		}
+		return nil
+	}
+
+	oldKeys := diffKeys(old.Children)
+	newKeys := diffKeys(new.Children)
+
+	newIndex := make(map[diffKey]int, len(newKeys))
+	for i, key := range newKeys {
+		newIndex[key] = i
+	}
+
+	matched := make(map[diffKey]bool, len(oldKeys))
+	for i, key := range oldKeys {
+		child := old.Children[i]
+		j, found := newIndex[key]
+		if !found {
+			if err := d.add(Removed, joinPath(path, childPath(old, child)), child, nil); err != nil {
+				return err
+			}
+			continue
+		}
+
+		matched[key] = true
+		if err := d.diff(joinPath(path, childPath(new, new.Children[j])), child, new.Children[j]); err != nil {
+			return err
+		}
+	}
+
+	for j, key := range newKeys {
+		if !matched[key] {
+			child := new.Children[j]
+			if err := d.add(Added, joinPath(path, childPath(new, child)), nil, child); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// diffLeaf compares two values by their bytes.
+func (d *differ) diffLeaf(path string, old, new *Value) error {
+	if old.Len == new.Len {
+		a := make([]byte, old.Len)
+		if _, err := input.ReadFullAt(d.oldFile, a, old.Offset); err != nil {
+			return err
+		}
+		b := make([]byte, new.Len)
+		if _, err := input.ReadFullAt(d.newFile, b, new.Offset); err != nil {
+			return err
+		}
+		if bytes.Equal(a, b) {
+			return nil
+		}
+	}
+
+	return d.add(Changed, path, old, new)
+}
+
+// diffTransformed compares the Values decoded from two transformed Binaries.
+func (d *differ) diffTransformed(path string, old, new *Value) error {
+	oldT, newT := old.Transformed(), new.Transformed()
+	if oldT == nil || newT == nil {
+		return nil
+	}
+
+	sub := &differ{oldFile: oldT.Input(), newFile: newT.Input()}
+	if err := sub.diff(joinPath(path, escapePath(newT.Value.Name())), oldT.Value, newT.Value); err != nil {
+		return err
+	}
+	d.changes = append(d.changes, sub.changes...)
+	return nil
+}
+
+func (d *differ) add(kind ChangeKind, path string, old, new *Value) error {
+	c := Change{Kind: kind, Path: path}
+
+	var err error
+	if old != nil {
+		if c.Old, err = newChangedValue(d.oldFile, old); err != nil {
+			return err
+		}
+	}
+	if new != nil {
+		if c.New, err = newChangedValue(d.newFile, new); err != nil {
+			return err
+		}
+	}
+
+	d.changes = append(d.changes, c)
+	return nil
+}
+
+func newChangedValue(file io.ReaderAt, value *Value) (*ChangedValue, error) {
+	s, err := value.Format(file)
+	if err != nil {
+		return nil, err
+	}
+	return &ChangedValue{
+		Offset:    value.Offset,
+		Len:       value.Len,
+		Formatted: s,
+	}, nil
+}
+
+// WriteDiff writes the changes as text, one per line.
+func WriteDiff(w io.Writer, changes []Change) error {
+	for _, c := range changes {
+		var err error
+		switch c.Kind {
+		case Added:
+			_, err = fmt.Fprintf(w, "+ %s [0x%x]: %s\n", c.Path, c.New.Offset, c.New.Formatted)
+		case Removed:
+			_, err = fmt.Fprintf(w, "- %s [0x%x]: %s\n", c.Path, c.Old.Offset, c.Old.Formatted)
+		case Changed:
+			_, err = fmt.Fprintf(w, "~ %s [0x%x -> 0x%x]: %s -> %s\n", c.Path, c.Old.Offset, c.New.Offset, c.Old.Formatted, c.New.Formatted)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<structure name="Chunk" id="1" repeatmax="unlimited">
+				<number name="Length" id="2" type="integer" length="1"/>
+				<binary name="Data" id="3" length="prev.Length"/>
+				<number name="Flag" id="4" type="integer" length="1"/>
+			</structure>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	decode := func(data string) (input.Input, *Value) {
+		file := input.FromBytes([]byte(data))
+		value, err := NewDecoder(grammar, file).Decode()
+		if err != nil {
+			t.Fatalf("decoder.Decode(%q) error = %q want nil error", data, err)
+		}
+		return file, value
+	}
+
+	oldFile, oldValue := decode("\x01A\x00\x02BC\x01\x01D\x00")
+	newFile, newValue := decode("\x02AA\x00\x02BC\x02")
+
+	got, err := Diff(oldFile, oldValue, newFile, newValue)
+	if err != nil {
+		t.Fatalf("Diff(...) error = %q want nil error", err)
+	}
+
+	want := []Change{
+		{Kind: Changed, Path: "File/Chunk[0]/Length", Old: &ChangedValue{0, 1, "1"}, New: &ChangedValue{0, 1, "2"}},
+		{Kind: Changed, Path: "File/Chunk[0]/Data", Old: &ChangedValue{1, 1, "41 (1 bytes)"}, New: &ChangedValue{1, 2, "4141 (2 bytes)"}},
+		// Chunk[1]'s Length and Data moved, but didn't change
+		{Kind: Changed, Path: "File/Chunk[1]/Flag", Old: &ChangedValue{6, 1, "1"}, New: &ChangedValue{7, 1, "2"}},
+		{Kind: Removed, Path: "File/Chunk[2]", Old: &ChangedValue{7, 3, "(3 children)"}},
+	}
+
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("Diff(...) = -got +want:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteDiff(&buf, got); err != nil {
+		t.Fatalf("WriteDiff(...) error = %q want nil error", err)
+	}
+	wantText := "~ File/Chunk[0]/Length [0x0 -> 0x0]: 1 -> 2\n" +
+		"~ File/Chunk[0]/Data [0x1 -> 0x1]: 41 (1 bytes) -> 4141 (2 bytes)\n" +
+		"~ File/Chunk[1]/Flag [0x6 -> 0x7]: 1 -> 2\n" +
+		"- File/Chunk[2] [0x7]: (3 children)\n"
+	if buf.String() != wantText {
+		t.Errorf("WriteDiff(...) = %q want %q", buf.String(), wantText)
+	}
+
+	// Diffing the other way round reports the chunk as added
+	got, err = Diff(newFile, newValue, oldFile, oldValue)
+	if err != nil {
+		t.Fatalf("Diff(...) error = %q want nil error", err)
+	}
+	if last := got[len(got)-1]; last.Kind != Added || last.Path != "File/Chunk[2]" {
+		t.Errorf("Diff(...) last change = %+v want File/Chunk[2] added", last)
+	}
+
+	if got, err := Diff(oldFile, oldValue, oldFile, oldValue); err != nil || len(got) != 0 {
+		t.Errorf("Diff(old, old) = %v, %v want no changes", got, err)
+	}
+}
+
+func TestDiffEmptyStructure(t *testing.T) {
+	file := &Structure{Base: Base{elemType: "Structure", id: 1, name: "File"}}
+	body := &Structure{Base: Base{elemType: "Structure", id: 2, name: "Body"}}
+	data := &Binary{Base: Base{elemType: "Binary", id: 3, name: "Data"}}
+
+	empty := &Value{Len: 0, Element: file, Children: []*Value{{Len: 0, Element: body}}}
+	full := &Value{Len: 2, Element: file, Children: []*Value{{Len: 2, Element: body, Children: []*Value{
+		{Offset: 0, Len: 1, Element: data},
+		{Offset: 1, Len: 1, Element: data},
+	}}}}
+	f := input.FromBytes([]byte("AB"))
+
+	got, err := Diff(f, empty, f, full)
+	if err != nil {
+		t.Fatalf("Diff(...) error = %q want nil error", err)
+	}
+	want := []Change{
+		{Kind: Added, Path: "Body/Data[0]", New: &ChangedValue{0, 1, "41 (1 bytes)"}},
+		{Kind: Added, Path: "Body/Data[1]", New: &ChangedValue{1, 1, "42 (1 bytes)"}},
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("Diff(empty, full) = -got +want:\n%s", diff)
+	}
+
+	got, err = Diff(f, full, f, empty)
+	if err != nil {
+		t.Fatalf("Diff(...) error = %q want nil error", err)
+	}
+	if len(got) != 2 || got[0].Kind != Removed || got[1].Kind != Removed {
+		t.Errorf("Diff(full, empty) = %+v want two removed", got)
+	}
+}
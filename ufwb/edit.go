@@ -0,0 +1,290 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Editor changes the values in a decoded file. Edits are made to a copy of the file, and the
+// Value tree is updated in place, so the tree continues to describe the edited bytes.
+//
+// When a value changes size, all following values are moved, and the enclosing values grow or
+// shrink. If the changed value, or an enclosing value, has a length expression referencing an
+// earlier Number (for example "prev.Length"), that Number is updated to the new length.
+// Afterwards all checksums are recomputed, including any that were explicitly set.
+type Editor struct {
+	data []byte
+	root *Value
+}
+
+// NewEditor returns a Editor for the file and its decoded root value.
+func NewEditor(file io.ReaderAt, root *Value) (*Editor, error) {
+	data, err := readAll(file)
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) < root.Offset+root.Len {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return &Editor{
+		data: data,
+		root: root,
+	}, nil
+}
+
+// readAll returns all the bytes in file.
+func readAll(file io.ReaderAt) ([]byte, error) {
+	var buf bytes.Buffer
+	b := make([]byte, 32*1024)
+	for off := int64(0); ; {
+		n, err := file.ReadAt(b, off)
+		buf.Write(b[:n])
+		off += int64(n)
+
+		if err == io.EOF || err == io.ErrUnexpectedEOF || (err == nil && n < len(b)) {
+			return buf.Bytes(), nil
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// Root returns the root Value.
+func (e *Editor) Root() *Value {
+	return e.root
+}
+
+// Bytes returns the edited file.
+func (e *Editor) Bytes() []byte {
+	return e.data
+}
+
+// ReadAt reads from the edited file, so the Editor can be used to Format the edited values.
+func (e *Editor) ReadAt(b []byte, off int64) (int, error) {
+	return bytes.NewReader(e.data).ReadAt(b, off)
+}
+
+// WriteTo writes the edited file to w.
+func (e *Editor) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(e.data)
+	return int64(n), err
+}
+
+// Set parses the text based on the type of value, and sets it. Numbers accept integers, or
+// the name of a fixed value. Binaries accept hex, or the name of a fixed value. Strings are
+// set as is.
+func (e *Editor) Set(v *Value, text string) error {
+	switch elem := v.Element.(type) {
+	case *Number:
+		for _, fv := range elem.Values() {
+			if fv.name == text {
+				return e.setNumber(v, fv.value)
+			}
+		}
+		i, err := parseInt(text, 0, 64, elem.Signed())
+		if err != nil {
+			return &validationError{e: elem, err: fmt.Errorf("invalid number %q: %s", text, err)}
+		}
+		return e.setNumber(v, i)
+
+	case *Binary:
+		for _, fv := range elem.Values() {
+			if fv.name == text {
+				return e.SetBinary(v, fv.value)
+			}
+		}
+		b, err := hex.DecodeString(strings.Replace(strings.TrimPrefix(text, "0x"), " ", "", -1))
+		if err != nil {
+			return &validationError{e: elem, err: fmt.Errorf("invalid hex %q: %s", text, err)}
+		}
+		return e.SetBinary(v, b)
+
+	case *String:
+		return e.SetString(v, text)
+	}
+
+	return fmt.Errorf("unable to set %s values", elemType(v.Element))
+}
+
+// SetInt sets the value of a Number.
+func (e *Editor) SetInt(v *Value, i int64) error {
+	return e.setNumber(v, i)
+}
+
+// SetUint sets the value of a unsigned Number.
+func (e *Editor) SetUint(v *Value, i uint64) error {
+	return e.setNumber(v, i)
+}
+
+func (e *Editor) setNumber(v *Value, i interface{}) error {
+	n, ok := v.Element.(*Number)
+	if !ok {
+		return fmt.Errorf("%s is a %s not a Number", v.Name(), elemType(v.Element))
+	}
+
+	b, err := encodeInt(i, v.Len, n.Signed(), v.ByteOrder)
+	if err != nil {
+		return &validationError{e: n, err: err}
+	}
+	return e.replace(v, b)
+}
+
+// SetString sets the value of a String, encoding it and adding the delimiter or length
+// prefix as needed.
+func (e *Editor) SetString(v *Value, s string) error {
+	str, ok := v.Element.(*String)
+	if !ok {
+		return fmt.Errorf("%s is a %s not a String", v.Name(), elemType(v.Element))
+	}
+
+	b, err := encodeString(str, s)
+	if err != nil {
+		return err
+	}
+	return e.replace(v, b)
+}
+
+// SetBinary sets the value of a Binary.
+func (e *Editor) SetBinary(v *Value, b []byte) error {
+	if _, ok := v.Element.(*Binary); !ok {
+		return fmt.Errorf("%s is a %s not a Binary", v.Name(), elemType(v.Element))
+	}
+	return e.replace(v, b)
+}
+
+// replace replaces the bytes of v, moving, resizing and updating other values as needed.
+func (e *Editor) replace(v *Value, b []byte) error {
+	if err := e.splice(v, b); err != nil {
+		return err
+	}
+	return e.updateChecksums()
+}
+
+// splice replaces the bytes of v, moving and resizing values, and updating their lengths.
+func (e *Editor) splice(v *Value, b []byte) error {
+	chain := e.chain(e.root, v)
+	if chain == nil {
+		return fmt.Errorf("%s is not part of the edited value tree", v)
+	}
+
+	delta := int64(len(b)) - v.Len
+	if delta == 0 {
+		copy(e.data[v.Offset:], b)
+		return nil
+	}
+
+	// Check we are allowed to change the length of v, and all its parents
+	for _, c := range chain {
+		if _, ok := c.Element.Length().(ConstExpression); ok {
+			return &validationError{e: c.Element, err: fmt.Errorf("has a fixed length of %d", c.Len)}
+		}
+	}
+
+	end := v.Offset + v.Len
+	data := make([]byte, 0, int64(len(e.data))+delta)
+	data = append(data, e.data[:v.Offset]...)
+	data = append(data, b...)
+	e.data = append(data, e.data[end:]...)
+
+	// Move everything after v, and grow the parents
+	inChain := make(map[*Value]bool, len(chain))
+	for _, c := range chain {
+		inChain[c] = true
+		c.Len += delta
+	}
+	e.shift(e.root, inChain, end, delta)
+
+	// Now fix up any lengths that referenced the old lengths
+	for _, c := range chain {
+		if err := e.updateLength(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chain returns the values from root to v, or nil if v isn't found.
+func (e *Editor) chain(root, v *Value) []*Value {
+	if root == v {
+		return []*Value{v}
+	}
+	for _, child := range root.Children {
+		if c := e.chain(child, v); c != nil {
+			return append([]*Value{root}, c...)
+		}
+	}
+	return nil
+}
+
+// shift moves all values starting at or after offset by delta, skipping values in the chain.
+func (e *Editor) shift(value *Value, chain map[*Value]bool, offset, delta int64) {
+	if !chain[value] && value.Offset >= offset {
+		value.Offset += delta
+	}
+	for _, child := range value.Children {
+		e.shift(child, chain, offset, delta)
+	}
+}
+
+// updateLength updates the Number that value's length expression refers to.
+func (e *Editor) updateLength(value *Value) error {
+	expr, ok := value.Element.Length().(StringExpression)
+	if !ok || !strings.HasPrefix(string(expr), "prev.") {
+		return nil
+	}
+	name := strings.TrimPrefix(string(expr), "prev.")
+
+	ref := e.prevByName(value, name)
+	if ref == nil {
+		return &validationError{e: value.Element, err: fmt.Errorf("no previous element named %q found", name)}
+	}
+
+	length := value.Len
+	if value.Element.LengthUnit() == BitLengthUnit {
+		length *= 8
+	}
+	return e.SetInt(ref, length)
+}
+
+// updateChecksums recomputes all the checksums, fixing those that are wrong.
+func (e *Editor) updateChecksums() error {
+	return walkChecksums(e, e.root, func(v *Value) error {
+		if !v.Checksum.Valid {
+			copy(e.data[v.Offset:v.Offset+v.Len], v.Checksum.want)
+			v.Checksum.Valid = true
+		}
+		return nil
+	})
+}
+
+// prevByName returns the value named name, that the Decoder would have found when it started
+// decoding target. That is the last value, in the order they were decoded, before target.
+func (e *Editor) prevByName(target *Value, name string) *Value {
+	var found *Value
+	done := false
+
+	var walk func(v *Value)
+	walk = func(v *Value) {
+		if v == target {
+			done = true
+			return
+		}
+		for _, child := range v.Children {
+			if walk(child); done {
+				return
+			}
+		}
+		// Values are appended once they are fully decoded, which is after their children
+		if v.Name() == name {
+			found = v
+		}
+	}
+	walk(e.root)
+
+	return found
+}
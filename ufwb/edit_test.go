@@ -0,0 +1,128 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const editTestGrammar = testHeader +
+	`<structure name="File" id="99" endian="big" signed="no">
+		<structure name="Record" id="1" repeatmax="unlimited">
+			<number name="Size" id="2" type="integer" length="2"/>
+			<structure name="Body" id="3" length="prev.Size">
+				<number name="Kind" id="4" type="integer" length="1">
+					<fixedvalue name="text" value="1"/>
+					<fixedvalue name="blob" value="2"/>
+				</number>
+				<number name="TextLen" id="5" type="integer" length="1"/>
+				<string name="Text" id="6" type="fixed-length" length="prev.TextLen"/>
+				<string name="Name" id="7" type="zero-terminated"/>
+			</structure>
+			<binary name="Tag" id="8" length="2"/>
+		</structure>
+	</structure>` + testFooter
+
+func TestEditor(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(editTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	data := []byte(
+		"\x00\x06\x01\x02hiA\x00TG" +
+			"\x00\x05\x02\x01xB\x00ZZ")
+	value, err := NewDecoder(grammar, input.FromBytes(data)).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	editor, err := NewEditor(input.FromBytes(data), value)
+	if err != nil {
+		t.Fatalf("NewEditor(...) error = %q want nil error", err)
+	}
+
+	set := func(path, text string) {
+		matches, err := value.Select(editor, path)
+		if err != nil || len(matches) != 1 {
+			t.Fatalf("value.Select(%q) = %v, %v want one match", path, matches, err)
+		}
+		if err := editor.Set(matches[0].Value, text); err != nil {
+			t.Fatalf("editor.Set(%q, %q) error = %q want nil error", path, text, err)
+		}
+	}
+
+	set("File/Record[0]/Body/Text", "hello") // Grows Text, TextLen, Body, and Size
+	set("File/Record[1]/Body/Name", "")      // Shrinks the second record
+	set("File/Record[1]/Body/Kind", "text")  // Fixed value name
+	set("File/Record[1]/Tag", "0x5959")      // Same size
+
+	want := []byte(
+		"\x00\x09\x01\x05helloA\x00TG" +
+			"\x00\x04\x01\x01x\x00YY")
+	if got := editor.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("editor.Bytes() = %q want %q", got, want)
+	}
+
+	if err := value.validiate(); err != nil {
+		t.Errorf("value.validiate() = %q want nil error", err)
+	}
+
+	// The edited tree should match a fresh decode of the edited bytes
+	got, err := NewDecoder(grammar, input.FromBytes(want)).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode(edited) error = %q want nil error", err)
+	}
+	if changes, err := Diff(editor, value, input.FromBytes(want), got); err != nil || len(changes) > 0 {
+		t.Errorf("Diff(edited, decoded) = %v, %v want no changes", changes, err)
+	}
+	if got.Len != value.Len || got.Children[0].Children[1].Offset != value.Children[0].Children[1].Offset {
+		t.Errorf("edited tree offsets don't match a fresh decode")
+	}
+}
+
+func TestEditorErrors(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(editTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	data := []byte("\x00\x06\x01\x02hiA\x00TG")
+	file := input.FromBytes(data)
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	editor, err := NewEditor(file, value)
+	if err != nil {
+		t.Fatalf("NewEditor(...) error = %q want nil error", err)
+	}
+
+	tests := []struct {
+		path, text string
+	}{
+		{"File/Record/Tag", "aabbcc"},        // Fixed length
+		{"File/Record/Size", "65536"},        // Too big
+		{"File/Record/Size", "-1"},           // Unsigned
+		{"File/Record/Body/Kind", "unknown"}, // Not a number or fixed value
+		{"File/Record/Body/Name", "a\x00b"},  // Contains the delimiter
+		{"File/Record/Tag", "xyz"},           // Not hex
+		{"File/Record/Body", "1"},            // Structures can't be set
+	}
+
+	for _, test := range tests {
+		matches, err := value.Select(editor, test.path)
+		if err != nil || len(matches) != 1 {
+			t.Fatalf("value.Select(%q) = %v, %v want one match", test.path, matches, err)
+		}
+		if err := editor.Set(matches[0].Value, test.text); err == nil {
+			t.Errorf("editor.Set(%q, %q) = nil want error", test.path, test.text)
+		}
+	}
+
+	if got := editor.Bytes(); !bytes.Equal(got, data) {
+		t.Errorf("editor.Bytes() = %q want unchanged %q", got, data)
+	}
+}
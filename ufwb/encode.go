@@ -0,0 +1,375 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+)
+
+// Encoder builds a binary file from a JsonValue tree, shaped like the output of NewJsonValue.
+//
+// Each JsonValue is matched to a element by name. Leaf values are taken from, in order of
+// preference, Raw (hex), Fixed (the name of a fixed value), Value (for Numbers), or Formatted
+// (for Numbers and Strings). Only Name, Children and one of the values need to be set.
+//
+// Elements missing from the JSON are filled in if they have a fixed value, such as a magic
+// number, or are structures that can be filled in this way. Lengths are derived from the
+// content, so a Number referenced by a "prev.Name" length expression may also be omitted.
+// Similarly checksums are always computed, replacing any value given.
+type Encoder struct {
+	u *Ufwb
+
+	buf    bytes.Buffer
+	values []*Value // All values in the order they were encoded
+}
+
+// NewEncoder returns a Encoder for this grammar.
+func NewEncoder(u *Ufwb) *Encoder {
+	return &Encoder{u: u}
+}
+
+// Encode returns the bytes for the JsonValue tree, along with the Value tree describing them.
+// The root may either be the Grammar, or a single instance of the grammar's start structure.
+func (e *Encoder) Encode(root *JsonValue) ([]byte, *Value, error) {
+	e.buf.Reset()
+	e.values = nil
+
+	g := e.u.Grammar
+	children := []*JsonValue{root}
+	if root.Type == "Grammar" || (root.Name == g.Name() && root.Name != g.Start.Name()) {
+		children = root.Children
+	}
+
+	value := &Value{Element: g}
+	for _, child := range children {
+		if child.Name != g.Start.Name() {
+			return nil, nil, &validationError{e: g, err: fmt.Errorf("expected %q found %q", g.Start.Name(), child.Name)}
+		}
+		v, err := e.encode(g.Start, child, binary.BigEndian)
+		if err != nil {
+			return nil, nil, err
+		}
+		value.Children = append(value.Children, v)
+	}
+	value.Len = int64(e.buf.Len())
+
+	// Now everything is written, fix up the lengths
+	editor := &Editor{data: e.buf.Bytes(), root: value}
+	for _, v := range e.values {
+		if err := editor.updateLength(v); err != nil {
+			return nil, nil, err
+		}
+	}
+	if err := editor.updateChecksums(); err != nil {
+		return nil, nil, err
+	}
+
+	return editor.Bytes(), value, nil
+}
+
+// EncodeJson reads a JsonValue tree from r, and encodes it.
+func (e *Encoder) EncodeJson(r io.Reader) ([]byte, *Value, error) {
+	var root JsonValue
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	if err := decoder.Decode(&root); err != nil {
+		return nil, nil, err
+	}
+	return e.Encode(&root)
+}
+
+func (e *Encoder) encode(elem Element, j *JsonValue, order binary.ByteOrder) (*Value, error) {
+	v := &Value{
+		Offset:  int64(e.buf.Len()),
+		Element: elem,
+	}
+
+	var b []byte
+	var err error
+
+	switch elem := elem.(type) {
+	case *Structure:
+		err = e.encodeStructure(v, elem, j, order)
+	case *StructRef:
+		err = e.encodeStructure(v, elem.Structure(), j, order)
+	case *Number:
+		v.ByteOrder = byteOrder(elem.Endian(), order)
+		b, err = e.encodeNumber(elem, j, v.ByteOrder)
+	case *String:
+		b, err = e.encodeString(elem, j)
+	case *Binary:
+		b, err = e.encodeBinary(elem, j)
+	default:
+		if j == nil || j.Raw == "" {
+			return nil, &validationError{e: elem, err: fmt.Errorf("%s elements can only be encoded from raw bytes", elemType(elem))}
+		}
+		b, err = hex.DecodeString(j.Raw)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	e.buf.Write(b)
+	v.Len = int64(e.buf.Len()) - v.Offset
+
+	if length, ok := elem.Length().(ConstExpression); ok {
+		if elem.LengthUnit() == BitLengthUnit {
+			length /= 8
+		}
+		if v.Len != int64(length) {
+			return nil, &validationError{e: elem, err: fmt.Errorf("encoded %d bytes want %d", v.Len, length)}
+		}
+	}
+	e.values = append(e.values, v)
+	return v, nil
+}
+
+func byteOrder(endian Endian, order binary.ByteOrder) binary.ByteOrder {
+	switch endian {
+	case LittleEndian:
+		return binary.LittleEndian
+	case BigEndian:
+		return binary.BigEndian
+	}
+	return order
+}
+
+func (e *Encoder) encodeStructure(v *Value, s *Structure, j *JsonValue, order binary.ByteOrder) error {
+	order = byteOrder(s.Endian(), order)
+
+	var children []*JsonValue
+	if j != nil {
+		children = j.Children
+	}
+
+	if s.Order() == VariableOrder {
+		for _, child := range children {
+			_, elem := Elements(s.Elements()).Find(child.Name)
+			if elem == nil {
+				return &validationError{e: s, err: fmt.Errorf("unknown element %q", child.Name)}
+			}
+			c, err := e.encode(elem, child, order)
+			if err != nil {
+				return err
+			}
+			v.Children = append(v.Children, c)
+		}
+		return nil
+	}
+
+	for _, elem := range s.Elements() {
+		found := 0
+		for len(children) > 0 && children[0].Name == elem.Name() {
+			c, err := e.encode(elem, children[0], order)
+			if err != nil {
+				return err
+			}
+			v.Children = append(v.Children, c)
+			children = children[1:]
+			found++
+		}
+
+		// Fill in any required elements that were missing
+		if found == 0 && isRequired(elem) {
+			c, err := e.encode(elem, nil, order)
+			if err != nil {
+				return &validationError{e: elem, err: fmt.Errorf("missing and unable to fill in: %s", err)}
+			}
+			v.Children = append(v.Children, c)
+		}
+	}
+
+	if len(children) > 0 {
+		return &validationError{e: s, err: fmt.Errorf("unexpected element %q", children[0].Name)}
+	}
+	return nil
+}
+
+// isRequired returns true if the element must appear at least once.
+func isRequired(e Element) bool {
+	min, ok := e.RepeatMin().(ConstExpression)
+	return ok && min > 0
+}
+
+func (e *Encoder) encodeNumber(n *Number, j *JsonValue, order binary.ByteOrder) ([]byte, error) {
+	length, ok := n.Length().(ConstExpression)
+	if !ok || n.LengthUnit() != ByteLengthUnit {
+		return nil, &validationError{e: n, err: fmt.Errorf("only fixed length numbers can be encoded")}
+	}
+	if n.Type != "integer" {
+		return nil, &validationError{e: n, err: fmt.Errorf("only integer numbers can be encoded")}
+	}
+
+	if j != nil && j.Raw != "" {
+		return hex.DecodeString(j.Raw)
+	}
+
+	var i interface{}
+	switch {
+	case j == nil:
+		if len(n.Values()) > 0 {
+			i = n.Values()[0].value
+		} else {
+			i = int64(0) // Possibly a length field, which is fixed up later
+		}
+
+	case j.Fixed != "":
+		for _, fv := range n.Values() {
+			if fv.name == j.Fixed {
+				i = fv.value
+			}
+		}
+		if i == nil {
+			return nil, &validationError{e: n, err: fmt.Errorf("unknown fixed value %q", j.Fixed)}
+		}
+
+	default:
+		s := string(j.Value)
+		if s == "" {
+			s = j.Formatted
+		}
+		for _, fv := range n.Values() {
+			if fv.name == s {
+				i = fv.value
+			}
+		}
+		if i == nil {
+			var err error
+			if i, err = parseInt(s, 0, 64, n.Signed()); err != nil {
+				return nil, &validationError{e: n, err: fmt.Errorf("invalid number %q: %s", s, err)}
+			}
+		}
+	}
+
+	b, err := encodeInt(i, int64(length), n.Signed(), order)
+	if err != nil {
+		return nil, &validationError{e: n, err: err}
+	}
+	return b, nil
+}
+
+func (e *Encoder) encodeString(s *String, j *JsonValue) ([]byte, error) {
+	if j != nil && j.Raw != "" {
+		return hex.DecodeString(j.Raw)
+	}
+
+	var text string
+	switch {
+	case j == nil || j.Fixed != "":
+		name := ""
+		if j != nil {
+			name = j.Fixed
+		}
+		found := false
+		for _, fv := range s.Values() {
+			if name == "" || fv.name == name {
+				text, found = fv.value, true
+				break
+			}
+		}
+		if !found {
+			return nil, &validationError{e: s, err: fmt.Errorf("no fixed value %q", name)}
+		}
+
+	default:
+		text = j.Formatted
+	}
+
+	return encodeString(s, text)
+}
+
+func (e *Encoder) encodeBinary(b *Binary, j *JsonValue) ([]byte, error) {
+	if j != nil && j.Raw != "" {
+		return hex.DecodeString(j.Raw)
+	}
+
+	name := ""
+	if j != nil {
+		name = j.Fixed
+	}
+	for _, fv := range b.Values() {
+		if name == "" || fv.name == name {
+			return fv.value, nil
+		}
+	}
+
+	if name != "" {
+		return nil, &validationError{e: b, err: fmt.Errorf("unknown fixed value %q", name)}
+	}
+	return nil, &validationError{e: b, err: fmt.Errorf("no raw value")}
+}
+
+// encodeString returns the bytes for the text in the String's encoding, type and delimiter.
+func encodeString(s *String, text string) ([]byte, error) {
+	b, err := encodeText(s.Encoding(), text)
+	if err != nil {
+		return nil, &validationError{e: s, err: err}
+	}
+
+	switch s.Typ() {
+	case "zero-terminated", "delimiter-terminated":
+		if bytes.IndexByte(b, s.delimiter) >= 0 {
+			return nil, &validationError{e: s, err: fmt.Errorf("%q contains the delimiter %q", text, s.delimiter)}
+		}
+		return append(b, s.delimiter), nil
+
+	case "fixed-length":
+		return b, nil
+
+	case "pascal":
+		if len(b) > 255 {
+			return nil, &validationError{e: s, err: fmt.Errorf("%d bytes is too long for a pascal string", len(b))}
+		}
+		return append([]byte{byte(len(b))}, b...), nil
+	}
+
+	return nil, &validationError{e: s, err: fmt.Errorf("unknown string type %q", s.Typ())}
+}
+
+// encodeText returns the text encoded with the named character encoding.
+func encodeText(encoding, text string) ([]byte, error) {
+	switch strings.ToUpper(strings.Replace(encoding, "_", "-", -1)) {
+	case "", "UTF-8", "UTF8":
+		return []byte(text), nil
+
+	case "ASCII", "US-ASCII", "ANSI-X3.4-1968":
+		return encodeCharmap(text, 0x7F)
+
+	case "ISO-8859-1", "ISO-8859-1:1987", "LATIN1":
+		return encodeCharmap(text, 0xFF)
+
+	case "UTF-16", "UTF-16BE":
+		return encodeUtf16(text, binary.BigEndian), nil
+
+	case "UTF-16LE":
+		return encodeUtf16(text, binary.LittleEndian), nil
+	}
+
+	return nil, fmt.Errorf("unsupported encoding %q", encoding)
+}
+
+// encodeCharmap encodes text where each rune up to max is a single byte.
+func encodeCharmap(text string, max rune) ([]byte, error) {
+	b := make([]byte, 0, len(text))
+	for _, r := range text {
+		if r > max {
+			return nil, fmt.Errorf("%q can not be encoded", r)
+		}
+		b = append(b, byte(r))
+	}
+	return b, nil
+}
+
+func encodeUtf16(text string, order binary.ByteOrder) []byte {
+	u := utf16.Encode([]rune(text))
+	b := make([]byte, 2*len(u))
+	for i, c := range u {
+		order.PutUint16(b[2*i:], c)
+	}
+	return b
+}
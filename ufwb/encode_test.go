@@ -0,0 +1,114 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+const encodeTestGrammar = testHeader +
+	`<structure name="File" id="99" endian="little" signed="no">
+		<binary name="Magic" id="1" length="2">
+			<fixedvalue name="magic" value="cafe"/>
+		</binary>
+		<number name="Version" id="2" type="integer" length="2" endian="big">
+			<fixedvalue name="v1" value="1"/>
+			<fixedvalue name="v2" value="2"/>
+		</number>
+		<structure name="Record" id="3" repeatmin="0" repeatmax="unlimited">
+			<number name="Size" id="4" type="integer" length="4"/>
+			<string name="Title" id="5" type="fixed-length" length="prev.Size" encoding="UTF-16LE"/>
+			<string name="Note" id="6" type="zero-terminated" encoding="ISO_8859-1:1987"/>
+			<number name="Delta" id="7" type="integer" length="1" signed="yes"/>
+		</structure>
+	</structure>` + testFooter
+
+func TestEncoder(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(encodeTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	root := &JsonValue{
+		Name: "File",
+		Children: []*JsonValue{
+			// Magic is filled in
+			{Name: "Version", Fixed: "v2"},
+			{Name: "Record", Children: []*JsonValue{
+				// Size is derived from Title
+				{Name: "Title", Formatted: "Hé"},
+				{Name: "Note", Formatted: "café"},
+				{Name: "Delta", Value: "-2"},
+			}},
+			{Name: "Record", Children: []*JsonValue{
+				{Name: "Size", Value: "99"}, // Corrected
+				{Name: "Title", Raw: "4100"},
+				{Name: "Note", Formatted: ""},
+				{Name: "Delta", Formatted: "0x7f"},
+			}},
+		},
+	}
+
+	got, value, err := NewEncoder(grammar).Encode(root)
+	if err != nil {
+		t.Fatalf("encoder.Encode(...) error = %q want nil error", err)
+	}
+
+	want := []byte("\xca\xfe\x00\x02" +
+		"\x04\x00\x00\x00H\x00\xe9\x00caf\xe9\x00\xfe" +
+		"\x02\x00\x00\x00A\x00\x00\x7f")
+	if !bytes.Equal(got, want) {
+		t.Errorf("encoder.Encode(...) = %q want %q", got, want)
+	}
+
+	// Decoding the output should give a equivalent tree
+	file := input.FromBytes(got)
+	decoded, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode(...) error = %q want nil error", err)
+	}
+	if changes, err := Diff(file, value, file, decoded); err != nil || len(changes) > 0 {
+		t.Errorf("Diff(encoded, decoded) = %v, %v want no changes", changes, err)
+	}
+
+	// and encoding the decoder's JSON output should give the same bytes
+	var buf bytes.Buffer
+	if err := WriteJson(&buf, file, decoded); err != nil {
+		t.Fatalf("WriteJson(...) error = %q want nil error", err)
+	}
+	again, _, err := NewEncoder(grammar).EncodeJson(&buf)
+	if err != nil {
+		t.Fatalf("encoder.EncodeJson(WriteJson(...)) error = %q want nil error", err)
+	}
+	if !bytes.Equal(again, want) {
+		t.Errorf("encoder.EncodeJson(WriteJson(...)) = %q want %q", again, want)
+	}
+}
+
+func TestEncoderErrors(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(encodeTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	record := func(children ...*JsonValue) *JsonValue {
+		return &JsonValue{Name: "File", Children: []*JsonValue{{Name: "Record", Children: children}}}
+	}
+
+	tests := []*JsonValue{
+		{Name: "Other"},
+		{Name: "File", Children: []*JsonValue{{Name: "Unknown"}}},
+		{Name: "File", Children: []*JsonValue{{Name: "Magic", Raw: "cafebabe"}}}, // Wrong length
+		{Name: "File", Children: []*JsonValue{{Name: "Version", Fixed: "v3"}}},
+		record(&JsonValue{Name: "Title", Formatted: "x"}, &JsonValue{Name: "Note", Formatted: "€"}),
+		record(&JsonValue{Name: "Title", Formatted: "x"}, &JsonValue{Name: "Note", Formatted: "a"}, &JsonValue{Name: "Delta", Value: "128"}),
+		record(&JsonValue{Name: "Title", Formatted: "x"}), // Note is required
+	}
+
+	for _, test := range tests {
+		if _, _, err := NewEncoder(grammar).Encode(test); err == nil {
+			t.Errorf("encoder.Encode(%s) = nil want error", test.Name)
+		}
+	}
+}
@@ -1,4 +1,3 @@
-// TODO Change Format API to have a FormatTo(.., io.writer), or similar, so we can avoid all the string concat.
 package ufwb
 
 import (
@@ -11,9 +10,50 @@ import (
 	"reflect"
 )
 
-var (
-	indent = 0 // Bad global var for format identing
-)
+// treeFormatter writes a tree of Values, one Value per line, indented by depth.
+type treeFormatter struct {
+	w    io.Writer
+	file io.ReaderAt
+}
+
+// FormatTo writes the value, and all its children, as a indented tree to w.
+func FormatTo(w io.Writer, file io.ReaderAt, value *Value) error {
+	f := &treeFormatter{w: w, file: file}
+	return f.format(value, 0, "")
+}
+
+func (f *treeFormatter) format(value *Value, depth int, prefix string) error {
+	s, err := value.Format(f.file)
+	if err != nil {
+		return err
+	}
+
+	s = strings.TrimSpace(s)
+	if bad := badChecksum(value); bad != "" {
+		s += " [" + bad + "]"
+	}
+
+	pad := strings.Repeat("  ", depth)
+	if _, err := fmt.Fprintf(f.w, "%s%s%s: %s\n", pad, prefix, value.Name(), s); err != nil {
+		return err
+	}
+
+	for i, child := range value.Children {
+		if err := f.format(child, depth+1, fmt.Sprintf("[%d] ", i)); err != nil {
+			return err
+		}
+	}
+
+	// Transformed values are shown under the value, read from the transformed bytes
+	if t := value.Transformed(); t != nil {
+		sub := &treeFormatter{w: f.w, file: t.Input()}
+		if err := sub.format(t.Value, depth+1, "=> "); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
 
 func leftPad(s string, pad string, width int) string {
 	if len(s) >= width {
@@ -22,9 +62,11 @@ func leftPad(s string, pad string, width int) string {
 	return strings.Repeat(pad, width-len(s)) + s
 }
 
+// Format returns the whole tree of Values as a string. Prefer FormatTo for large trees.
 func (u *Ufwb) Format(file io.ReaderAt, value *Value) (string, error) {
-	indent = 0
-	return u.Grammar.Format(file, value)
+	var buffer bytes.Buffer
+	err := FormatTo(&buffer, file, value)
+	return buffer.String(), err
 }
 
 func (p *Padding) Format(file io.ReaderAt, value *Value) (string, error) {
@@ -32,53 +74,11 @@ func (p *Padding) Format(file io.ReaderAt, value *Value) (string, error) {
 }
 
 func (g *Grammar) Format(file io.ReaderAt, value *Value) (string, error) {
-	var buffer bytes.Buffer
-
-	buffer.WriteString(g.Name())
-	buffer.WriteString(": ")
-
-	str, err := g.Start.Format(file, value)
-	if err != nil {
-		return "<format error>", err
-	}
-
-	buffer.WriteString(str)
-
-	return buffer.String(), nil
+	return fmt.Sprintf("(%d children)", len(value.Children)), nil
 }
 
 func (n *Structure) Format(file io.ReaderAt, value *Value) (string, error) {
-
-	indent++
-
-	var buffer bytes.Buffer
-	buffer.WriteString(fmt.Sprintf("(%d children)", len(value.Children)))
-	buffer.WriteString("\n")
-
-	pad := ""
-	for i := 0; i < indent; i++ {
-		pad += "  "
-	}
-
-	for i, child := range value.Children {
-		buffer.WriteString(pad)
-		buffer.WriteString(fmt.Sprintf("[%d] ", i))
-		buffer.WriteString(child.Name())
-		buffer.WriteString(": ")
-		child.Format(file)
-
-		value, err := child.Format(file)
-		if err != nil {
-			indent--
-			return "<format error>", err
-		}
-		buffer.WriteString(strings.TrimSpace(value))
-		buffer.WriteString("\n")
-	}
-
-	indent--
-
-	return buffer.String(), nil
+	return fmt.Sprintf("(%d children)", len(value.Children)), nil
 }
 
 func (s *String) Format(file io.ReaderAt, value *Value) (string, error) {
@@ -178,6 +178,8 @@ func (b *Binary) Format(file io.ReaderAt, value *Value) (string, error) {
 	if err == nil {
 		if fv, ok := value.Extra.(*FixedBinaryValue); ok {
 			s += fmt.Sprintf(" (%s)", fv.name)
+		} else if t := value.Transformed(); t != nil && t.Transform != "" {
+			s += fmt.Sprintf(" (%d bytes, %s to %d bytes)", len(bs), t.Transform, len(t.Data))
 		} else {
 			s += fmt.Sprintf(" (%d bytes)", len(bs))
 		}
@@ -187,7 +189,11 @@ func (b *Binary) Format(file io.ReaderAt, value *Value) (string, error) {
 }
 
 func (n *Custom) Format(file io.ReaderAt, value *Value) (string, error) {
-	panic("TODO")
+	t := n.Typ()
+	if t == nil {
+		return "", &validationError{e: n, err: errCustomScript}
+	}
+	return t.Format(file, value)
 }
 
 func (n *GrammarRef) Format(file io.ReaderAt, value *Value) (string, error) {
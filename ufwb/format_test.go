@@ -0,0 +1,70 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFormatTo(t *testing.T) {
+	xml := testHeader +
+		`<structure name="Pairs" id="99">
+			<structure name="Pair" id="1" repeatmax="unlimited">
+				<number name="Key"   id="2" type="integer" length="1"/>
+				<string name="Value" id="3" type="zero-terminated"/>
+			</structure>
+		</structure>` + testFooter
+
+	want := `Test: (1 children)
+  [0] Pairs: (2 children)
+    [0] Pair: (2 children)
+      [0] Key: 1
+      [1] Value: a
+    [1] Pair: (2 children)
+      [0] Key: 2
+      [1] Value: bc
+`
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte("\x01a\x00\x02bc\x00"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	// Format concurrently, to ensure no state is shared between calls.
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var got bytes.Buffer
+			if err := value.FormatTo(&got, file); err != nil {
+				t.Errorf("value.FormatTo(...) error = %q want nil error", err)
+				return
+			}
+
+			if diff := pretty.Compare(got.String(), want); diff != "" {
+				t.Errorf("value.FormatTo(...) = -got +want:\n%s", diff)
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Structures only return a summary
+	got, err := value.Children[0].Format(file)
+	if err != nil {
+		t.Errorf("value.Format(...) error = %q want nil error", err)
+	}
+	if want := "(2 children)"; got != want {
+		t.Errorf("value.Format(...) = %q want %q", got, want)
+	}
+}
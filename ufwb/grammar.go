@@ -3,10 +3,12 @@ package ufwb
 
 import (
 	"bramp.net/dsector/toerr"
+	"bytes"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"strconv"
 )
 
@@ -72,6 +74,16 @@ func deriver(u *Ufwb, element Element, parent *Structure, errs *toerr.Errors) {
 			return
 		}
 
+		// Ensure no structure ends up extending itself
+		if p, ok := e.(*Structure); ok {
+			for ; p != nil; p = p.derives {
+				if p == s {
+					errs.Append(&validationError{e: element, err: fmt.Errorf("extends %q creates a loop", s.Xml.Extends)})
+					return
+				}
+			}
+		}
+
 		if err := s.DeriveFrom(e); err != nil {
 			errs.Append(err)
 		}
@@ -86,13 +98,35 @@ func updater(u *Ufwb, element Element, parent *Structure, errs *toerr.Errors) {
 
 func ParseXmlGrammar(r io.Reader) (*Ufwb, []error) {
 
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, []error{err}
+	}
+
 	// 1. Decode the xml into our XML objects
 	x := &XmlUfwb{}
-	decoder := xml.NewDecoder(r)
+	decoder := xml.NewDecoder(bytes.NewReader(data))
 	if err := decoder.Decode(x); err != nil {
 		return nil, []error{err}
 	}
 
+	// Record where each element was found, so errors can refer to them
+	positions, err := readPositions(data)
+	if err != nil {
+		return nil, []error{err}
+	}
+	positioner(positions).ufwb(x)
+
+	return FromXml(x)
+}
+
+// FromXml returns the grammar described by the XML objects. This is used by ParseXmlGrammar,
+// and for grammars constructed in code, such as with the builder package.
+func FromXml(x *XmlUfwb) (*Ufwb, []error) {
+	if x.Grammar == nil {
+		return nil, []error{errors.New("missing grammar element")}
+	}
+
 	// 2. Turn the XML objects into a native objects
 	//    This does very little sanity checking
 	u, errs := x.transform()
@@ -100,30 +134,36 @@ func ParseXmlGrammar(r io.Reader) (*Ufwb, []error) {
 		return u, errs
 	}
 
+	return u, link(u)
+}
+
+// link indexes, derives and updates all the elements of a newly transformed grammar.
+func link(u *Ufwb) []error {
 	// 3. Building the initial id index
 	if errs := Walk(u, indexer); len(errs) > 0 {
-		return u, errs
+		return errs
 	}
 
 	// 4. Ensure elements are derived correctly
 	if errs := Walk(u, deriver); len(errs) > 0 {
-		return u, errs
+		return errs
 	}
 
-	// TODO add function that check if there are not any loops due to the derives and parents
-
 	// Now update and parsing all values
 	if errs := Walk(u, updater); len(errs) > 0 {
-		return u, errs
+		return errs
 	}
 
-	return u, nil
+	return nil
 }
 
+// WriteXmlGrammar writes the grammar as XML. The XML is recreated from the native Elements, so
+// any changes made to them are included.
 func WriteXmlGrammar(w io.Writer, ufwb *Ufwb) error {
-	w.Write([]byte(xml.Header))
+	if _, err := w.Write([]byte(xml.Header)); err != nil {
+		return err
+	}
 	encoder := xml.NewEncoder(w)
 	encoder.Indent("", "    ")
-	// TODO Instead of depending on the Xml field, recreate all the Xml, so changes in ufwb are reflected.
-	return encoder.Encode(ufwb.Xml)
+	return encoder.Encode(ufwb.toXml())
 }
@@ -47,6 +47,13 @@ func readGrammar(filename string) ([]byte, error) {
 func normalise(root *Ufwb, element Element, parent *Structure, errs *toerr.Errors) {
 	_ = root
 
+	// Positions are tested in positions_test.go
+	if p, ok := element.(interface {
+		SetPos(*Position)
+	}); ok {
+		p.SetPos(nil)
+	}
+
 	switch e := element.(type) {
 	case *Grammar:
 		e.Xml = nil
@@ -139,7 +146,7 @@ func TestParseGrammarFragment(t *testing.T) {
                     </fixedvalues>
                 </number>`,
 			want: &Number{
-				Base:   Base{"Number", 1, "number name", ""},
+				Base:   Base{elemType: "Number", id: 1, name: "number name"},
 				Type:   "integer",
 				length: ConstExpression(1),
 				values: []*FixedValue{
@@ -203,31 +210,31 @@ func TestParseGrammar(t *testing.T) {
 			want: &Ufwb{
 				Version: "1.0.3",
 				Grammar: &Grammar{
-					Base:     Base{"Grammar", 0, "Test Name", "Test Description"},
+					Base:     Base{elemType: "Grammar", id: 0, name: "Test Name", description: "Test Description"},
 					Author:   "bramp@",
 					Ext:      "test",
 					Complete: boolOf(true),
 					//Start:       "1",
 					Elements: []Element{
 						&Structure{
-							Base:    Base{"Structure", 1, "struct", ""},
+							Base:    Base{elemType: "Structure", id: 1, name: "struct"},
 							Repeats: Repeats{ConstExpression(2), StringExpression("unlimited")},
 							elements: []Element{
 								&String{
-									Base: Base{"String", 2, "string", ""},
+									Base: Base{elemType: "String", id: 2, name: "string"},
 									typ:  "zero-terminated",
 								},
 								&Number{
-									Base:   Base{"Number", 3, "number", ""},
+									Base:   Base{elemType: "Number", id: 3, name: "number"},
 									Type:   "integer",
 									length: ConstExpression(8),
 								},
 								&Structure{
-									Base:   Base{"Structure", 4, "substruct", ""},
+									Base:   Base{elemType: "Structure", id: 4, name: "substruct"},
 									length: StringExpression("prev.number"),
 									elements: []Element{
 										&Binary{
-											Base:   Base{"Binary", 5, "binary", ""},
+											Base:   Base{elemType: "Binary", id: 5, name: "binary"},
 											length: ConstExpression(4),
 											values: []*FixedBinaryValue{
 												{name: "one", value: []byte{0x01, 0x23, 0x45, 0x67}},
@@ -235,7 +242,7 @@ func TestParseGrammar(t *testing.T) {
 											},
 										},
 										&Number{
-											Base:   Base{"Number", 6, "number_values", ""},
+											Base:   Base{elemType: "Number", id: 6, name: "number_values"},
 											Type:   "integer",
 											length: ConstExpression(4),
 											values: []*FixedValue{
@@ -0,0 +1,234 @@
+package ufwb
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"bramp.net/dsector/input"
+)
+
+const hexDumpWidth = 16 // Bytes per line
+
+type ColourMode int
+
+const (
+	NoColours   ColourMode = iota
+	Colours256             // ANSI 256 colour codes
+	TrueColours            // ANSI 24 bit colour codes
+)
+
+// colourSpan is a range of bytes belonging to a single leaf Value.
+type colourSpan struct {
+	start, end int64
+	value      *Value
+	colour     Colour
+}
+
+// fillColour returns the fill colour of this element, or White if unset.
+func fillColour(e Element) Colour {
+	if s, ok := e.(*StructRef); ok && s.FillColour() == White {
+		return s.Structure().FillColour()
+	}
+	if c, ok := e.(Coloured); ok {
+		return c.FillColour()
+	}
+	return White
+}
+
+// colourSpans returns the leaf Values, in order, along with the colour of the inner most element
+// with a fill colour set.
+func colourSpans(value *Value, colour Colour, spans []colourSpan) []colourSpan {
+	if c := fillColour(value.Element); c != White {
+		colour = c
+	}
+
+	if len(value.Children) == 0 {
+		if value.Len > 0 {
+			spans = append(spans, colourSpan{
+				start:  value.Offset,
+				end:    value.Offset + value.Len,
+				value:  value,
+				colour: colour,
+			})
+		}
+		return spans
+	}
+
+	for _, child := range value.Children {
+		spans = colourSpans(child, colour, spans)
+	}
+	return spans
+}
+
+// escape returns the ANSI escape sequence to set the background to this colour.
+func (mode ColourMode) escape(c Colour) string {
+	r, g, b := c.RGB()
+
+	// Pick a readable foreground
+	fg := 97 // White
+	if (299*int(r)+587*int(g)+114*int(b))/1000 > 128 {
+		fg = 30 // Black
+	}
+
+	switch mode {
+	case TrueColours:
+		return fmt.Sprintf("\x1b[%d;48;2;%d;%d;%dm", fg, r, g, b)
+	case Colours256:
+		// Map onto the 6x6x6 colour cube
+		cube := func(x uint8) int { return (int(x)*5 + 127) / 255 }
+		return fmt.Sprintf("\x1b[%d;48;5;%dm", fg, 16+36*cube(r)+6*cube(g)+cube(b))
+	}
+	return ""
+}
+
+// hexDumpLine holds the state needed to colour a single line.
+type hexDumpLine struct {
+	mode     ColourMode
+	buf      bytes.Buffer
+	current  Colour
+	coloured bool
+}
+
+func (l *hexDumpLine) colour(c Colour, ok bool) {
+	if l.mode == NoColours {
+		return
+	}
+
+	if !ok || c == White {
+		if l.coloured {
+			l.buf.WriteString("\x1b[0m")
+			l.coloured = false
+		}
+		return
+	}
+
+	if !l.coloured || c != l.current {
+		l.buf.WriteString(l.mode.escape(c))
+		l.coloured = true
+		l.current = c
+	}
+}
+
+func (l *hexDumpLine) reset() {
+	l.colour(White, false)
+}
+
+func printable(b byte) byte {
+	if b < 32 || b > 126 {
+		return '.'
+	}
+	return b
+}
+
+// WriteHexDump writes a hexdump of the bytes covered by value, colouring each byte by the fill
+// colour of the element it belongs to. Each line has a legend of the element names found on
+// that line. The bytes of any transformed Binaries follow, in their own hexdump.
+func WriteHexDump(w io.Writer, file io.ReaderAt, value *Value, mode ColourMode) error {
+	out := bufio.NewWriter(w)
+	if err := writeHexDump(out, file, value, value.Offset, value.Offset+value.Len, mode); err != nil {
+		return err
+	}
+	return out.Flush()
+}
+
+// writeHexDump writes a hexdump of the bytes [start, end) of file, coloured by value.
+func writeHexDump(out *bufio.Writer, file io.ReaderAt, value *Value, start, end int64, mode ColourMode) error {
+	spans := colourSpans(value, White, nil)
+
+	// Find the index of the span that contains this offset, assuming offsets only increase.
+	s := 0
+	spanAt := func(offset int64) int {
+		for s < len(spans) && spans[s].end <= offset {
+			s++
+		}
+		if s < len(spans) && spans[s].start <= offset {
+			return s
+		}
+		return -1
+	}
+
+	buf := make([]byte, hexDumpWidth)
+
+	// Align lines to the width, like most hexdump tools.
+	for line := start - start%hexDumpWidth; line < end; line += hexDumpWidth {
+		n, err := input.ReadFullAt(file, buf, line)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+
+		hex := &hexDumpLine{mode: mode}
+		ascii := &hexDumpLine{mode: mode}
+		prev := -1
+		var names []string
+
+		for i := 0; i < hexDumpWidth; i++ {
+			offset := line + int64(i)
+
+			if i == hexDumpWidth/2 {
+				hex.reset()
+				hex.buf.WriteByte(' ')
+			}
+
+			if offset < start || offset >= end || i >= n {
+				hex.reset()
+				hex.buf.WriteString("   ")
+				ascii.buf.WriteByte(' ')
+				continue
+			}
+
+			idx := spanAt(offset)
+			found := idx >= 0
+
+			var span colourSpan
+			if found {
+				span = spans[idx]
+				if idx != prev {
+					names = append(names, span.value.Name())
+				}
+			}
+
+			// The space before each byte is coloured if it continues the same span
+			if !found || idx != prev || i == hexDumpWidth/2 {
+				hex.reset()
+			}
+			hex.buf.WriteByte(' ')
+			prev = idx
+
+			hex.colour(span.colour, found)
+			fmt.Fprintf(&hex.buf, "%02x", buf[i])
+
+			ascii.colour(span.colour, found)
+			ascii.buf.WriteByte(printable(buf[i]))
+		}
+		hex.reset()
+		ascii.reset()
+
+		legend := ""
+		if len(names) > 0 {
+			legend = "  " + strings.Join(names, ", ")
+		}
+
+		if _, err := fmt.Fprintf(out, "%08x %s  |%s|%s\n", line, hex.buf.String(), ascii.buf.String(), legend); err != nil {
+			return err
+		}
+	}
+
+	for _, span := range spans {
+		t := span.value.Transformed()
+		if t == nil {
+			continue
+		}
+		if _, err := fmt.Fprintf(out, "\n%s => %s (%d bytes)\n", span.value.Name(), t.Value.Name(), len(t.Data)); err != nil {
+			return err
+		}
+		// All the transformed bytes, as the Value may not cover them all
+		if err := writeHexDump(out, t.Input(), t.Value, 0, int64(len(t.Data)), mode); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
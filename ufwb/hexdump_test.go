@@ -0,0 +1,59 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestWriteHexDump(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99">
+			<binary name="Magic" id="1" length="4" fillcolor="FF0000"/>
+			<string name="Text" id="2" type="fixed-length" length="14"/>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte("\x00\x01\x02\x03Hello, World!\n"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	var tests = []struct {
+		mode ColourMode
+		want string
+	}{
+		{
+			mode: NoColours,
+			want: "00000000  00 01 02 03 48 65 6c 6c  6f 2c 20 57 6f 72 6c 64  |....Hello, World|  Magic, Text\n" +
+				"00000010  21 0a                                             |!.              |  Text\n",
+		}, {
+			mode: TrueColours,
+			want: "00000000  \x1b[97;48;2;255;0;0m00 01 02 03\x1b[0m 48 65 6c 6c  6f 2c 20 57 6f 72 6c 64  |\x1b[97;48;2;255;0;0m....\x1b[0mHello, World|  Magic, Text\n" +
+				"00000010  21 0a                                             |!.              |  Text\n",
+		}, {
+			mode: Colours256,
+			want: "00000000  \x1b[97;48;5;196m00 01 02 03\x1b[0m 48 65 6c 6c  6f 2c 20 57 6f 72 6c 64  |\x1b[97;48;5;196m....\x1b[0mHello, World|  Magic, Text\n" +
+				"00000010  21 0a                                             |!.              |  Text\n",
+		},
+	}
+
+	for _, test := range tests {
+		var got bytes.Buffer
+		if err := WriteHexDump(&got, file, value, test.mode); err != nil {
+			t.Errorf("WriteHexDump(..., %d) error = %q want nil error", test.mode, err)
+			continue
+		}
+
+		if diff := pretty.Compare(got.String(), test.want); diff != "" {
+			t.Errorf("WriteHexDump(..., %d) = -got +want:\n%s", test.mode, diff)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package ufwb
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+
+	"bramp.net/dsector/input"
+)
+
+// htmlNode is a Value as displayed in the HTML report.
+type htmlNode struct {
+	Id          int
+	Name        string
+	Type        string
+	Description string
+	Offset      int64
+	Len         int64
+	End         int64
+	Formatted   string
+	Fixed       string
+	BadChecksum string
+	Colour      string
+
+	// Detached is true for nodes decoded from transformed bytes, which aren't in the hex view.
+	Detached bool
+
+	Children    []*htmlNode
+	Transformed *htmlNode // Decoded from this node's transformed bytes
+}
+
+// htmlByte is a single byte in the hex view.
+type htmlByte struct {
+	Hex    string
+	Node   int // Id of the leaf node, or -1
+	Colour string
+}
+
+type htmlRow struct {
+	Offset int64
+	Bytes  []htmlByte
+}
+
+type htmlReport struct {
+	Title string
+	Root  *htmlNode
+	Start int64
+	Rows  []htmlRow
+}
+
+// cssColour returns the CSS colour for this colour, or "" if it's the default.
+func cssColour(c Colour) string {
+	if c == White {
+		return ""
+	}
+	return fmt.Sprintf("#%06x", uint32(c))
+}
+
+// htmlNodes returns the tree of htmlNodes for this value, and a map from each leaf Value to
+// its node id.
+func htmlNodes(file io.ReaderAt, value *Value, ids map[*Value]int, nextId *int, detached bool) (*htmlNode, error) {
+	n := &htmlNode{
+		Id:          *nextId,
+		Name:        value.Name(),
+		Type:        elemType(value.Element),
+		Description: value.Description(),
+		Offset:      value.Offset,
+		Len:         value.Len,
+		End:         value.Offset + value.Len,
+		BadChecksum: badChecksum(value),
+		Colour:      cssColour(fillColour(value.Element)),
+		Detached:    detached,
+	}
+	ids[value] = n.Id
+	*nextId++
+
+	var err error
+	if n.Fixed, err = fixedName(file, value); err != nil {
+		return nil, err
+	}
+
+	if len(value.Children) == 0 {
+		s, err := value.Format(file)
+		if err != nil {
+			return nil, err
+		}
+		n.Formatted = s
+
+		if t := value.Transformed(); t != nil {
+			if n.Transformed, err = htmlNodes(t.Input(), t.Value, ids, nextId, true); err != nil {
+				return nil, err
+			}
+		}
+		return n, nil
+	}
+
+	for _, child := range value.Children {
+		c, err := htmlNodes(file, child, ids, nextId, detached)
+		if err != nil {
+			return nil, err
+		}
+		n.Children = append(n.Children, c)
+	}
+	return n, nil
+}
+
+// WriteHtml writes a self contained HTML report, with the value tree and a hex view of the
+// bytes it covers. Selecting a node highlights its bytes, and hovering over bytes highlights
+// the node they belong to. Values decoded from transformed Binaries are shown under the Binary,
+// but as their bytes aren't in the file, they aren't in the hex view.
+func WriteHtml(w io.Writer, file io.ReaderAt, value *Value, title string) error {
+	ids := make(map[*Value]int)
+	nextId := 0
+	root, err := htmlNodes(file, value, ids, &nextId, false)
+	if err != nil {
+		return err
+	}
+
+	report := &htmlReport{
+		Title: title,
+		Root:  root,
+		Start: value.Offset,
+	}
+
+	spans := colourSpans(value, White, nil)
+	s := 0
+
+	end := value.Offset + value.Len
+	buf := make([]byte, hexDumpWidth)
+	for line := value.Offset; line < end; line += hexDumpWidth {
+		n, err := input.ReadFullAt(file, buf, line)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return err
+		}
+		if int64(n) > end-line {
+			n = int(end - line)
+		}
+
+		row := htmlRow{Offset: line}
+		for i, b := range buf[:n] {
+			offset := line + int64(i)
+			for s < len(spans) && spans[s].end <= offset {
+				s++
+			}
+
+			hb := htmlByte{
+				Hex:  fmt.Sprintf("%02x", b),
+				Node: -1,
+			}
+			if s < len(spans) && spans[s].start <= offset {
+				hb.Node = ids[spans[s].value]
+				hb.Colour = cssColour(spans[s].colour)
+			}
+			row.Bytes = append(row.Bytes, hb)
+		}
+		report.Rows = append(report.Rows, row)
+	}
+
+	return htmlTemplate.Execute(w, report)
+}
+
+var htmlTemplate = template.Must(template.New("report").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 0; display: flex; height: 100vh; }
+#tree, #hex { overflow: auto; padding: 8px; }
+#tree { width: 45%; border-right: 1px solid #ccc; }
+#hex { flex: 1; font-family: monospace; white-space: pre; }
+ul { list-style: none; padding-left: 16px; margin: 0; }
+.node { cursor: pointer; padding: 1px 2px; border-left: 6px solid transparent; }
+.node:hover { background: #eef; }
+.node.selected, .node.hover { background: #ffd; outline: 1px solid #cc9; }
+.offset { color: #888; font-size: smaller; }
+.fixed { color: #060; }
+.bad { color: #c00; font-weight: bold; }
+.desc { color: #666; font-style: italic; }
+.transformed { border-left: 1px dashed #999; }
+.b { cursor: default; }
+.b.selected { outline: 1px solid #000; background: #ff8 !important; color: #000; }
+.b.hover { outline: 1px dotted #000; }
+#info { position: fixed; bottom: 0; right: 0; background: #fff; border: 1px solid #ccc; padding: 4px 8px; font-family: monospace; }
+</style>
+</head>
+<body>
+<div id="tree"><h3>{{.Title}}</h3><ul>{{template "node" .Root}}</ul></div>
+<div id="hex">{{range .Rows}}<span class="offset">{{printf "%08x" .Offset}}</span>  {{range .Bytes}}<span class="b" data-n="{{.Node}}"{{if .Colour}} style="background: {{.Colour}}"{{end}}>{{.Hex}}</span> {{end}}
+{{end}}</div>
+<div id="info"></div>
+<script>
+(function() {
+	var start = {{.Start}};
+	var bytes = document.querySelectorAll('#hex .b');
+	var nodes = document.querySelectorAll('#tree .node');
+	var info = document.getElementById('info');
+
+	function hex(n) { return '0x' + n.toString(16); }
+
+	function describe(node) {
+		var s = node.dataset.name + ' [' + hex(+node.dataset.start) + '-' + hex(+node.dataset.end) + ')';
+		if (node.dataset.fixed) s += ' fixed: ' + node.dataset.fixed;
+		if (node.dataset.desc) s += ' - ' + node.dataset.desc;
+		return s;
+	}
+
+	function mark(cls, from, to) {
+		document.querySelectorAll('#hex .b.' + cls).forEach(function(b) { b.classList.remove(cls); });
+		for (var i = from - start; i < to - start && i < bytes.length; i++) {
+			bytes[i].classList.add(cls);
+		}
+	}
+
+	nodes.forEach(function(node) {
+		node.addEventListener('click', function(e) {
+			e.stopPropagation();
+			document.querySelectorAll('#tree .node.selected').forEach(function(n) { n.classList.remove('selected'); });
+			node.classList.add('selected');
+			info.textContent = describe(node);
+			if (node.dataset.detached) {
+				mark('selected', 0, 0);
+				return;
+			}
+			mark('selected', +node.dataset.start, +node.dataset.end);
+			if (bytes[+node.dataset.start - start]) {
+				bytes[+node.dataset.start - start].scrollIntoView({block: 'nearest'});
+			}
+		});
+	});
+
+	bytes.forEach(function(b, i) {
+		b.addEventListener('mouseover', function() {
+			document.querySelectorAll('#tree .node.hover').forEach(function(n) { n.classList.remove('hover'); });
+			var node = document.getElementById('n' + b.dataset.n);
+			if (!node) {
+				info.textContent = hex(start + i);
+				return;
+			}
+			node.classList.add('hover');
+			node.scrollIntoView({block: 'nearest'});
+			mark('hover', +node.dataset.start, +node.dataset.end);
+			info.textContent = hex(start + i) + ' ' + describe(node);
+		});
+	});
+})();
+</script>
+</body>
+</html>
+{{define "node"}}<li><div class="node" id="n{{.Id}}" data-name="{{.Name}}" data-start="{{.Offset}}" data-end="{{.End}}" data-fixed="{{.Fixed}}" data-desc="{{.Description}}"{{if .Detached}} data-detached="1"{{end}}{{if .Colour}} style="border-left-color: {{.Colour}}"{{end}} title="{{.Type}}{{if .Description}}: {{.Description}}{{end}}">
+<b>{{.Name}}</b>{{if .Formatted}}: {{.Formatted}}{{end}}{{if .Fixed}} <span class="fixed">[{{.Fixed}}]</span>{{end}}{{if .BadChecksum}} <span class="bad">[{{.BadChecksum}}]</span>{{end}} <span class="offset">{{printf "0x%x" .Offset}} ({{.Len}} bytes)</span>{{if .Description}} <span class="desc">{{.Description}}</span>{{end}}</div>
+{{if .Children}}<ul>{{range .Children}}{{template "node" .}}{{end}}</ul>{{end}}{{with .Transformed}}<ul class="transformed">{{template "node" .}}</ul>{{end}}</li>{{end}}
+`))
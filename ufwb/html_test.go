@@ -0,0 +1,53 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriteHtml(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no" fillcolor="00FF00">
+			<binary name="Magic" id="1" length="2" fillcolor="FF0000">
+				<fixedvalue name="magic" value="cafe"/>
+			</binary>
+			<string name="Text" id="2" type="zero-terminated">
+				<description>Some &lt;text&gt;</description>
+			</string>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte("\xca\xfehi\x00"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHtml(&buf, file, value, "test.bin"); err != nil {
+		t.Fatalf("WriteHtml(...) error = %q want nil error", err)
+	}
+	got := buf.String()
+
+	for _, want := range []string{
+		"<title>test.bin</title>",
+		`data-name="Magic" data-start="0" data-end="2" data-fixed="magic"`,
+		`<span class="b" data-n="2" style="background: #ff0000">ca</span>`,
+		`<span class="b" data-n="3" style="background: #00ff00">68</span>`,
+		"Some &lt;text&gt;",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteHtml(...) does not contain %q", want)
+		}
+	}
+
+	if strings.Contains(got, "<text>") {
+		t.Errorf("WriteHtml(...) contains unescaped description")
+	}
+}
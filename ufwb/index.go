@@ -0,0 +1,133 @@
+package ufwb
+
+import (
+	"sort"
+	"strings"
+)
+
+// Index finds which Values cover a byte offset in the file.
+type Index struct {
+	root     *Value
+	children map[*Value]*indexChildren
+
+	transformed map[*Value]*Index // Indexes over the Values decoded from transformed Binaries
+}
+
+// indexChildren are the children of a Value, sorted by offset, excluding empty values. As
+// children may overlap, maxEnd[i] is the furthest end of children[0:i+1], which bounds how far
+// back a lookup needs to search.
+type indexChildren struct {
+	values []*Value
+	maxEnd []int64
+}
+
+// NewIndex builds a Index over the Value tree rooted at root.
+func NewIndex(root *Value) *Index {
+	idx := &Index{
+		root:        root,
+		children:    make(map[*Value]*indexChildren),
+		transformed: make(map[*Value]*Index),
+	}
+	idx.add(root)
+	return idx
+}
+
+func (idx *Index) add(value *Value) {
+	if t := value.Transformed(); t != nil {
+		idx.transformed[value] = NewIndex(t.Value)
+	}
+	if len(value.Children) == 0 {
+		return
+	}
+
+	var children []*Value
+	for _, child := range value.Children {
+		if child.Len > 0 {
+			children = append(children, child)
+		}
+		idx.add(child)
+	}
+
+	// Values are normally in file order, but Offset elements can move around.
+	sort.SliceStable(children, func(i, j int) bool {
+		return children[i].Offset < children[j].Offset
+	})
+
+	maxEnd := make([]int64, len(children))
+	for i, child := range children {
+		maxEnd[i] = child.Offset + child.Len
+		if i > 0 && maxEnd[i-1] > maxEnd[i] {
+			maxEnd[i] = maxEnd[i-1]
+		}
+	}
+	idx.children[value] = &indexChildren{values: children, maxEnd: maxEnd}
+}
+
+// At returns the inner most Value containing offset, preceded by all its ancestors. That is,
+// the first element is the root, and the last is the Value at offset. nil is returned if the
+// offset is outside the root.
+func (idx *Index) At(offset int64) []*Value {
+	return idx.Range(offset, 1)
+}
+
+// Range returns the inner most Value that contains all length bytes starting at offset,
+// preceded by all its ancestors. nil is returned if the range is outside the root.
+func (idx *Index) Range(offset, length int64) []*Value {
+	if length < 1 {
+		length = 1
+	}
+	end := offset + length
+
+	if !valueContains(idx.root, offset, end) {
+		return nil
+	}
+
+	chain := []*Value{idx.root}
+	for {
+		child := idx.child(chain[len(chain)-1], offset, end)
+		if child == nil {
+			return chain
+		}
+		chain = append(chain, child)
+	}
+}
+
+// Transformed returns a Index over the Value decoded from the transformed Binary value, or nil
+// if value was not transformed. Offsets in the returned Index are within the transformed bytes.
+func (idx *Index) Transformed(value *Value) *Index {
+	return idx.transformed[value]
+}
+
+// child returns the child of value containing [offset, end), or nil.
+func (idx *Index) child(value *Value, offset, end int64) *Value {
+	children, found := idx.children[value]
+	if !found {
+		return nil
+	}
+
+	// Find the last child starting at or before the offset.
+	i := sort.Search(len(children.values), func(i int) bool {
+		return children.values[i].Offset > offset
+	}) - 1
+
+	// Children may overlap, so keep looking backwards, until no earlier child reaches end.
+	for ; i >= 0 && children.maxEnd[i] >= end; i-- {
+		if valueContains(children.values[i], offset, end) {
+			return children.values[i]
+		}
+	}
+	return nil
+}
+
+func valueContains(value *Value, offset, end int64) bool {
+	return value.Offset <= offset && end <= value.Offset+value.Len
+}
+
+// PathOf returns the query path for the last Value in the chain, as returned by Index.At.
+func PathOf(chain []*Value) string {
+	var path []string
+	for i := 1; i < len(chain); i++ {
+		path = append(path, childPath(chain[i-1], chain[i]))
+	}
+	return strings.Join(path, "/")
+}
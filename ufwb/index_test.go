@@ -0,0 +1,102 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"strings"
+	"testing"
+)
+
+func TestIndex(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<structure name="Chunk" id="1" repeatmax="unlimited">
+				<number name="Length" id="2" type="integer" length="1"/>
+				<binary name="Data" id="3" length="prev.Length"/>
+			</structure>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte("\x02AB\x03CDE"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	idx := NewIndex(value)
+
+	tests := []struct {
+		offset, length int64
+		want           string
+		wantLen        int // Length of the chain
+	}{
+		{0, 1, "File/Chunk[0]/Length", 4},
+		{2, 1, "File/Chunk[0]/Data", 4},
+		{3, 1, "File/Chunk[1]/Length", 4},
+		{6, 1, "File/Chunk[1]/Data", 4},
+		{1, 2, "File/Chunk[0]/Data", 4},
+		{3, 2, "File/Chunk[1]", 3},
+		{2, 2, "File", 2},
+	}
+
+	for _, test := range tests {
+		chain := idx.Range(test.offset, test.length)
+		if chain == nil {
+			t.Errorf("idx.Range(%d, %d) = nil want %q", test.offset, test.length, test.want)
+			continue
+		}
+		if got := PathOf(chain); got != test.want {
+			t.Errorf("PathOf(idx.Range(%d, %d)) = %q want %q", test.offset, test.length, got, test.want)
+		}
+		if len(chain) != test.wantLen {
+			t.Errorf("len(idx.Range(%d, %d)) = %d want %d", test.offset, test.length, len(chain), test.wantLen)
+		}
+		if chain[0] != value {
+			t.Errorf("idx.Range(%d, %d)[0] = %v want root", test.offset, test.length, chain[0])
+		}
+	}
+
+	if chain := idx.At(7); chain != nil {
+		t.Errorf("idx.At(7) = %v want nil", chain)
+	}
+	if chain := idx.Range(6, 2); chain != nil {
+		t.Errorf("idx.Range(6, 2) = %v want nil", chain)
+	}
+}
+
+func TestIndexOverlapping(t *testing.T) {
+	leaf := func(name string, offset, length int64) *Value {
+		return &Value{Offset: offset, Len: length, Element: &Binary{Base: Base{name: name}}}
+	}
+
+	// Big overlaps the children after it, and there is a gap between Small and Last.
+	big := leaf("Big", 0, 10)
+	small := leaf("Small", 2, 2)
+	last := leaf("Last", 12, 4)
+	root := &Value{Offset: 0, Len: 20, Element: &Structure{Base: Base{name: "Root"}},
+		Children: []*Value{big, small, last},
+	}
+
+	idx := NewIndex(root)
+	tests := []struct {
+		offset int64
+		want   *Value
+	}{
+		{0, big},
+		{2, small},
+		{5, big}, // Found by looking back past Small
+		{10, root},
+		{11, root},
+		{13, last},
+		{17, root},
+	}
+	for _, test := range tests {
+		chain := idx.At(test.offset)
+		if got := chain[len(chain)-1]; got != test.want {
+			t.Errorf("idx.At(%d) = %s want %s", test.offset, got.Name(), test.want.Name())
+		}
+	}
+}
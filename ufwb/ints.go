@@ -5,6 +5,7 @@ import (
 	"encoding/binary"
 	"fmt"
 	"io"
+	"math"
 	"reflect"
 	"strconv"
 	"strings"
@@ -140,3 +141,57 @@ func formatInt(i interface{}, base int, bits int) (string, error) {
 
 	panic(fmt.Sprintf("unknown integer type %T", i))
 }
+
+// encodeInt returns the len bytes that represent the integer i in the given byte order. i may
+// be any int or uint type, and must fit within len bytes.
+func encodeInt(i interface{}, len int64, signed bool, order binary.ByteOrder) ([]byte, error) {
+	if order == nil {
+		return nil, fmt.Errorf("invalid order: nil")
+	}
+
+	bits := uint(len * 8)
+
+	var u uint64
+	switch v := reflect.ValueOf(i); v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n := v.Int()
+		if signed {
+			if bits < 64 && (n < -(1<<(bits-1)) || n >= 1<<(bits-1)) {
+				return nil, fmt.Errorf("%d does not fit in a %d bit signed number", n, bits)
+			}
+		} else if n < 0 || (bits < 64 && n >= 1<<bits) {
+			return nil, fmt.Errorf("%d does not fit in a %d bit unsigned number", n, bits)
+		}
+		u = uint64(n)
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u = v.Uint()
+		max := uint64(math.MaxUint64)
+		if signed {
+			max = 1<<(bits-1) - 1
+		} else if bits < 64 {
+			max = 1<<bits - 1
+		}
+		if u > max {
+			return nil, fmt.Errorf("%d does not fit in a %d bit number", u, bits)
+		}
+
+	default:
+		return nil, fmt.Errorf("%v (%T) is not a integer", i, i)
+	}
+
+	b := make([]byte, len)
+	switch len {
+	case 1:
+		b[0] = uint8(u)
+	case 2:
+		order.PutUint16(b, uint16(u))
+	case 4:
+		order.PutUint32(b, uint32(u))
+	case 8:
+		order.PutUint64(b, u)
+	default:
+		return nil, fmt.Errorf("unsupported number length: %d", len)
+	}
+	return b, nil
+}
@@ -0,0 +1,200 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"strconv"
+
+	"bramp.net/dsector/input"
+)
+
+// JsonValue is the JSON representation of a decoded Value.
+type JsonValue struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+	Id   int    `json:"id,omitempty"`
+
+	Path string `json:"path,omitempty"` // Only set on Values returned by a Query
+
+	Offset int64 `json:"offset"`
+	Len    int64 `json:"length"`
+
+	// Only set for Values without children
+	Raw       string      `json:"raw,omitempty"`       // Hex encoded bytes
+	Formatted string      `json:"formatted,omitempty"` // Same as Value.Format
+	Value     json.Number `json:"value,omitempty"`     // Only set for Numbers
+	Fixed     string      `json:"fixed,omitempty"`     // Name of the matching fixed value
+
+	Checksum *JsonChecksum `json:"checksum,omitempty"` // Only set for checksums
+
+	// Only set for transformed Binaries, the transformed bytes decoded. Offsets are relative to
+	// the transformed bytes.
+	Transformed *JsonValue `json:"transformed,omitempty"`
+
+	Children []*JsonValue `json:"children,omitempty"`
+}
+
+// JsonChecksum is the JSON representation of a Checksum.
+type JsonChecksum struct {
+	Algorithm string `json:"algorithm"`
+	Offset    int64  `json:"offset"`
+	Len       int64  `json:"length"`
+	Sum       string `json:"sum"` // Hex encoded computed checksum
+	Valid     bool   `json:"valid"`
+}
+
+// elemType returns the type name of this element, for example "Number".
+func elemType(e Element) string {
+	if b, ok := e.(interface {
+		GetBase() *Base
+	}); ok {
+		return b.GetBase().elemType
+	}
+	return ""
+}
+
+// fixedName returns the name of the fixed value this Value matches, or "". The fixed values
+// are checked even if the element doesn't require a match, as only then is Value.Extra set.
+func fixedName(file io.ReaderAt, value *Value) (string, error) {
+	switch fv := value.Extra.(type) {
+	case *FixedValue:
+		return fv.name, nil
+	case *FixedBinaryValue:
+		return fv.name, nil
+	case *FixedStringValue:
+		return fv.name, nil
+	}
+
+	switch e := value.Element.(type) {
+	case *Number:
+		if len(e.Values()) == 0 {
+			break
+		}
+		i, err := e.int(file, value)
+		if err != nil {
+			return "", err
+		}
+		for _, fv := range e.Values() {
+			if intEqual(fv.value, i) {
+				return fv.name, nil
+			}
+		}
+
+	case *Binary:
+		if len(e.Values()) == 0 {
+			break
+		}
+		b, err := e.Bytes(file, value)
+		if err != nil {
+			return "", err
+		}
+		for _, fv := range e.Values() {
+			if bytes.Equal(fv.value, b) {
+				return fv.name, nil
+			}
+		}
+
+	case *String:
+		if len(e.Values()) == 0 {
+			break
+		}
+		s, err := e.Format(file, value)
+		if err != nil {
+			return "", err
+		}
+		for _, fv := range e.Values() {
+			if fv.value == s {
+				return fv.name, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// NewJsonValue returns the JsonValue tree for this value, reading the raw bytes from file.
+func NewJsonValue(file io.ReaderAt, value *Value) (*JsonValue, error) {
+	j := &JsonValue{
+		Name:   value.Name(),
+		Type:   elemType(value.Element),
+		Id:     value.Element.Id(),
+		Offset: value.Offset,
+		Len:    value.Len,
+	}
+
+	var err error
+	if j.Fixed, err = fixedName(file, value); err != nil {
+		return nil, err
+	}
+
+	if c := value.Checksum; c != nil {
+		j.Checksum = &JsonChecksum{
+			Algorithm: c.Algorithm,
+			Offset:    c.Offset,
+			Len:       c.Len,
+			Sum:       hex.EncodeToString(c.Sum),
+			Valid:     c.Valid,
+		}
+	}
+
+	switch value.Element.(type) {
+	case *Grammar, *Structure, *StructRef:
+		for _, child := range value.Children {
+			c, err := NewJsonValue(file, child)
+			if err != nil {
+				return nil, err
+			}
+			j.Children = append(j.Children, c)
+		}
+		return j, nil
+	}
+
+	b := make([]byte, value.Len, value.Len)
+	if _, err := input.ReadFullAt(file, b, value.Offset); err != nil {
+		return nil, err
+	}
+	j.Raw = hex.EncodeToString(b)
+
+	s, err := value.Format(file)
+	if err != nil {
+		return nil, err
+	}
+	j.Formatted = s
+
+	if t := value.Transformed(); t != nil {
+		if j.Transformed, err = NewJsonValue(t.Input(), t.Value); err != nil {
+			return nil, err
+		}
+	}
+
+	if n, ok := value.Element.(*Number); ok {
+		if n.Signed() {
+			i, err := n.Int(file, value)
+			if err != nil {
+				return nil, err
+			}
+			j.Value = json.Number(strconv.FormatInt(i, 10))
+		} else {
+			i, err := n.Uint(file, value)
+			if err != nil {
+				return nil, err
+			}
+			j.Value = json.Number(strconv.FormatUint(i, 10))
+		}
+	}
+
+	return j, nil
+}
+
+// WriteJson writes the value tree as indented JSON to w.
+func WriteJson(w io.Writer, file io.ReaderAt, value *Value) error {
+	j, err := NewJsonValue(file, value)
+	if err != nil {
+		return err
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(j)
+}
@@ -0,0 +1,76 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"encoding/json"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestJsonValue(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<binary name="Magic" id="1" length="2">
+				<fixedvalue name="magic" value="cafe"/>
+			</binary>
+			<number name="Type" id="2" type="integer" length="1" display="hex">
+				<fixedvalue name="one" value="1"/>
+			</number>
+			<string name="Text" id="3" type="zero-terminated">
+				<fixedvalue name="greeting" value="hi"/>
+			</string>
+			<number name="Flags" id="4" type="integer" length="1" mustmatch="no">
+				<fixedvalue name="off" value="0"/>
+				<fixedvalue name="on" value="1"/>
+			</number>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte("\xca\xfe\x01hi\x00\x01"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	got, err := NewJsonValue(file, value)
+	if err != nil {
+		t.Fatalf("NewJsonValue(...) error = %q want nil error", err)
+	}
+
+	want := &JsonValue{
+		Name: "Test", Type: "Grammar", Offset: 0, Len: 7,
+		Children: []*JsonValue{{
+			Name: "File", Type: "Structure", Id: 99, Offset: 0, Len: 7,
+			Children: []*JsonValue{
+				{Name: "Magic", Type: "Binary", Id: 1, Offset: 0, Len: 2, Raw: "cafe", Formatted: "cafe (magic)", Fixed: "magic"},
+				{Name: "Type", Type: "Number", Id: 2, Offset: 2, Len: 1, Raw: "01", Formatted: "0x01 (one)", Value: "1", Fixed: "one"},
+				{Name: "Text", Type: "String", Id: 3, Offset: 3, Len: 3, Raw: "686900", Formatted: "hi", Fixed: "greeting"},
+				{Name: "Flags", Type: "Number", Id: 4, Offset: 6, Len: 1, Raw: "01", Formatted: "1", Value: "1", Fixed: "on"},
+			},
+		}},
+	}
+
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("NewJsonValue(...) = -got +want:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteJson(&buf, file, value); err != nil {
+		t.Fatalf("WriteJson(...) error = %q want nil error", err)
+	}
+
+	var decoded JsonValue
+	if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+		t.Fatalf("json.Unmarshal(WriteJson(...)) error = %q want nil error", err)
+	}
+
+	if diff := pretty.Compare(&decoded, want); diff != "" {
+		t.Errorf("json.Unmarshal(WriteJson(...)) = -got +want:\n%s", diff)
+	}
+}
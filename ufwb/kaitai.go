@@ -0,0 +1,686 @@
+package ufwb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// ksyMap is a YAML mapping, that keeps its keys in order.
+type ksyMap []ksyItem
+
+type ksyItem struct {
+	key   string
+	value interface{} // One of string, int64, uint64, bool, ksyFlow, ksyMap or []ksyMap
+}
+
+// ksyFlow is a list written on a single line, e.g. [0xca, 0xfe].
+type ksyFlow []string
+
+func (m *ksyMap) set(key string, value interface{}) {
+	*m = append(*m, ksyItem{key, value})
+}
+
+// kaitaiWriter converts a grammar into a Kaitai Struct .ksy document.
+type kaitaiWriter struct {
+	u      *Ufwb
+	issues []*LintIssue
+
+	endian   Endian // Default endian, from the start structure
+	encoding string // Default string encoding, from the start structure
+
+	typeNames map[*Structure]string
+	queue     []*Structure // Types referenced, but not yet written
+	types     ksyMap
+
+	enumNames map[string]bool
+	enums     ksyMap
+
+	fieldIds map[*Structure]map[string]string // Kaitai id of each element, by name
+}
+
+// WriteKaitai writes the grammar as a Kaitai Struct (http://kaitai.io) .ksy file to w. The
+// start structure becomes the top level type, and every structure it uses becomes a type.
+//
+// Not everything in a grammar can be expressed in Kaitai, for example scripts, custom elements
+// and structures with variable order. Such constructs are approximated or omitted, and
+// returned as issues. Issues with Error severity mean the .ksy won't decode the same as the
+// grammar.
+func WriteKaitai(w io.Writer, u *Ufwb) ([]*LintIssue, error) {
+	g := u.Grammar
+	if g == nil || g.Start == nil {
+		return nil, errors.New("grammar has no start structure")
+	}
+
+	k := &kaitaiWriter{
+		u:         u,
+		endian:    g.Start.Endian(),
+		encoding:  g.Start.Encoding(),
+		typeNames: make(map[*Structure]string),
+		enumNames: make(map[string]bool),
+		fieldIds:  make(map[*Structure]map[string]string),
+	}
+
+	var meta ksyMap
+	meta.set("id", snakeCase(g.Name()))
+	if g.Name() != "" {
+		meta.set("title", g.Name())
+	}
+	if exts := splitList(g.Ext); len(exts) > 0 {
+		meta.set("file-extension", ksyFlow(exts))
+	}
+	if g.Mime != "" {
+		meta.set("xref", ksyMap{{"mime", g.Mime}})
+	}
+	if e, ok := ksyEndian(k.endian); ok {
+		meta.set("endian", e)
+	} else {
+		k.add(Error, g.Start, "dynamic endian can't be expressed, using little endian")
+		k.endian = LittleEndian
+		meta.set("endian", "le")
+	}
+	meta.set("encoding", k.encoding)
+
+	// The start structure is written at the top level, which may only have one doc, so the
+	// grammar's description is merged with the start structure's.
+	var docs []string
+	if d := g.Description(); d != "" {
+		docs = append(docs, d)
+	}
+	var start ksyMap
+	for _, item := range k.structure(g.Start, k.endian) {
+		if item.key == "doc" {
+			docs = append(docs, item.value.(string))
+		} else {
+			start = append(start, item)
+		}
+	}
+
+	root := ksyMap{{"meta", meta}}
+	if len(docs) > 0 {
+		root.set("doc", strings.Join(docs, "\n\n"))
+	}
+	root = append(root, start...)
+
+	// Writing a type may reference more types
+	for len(k.queue) > 0 {
+		s := k.queue[0]
+		k.queue = k.queue[1:]
+		k.types.set(k.typeNames[s], k.structure(s, k.endian))
+	}
+
+	if len(k.types) > 0 {
+		root.set("types", k.types)
+	}
+	if len(k.enums) > 0 {
+		root.set("enums", k.enums)
+	}
+
+	var buf bytes.Buffer
+	writeKsy(&buf, root, 0)
+	_, err := w.Write(buf.Bytes())
+	return k.issues, err
+}
+
+func (k *kaitaiWriter) add(severity Severity, e ElementId, format string, args ...interface{}) {
+	k.issues = append(k.issues, &LintIssue{
+		Severity: severity,
+		Element:  e,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// snakeCase converts a name into a valid Kaitai or Lua identifier, e.g. "PNG File" to
+// "png_file".
+func snakeCase(name string) string {
+	var id []rune
+	for _, r := range strings.ToLower(name) {
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			id = append(id, r)
+		} else if len(id) > 0 && id[len(id)-1] != '_' {
+			id = append(id, '_')
+		}
+	}
+
+	s := strings.TrimRight(string(id), "_")
+	if s == "" {
+		return "unnamed"
+	}
+	if !unicode.IsLetter(rune(s[0])) {
+		return "n" + s
+	}
+	return s
+}
+
+// unique returns id, or if it is already used, id with a numeric suffix.
+func unique(id string, used map[string]bool) string {
+	s := id
+	for i := 2; used[s]; i++ {
+		s = id + "_" + strconv.Itoa(i)
+	}
+	used[s] = true
+	return s
+}
+
+func ksyEndian(e Endian) (string, bool) {
+	switch e {
+	case LittleEndian:
+		return "le", true
+	case BigEndian:
+		return "be", true
+	}
+	return "", false
+}
+
+// typeName returns the name of the Kaitai type for this structure, queuing it to be written.
+func (k *kaitaiWriter) typeName(s *Structure) string {
+	if name, found := k.typeNames[s]; found {
+		return name
+	}
+
+	used := make(map[string]bool)
+	for _, name := range k.typeNames {
+		used[name] = true
+	}
+
+	name := unique(snakeCase(s.Name()), used)
+	k.typeNames[s] = name
+	k.queue = append(k.queue, s)
+	return name
+}
+
+// ids returns the Kaitai id of each of the structure's elements, by name.
+func (k *kaitaiWriter) ids(s *Structure) map[string]string {
+	if ids, found := k.fieldIds[s]; found {
+		return ids
+	}
+
+	ids := make(map[string]string)
+	used := make(map[string]bool)
+	for _, e := range s.Elements() {
+		if _, found := ids[e.Name()]; !found {
+			ids[e.Name()] = unique(snakeCase(e.Name()), used)
+		}
+	}
+	k.fieldIds[s] = ids
+	return ids
+}
+
+// structure returns the meta, doc, seq and instances of the Kaitai type for this structure.
+func (k *kaitaiWriter) structure(s *Structure, endian Endian) ksyMap {
+	var m ksyMap
+
+	if s.Endian() != endian {
+		if e, ok := ksyEndian(s.Endian()); ok {
+			m.set("meta", ksyMap{{"endian", e}})
+		} else {
+			k.add(Error, s, "dynamic endian can't be expressed, using the parent's endian")
+		}
+	}
+	if d := s.Description(); d != "" {
+		m.set("doc", d)
+	}
+	if s.Order() == VariableOrder {
+		k.add(Error, s, "variable order can't be expressed, elements are decoded in fixed order")
+	}
+
+	var seq []ksyMap
+	var instances ksyMap
+	ids := k.ids(s)
+	for _, e := range s.Elements() {
+		id := ids[e.Name()]
+		fields := k.field(s, e, id)
+		seq = append(seq, fields...)
+
+		if n, ok := e.(*Number); ok {
+			instances = append(instances, k.masks(n, id, len(fields) > 0)...)
+		}
+	}
+
+	if len(seq) > 0 {
+		m.set("seq", seq)
+	}
+	if len(instances) > 0 {
+		m.set("instances", instances)
+	}
+	return m
+}
+
+// field returns the Kaitai fields for the element in structure s. Usually one field is
+// returned, but none if the element can't be expressed, and two for pascal strings.
+func (k *kaitaiWriter) field(s *Structure, e Element, id string) []ksyMap {
+	f := ksyMap{{"id", id}}
+
+	switch e := e.(type) {
+	case *Number:
+		if !k.number(s, e, id, &f) {
+			return nil
+		}
+
+	case *String:
+		if e.Typ() == "pascal" {
+			// Kaitai has no pascal strings, so the length is its own field
+			if !isOne(e) {
+				k.add(Error, e, "repeated pascal strings can't be expressed, omitting it")
+				return nil
+			}
+			lenId := id + "_len"
+			f.set("type", "str")
+			f.set("size", lenId)
+			if e.Encoding() != k.encoding {
+				f.set("encoding", e.Encoding())
+			}
+			if d := e.Description(); d != "" {
+				f.set("doc", d)
+			}
+			return []ksyMap{{{"id", lenId}, {"type", "u1"}}, f}
+		}
+		if !k.string(s, e, &f) {
+			return nil
+		}
+
+	case *Binary:
+		if !k.binary(s, e, &f) {
+			return nil
+		}
+
+	case *Structure:
+		f.set("type", k.typeName(e))
+		if e.Length() != nil {
+			if !k.size(s, e, &f) {
+				return nil
+			}
+		}
+
+	case *StructRef:
+		if e.Structure() == nil {
+			k.add(Error, e, "reference to a missing structure, omitting it")
+			return nil
+		}
+		f.set("type", k.typeName(e.Structure()))
+
+	case *Custom:
+		if e.Length() == nil {
+			k.add(Error, e, "custom elements can't be expressed, and without a length it can't be skipped, omitting it")
+			return nil
+		}
+		k.add(Error, e, "custom elements can't be expressed, reading it as raw bytes")
+		if !k.size(s, e, &f) {
+			return nil
+		}
+		return []ksyMap{f}
+
+	case *Script:
+		k.add(Error, e, "scripts can't be expressed, omitting it")
+		return nil
+
+	default:
+		k.add(Error, e, "%s elements can't be expressed, omitting it", elemType(e))
+		return nil
+	}
+
+	k.repeats(s, e, &f)
+	if d := e.Description(); d != "" {
+		f.set("doc", d)
+	}
+	return []ksyMap{f}
+}
+
+// number sets the type of a Number field, and an enum for its fixed values.
+func (k *kaitaiWriter) number(s *Structure, n *Number, id string, f *ksyMap) bool {
+	bits, ok := bitLength(n)
+	if !ok {
+		k.add(Error, n, "length %s can't be expressed for a number, omitting it", exprString(n.Length()))
+		return false
+	}
+
+	endian := ""
+	if n.Endian() != s.Endian() {
+		var ok bool
+		if endian, ok = ksyEndian(n.Endian()); !ok {
+			k.add(Error, n, "dynamic endian can't be expressed, using the structure's endian")
+		}
+	}
+
+	var typ string
+	switch n.Type {
+	case "integer":
+		switch {
+		case n.LengthUnit() == BitLengthUnit && (bits%8 != 0 || bits > 64):
+			if n.Signed() {
+				k.add(Warning, n, "signed bit fields can't be expressed, reading it as unsigned")
+			}
+			// Kaitai bit fields don't use the default endian, so always set it
+			bitEndian, _ := ksyEndian(n.Endian())
+			typ = "b" + strconv.FormatInt(bits, 10) + bitEndian
+
+		case bits == 8 || bits == 16 || bits == 32 || bits == 64:
+			sign := "u"
+			if n.Signed() {
+				sign = "s"
+			}
+			typ = sign + strconv.FormatInt(bits/8, 10)
+			if bits > 8 {
+				typ += endian
+			}
+
+		default:
+			k.add(Error, n, "%d bit integers can't be expressed, reading it as raw bytes", bits)
+			f.set("size", bits/8)
+			return true
+		}
+
+	case "float":
+		if bits != 32 && bits != 64 {
+			k.add(Error, n, "%d bit floats can't be expressed, reading it as raw bytes", bits)
+			f.set("size", bits/8)
+			return true
+		}
+		typ = "f" + strconv.FormatInt(bits/8, 10) + endian
+
+	default:
+		k.add(Error, n, "%q numbers can't be expressed, omitting it", n.Type)
+		return false
+	}
+	f.set("type", typ)
+
+	if n.Checksum() != "" {
+		k.add(Warning, n, "checksums can't be expressed, the %s won't be verified", n.Checksum())
+	}
+
+	if len(n.Values()) > 0 {
+		if n.Type != "integer" {
+			k.add(Warning, n, "fixed values of %s numbers can't be expressed as an enum, omitting them", n.Type)
+			return true
+		}
+		f.set("enum", k.enum(id, n.Values()))
+	}
+
+	return true
+}
+
+// enum adds a enum for the fixed values, returning its name.
+func (k *kaitaiWriter) enum(id string, values []*FixedValue) string {
+	name := unique(id, k.enumNames)
+
+	var m ksyMap
+	used := make(map[string]bool)
+	for _, v := range values {
+		key := fmt.Sprint(v.value)
+		if u, ok := v.value.(uint64); ok && u > math.MaxInt64 {
+			// Too large for a signed 64 bit decimal key, so write it in hex
+			key = fmt.Sprintf("0x%x", u)
+		}
+		m.set(key, unique(snakeCase(v.name), used))
+	}
+	k.enums.set(name, m)
+	return name
+}
+
+// masks returns a instance for each of the number's masks.
+func (k *kaitaiWriter) masks(n *Number, id string, ok bool) ksyMap {
+	var instances ksyMap
+	for _, m := range n.Masks() {
+		if !ok || !isOne(n) {
+			k.add(Warning, n, "mask %q can't be expressed on this number, omitting it", m.name)
+			continue
+		}
+		instances.set(id+"_"+snakeCase(m.name), ksyMap{{"value", fmt.Sprintf("%s & 0x%x", id, m.value)}})
+	}
+	return instances
+}
+
+// isOne returns true if the element is not repeated.
+func isOne(e Repeatable) bool {
+	return e.RepeatMin() == ConstExpression(1) && e.RepeatMax() == ConstExpression(1)
+}
+
+// string sets the type of a String field.
+func (k *kaitaiWriter) string(s *Structure, str *String, f *ksyMap) bool {
+	values := str.Values()
+	if len(values) == 1 && str.MustMatch().bool() && str.Typ() == "fixed-length" &&
+		str.Length() == ConstExpression(len(values[0].value)) && str.LengthUnit() == ByteLengthUnit {
+		f.set("contents", values[0].value)
+		return true
+	}
+	if len(values) > 0 {
+		k.add(Warning, str, "fixed values can't be expressed for strings, except a single value that must match")
+	}
+
+	switch str.Typ() {
+	case "zero-terminated":
+		f.set("type", "strz")
+	case "delimiter-terminated":
+		f.set("type", "str")
+		f.set("terminator", fmt.Sprintf("0x%02x", str.Delimiter()))
+	case "fixed-length":
+		f.set("type", "str")
+		if !k.size(s, str, f) {
+			return false
+		}
+	default:
+		k.add(Error, str, "%q strings can't be expressed, omitting it", str.Typ())
+		return false
+	}
+
+	if str.Encoding() != k.encoding {
+		f.set("encoding", str.Encoding())
+	}
+	return true
+}
+
+// binary sets the size, contents, and type of a Binary field.
+func (k *kaitaiWriter) binary(s *Structure, b *Binary, f *ksyMap) bool {
+	values := b.Values()
+	if len(values) == 1 && b.MustMatch().bool() {
+		var contents ksyFlow
+		for _, c := range values[0].value {
+			contents = append(contents, fmt.Sprintf("0x%02x", c))
+		}
+		f.set("contents", contents)
+		return true
+	}
+	if len(values) > 0 {
+		k.add(Warning, b, "fixed values can't be expressed for binaries, except a single value that must match")
+	}
+
+	if b.Structure() != nil {
+		f.set("type", k.typeName(b.Structure()))
+	}
+	if !k.size(s, b, f) {
+		return false
+	}
+
+	switch t := b.Transform(); {
+	case t == "":
+	case t == "zlib":
+		f.set("process", "zlib")
+	case strings.HasPrefix(t, "xor:"):
+		_, key, err := parseTransform(t)
+		if err != nil {
+			k.add(Error, b, "%s", err)
+			break
+		}
+		var bs []string
+		for _, c := range key {
+			bs = append(bs, fmt.Sprintf("0x%02x", c))
+		}
+		f.set("process", "xor(["+strings.Join(bs, ", ")+"])")
+	default:
+		k.add(Error, b, "transform %q can't be expressed, the bytes won't be transformed", t)
+	}
+
+	if b.Checksum() != "" {
+		k.add(Warning, b, "checksums can't be expressed, the %s won't be verified", b.Checksum())
+	}
+	return true
+}
+
+// size sets the size of the field from the element's length.
+func (k *kaitaiWriter) size(s *Structure, e Element, f *ksyMap) bool {
+	length := e.Length()
+	if length == StringExpression("remaining") {
+		f.set("size-eos", true)
+		return true
+	}
+
+	if e.LengthUnit() == BitLengthUnit {
+		bits, ok := length.(ConstExpression)
+		if !ok || bits%8 != 0 {
+			k.add(Error, e, "length of %s bits can't be expressed, omitting it", exprString(length))
+			return false
+		}
+		f.set("size", int64(bits/8))
+		return true
+	}
+
+	expr, ok := k.expr(s, e, "length", length)
+	if !ok {
+		return false
+	}
+	f.set("size", expr)
+	return true
+}
+
+// repeats sets the repeat of the field from the element's repeatmin and repeatmax.
+func (k *kaitaiWriter) repeats(s *Structure, e Element, f *ksyMap) {
+	if _, ok := e.(*Custom); ok || isOne(e) {
+		return
+	}
+
+	min, max := e.RepeatMin(), e.RepeatMax()
+	if max == StringExpression("unlimited") {
+		f.set("repeat", "eos")
+		return
+	}
+
+	if min != max {
+		k.add(Warning, e, "repeatmin %s can't be expressed, repeating repeatmax %s times", exprString(min), exprString(max))
+	}
+
+	expr, ok := k.expr(s, e, "repeatmax", max)
+	if !ok {
+		return
+	}
+	f.set("repeat", "expr")
+	f.set("repeat-expr", expr)
+}
+
+// expr converts the expression to Kaitai.
+func (k *kaitaiWriter) expr(s *Structure, e Element, attr string, expr Expression) (interface{}, bool) {
+	switch expr := expr.(type) {
+	case ConstExpression:
+		return int64(expr), true
+
+	case StringExpression:
+		str := string(expr)
+		if strings.HasPrefix(str, "prev.") {
+			name := strings.TrimPrefix(str, "prev.")
+
+			// Find the closest structure with that element
+			prefix := ""
+			for p := s; p != nil; p = p.parent {
+				if id, found := k.ids(p)[name]; found {
+					return prefix + id, true
+				}
+				prefix += "_parent."
+			}
+			k.add(Error, e, "%s %q references %q which is not in a enclosing structure", attr, str, name)
+			return nil, false
+		}
+	}
+
+	k.add(Error, e, "%s %s can't be expressed, omitting it", attr, exprString(expr))
+	return nil, false
+}
+
+// exprString returns the expression as it appears in a grammar.
+func exprString(expr Expression) string {
+	switch expr := expr.(type) {
+	case ConstExpression:
+		return strconv.FormatInt(int64(expr), 10)
+	case StringExpression:
+		return strconv.Quote(string(expr))
+	}
+	return "<nil>"
+}
+
+// splitList splits a comma or space separated list, such as a grammar's fileextension.
+func splitList(s string) []string {
+	return strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || unicode.IsSpace(r)
+	})
+}
+
+// writeKsy writes the value as YAML at the indent.
+func writeKsy(buf *bytes.Buffer, value interface{}, indent int) {
+	pad := strings.Repeat(" ", indent)
+
+	switch v := value.(type) {
+	case ksyMap:
+		for i, item := range v {
+			if i > 0 || buf.Len() == 0 || buf.Bytes()[buf.Len()-1] == '\n' {
+				buf.WriteString(pad)
+			}
+			buf.WriteString(ksyString(item.key))
+			buf.WriteString(":")
+
+			switch item.value.(type) {
+			case ksyMap:
+				buf.WriteString("\n")
+				writeKsy(buf, item.value, indent+2)
+			case []ksyMap:
+				buf.WriteString("\n")
+				writeKsy(buf, item.value, indent+2)
+			default:
+				buf.WriteString(" ")
+				writeKsy(buf, item.value, indent)
+				buf.WriteString("\n")
+			}
+		}
+
+	case []ksyMap:
+		for _, m := range v {
+			buf.WriteString(pad)
+			buf.WriteString("- ")
+			writeKsy(buf, m, indent+2)
+		}
+
+	case ksyFlow:
+		buf.WriteString("[" + strings.Join(v, ", ") + "]")
+
+	case string:
+		buf.WriteString(ksyString(v))
+
+	default:
+		fmt.Fprint(buf, v)
+	}
+}
+
+// ksyString returns the string as a YAML scalar, quoting it if needed.
+func ksyString(s string) string {
+	if _, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return s
+	}
+
+	plain := s != ""
+	for i, r := range s {
+		if !(r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) || r == '_' || (i > 0 && strings.ContainsRune(".-/ ", r))) {
+			plain = false
+			break
+		}
+	}
+	switch strings.ToLower(s) {
+	case "yes", "no", "true", "false", "on", "off", "null", "y", "n", "~":
+		plain = false
+	}
+	if plain && !strings.HasSuffix(s, " ") {
+		return s
+	}
+	return strconv.Quote(s)
+}
@@ -0,0 +1,212 @@
+package ufwb
+
+import (
+	"bytes"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+const kaitaiTestGrammar = `<ufwb>
+<grammar name="Test File" start="id:1" fileextension="tst,test" mimetype="application/x-test">
+	<description>A test grammar</description>
+	<structure name="File" id="1" endian="big">
+		<binary name="Magic" id="2" length="2">
+			<fixedvalue name="magic" value="CAFE"/>
+		</binary>
+		<number name="Type" id="3" type="integer" length="2" endian="little">
+			<fixedvalue name="PNG" value="1"/>
+			<fixedvalue name="JPEG" value="2"/>
+			<mask name="Flags" value="0xF0"/>
+		</number>
+		<number name="Count" id="4" type="integer" length="1" signed="no"/>
+		<structure name="Record" id="5" repeatmin="prev.Count" repeatmax="prev.Count">
+			<number name="Length" id="6" type="integer" length="4"/>
+			<string name="Text" id="7" type="fixed-length" length="prev.Length" encoding="UTF-16LE"/>
+			<number name="Values" id="8" type="float" length="8" repeatmin="0" repeatmax="prev.Count"/>
+		</structure>
+		<string name="Name" id="9" type="zero-terminated"/>
+		<string name="Label" id="10" type="pascal"/>
+		<structref name="Trailer" id="11" structure="id:12" repeatmax="unlimited"/>
+		<scriptelement name="Check" id="13">
+			<script name="Check"><source language="Lua">print(1)</source></script>
+		</scriptelement>
+	</structure>
+	<structure name="Trailer" id="12" order="variable" endian="little">
+		<number name="Size" id="14" type="integer" length="3"/>
+		<binary name="Data" id="15" length="remaining" transform="xor:AA55"/>
+	</structure>
+</grammar>
+</ufwb>`
+
+func TestWriteKaitai(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(kaitaiTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	issues, err := WriteKaitai(&buf, u)
+	if err != nil {
+		t.Fatalf("WriteKaitai(...) = %q want nil error", err)
+	}
+
+	want := `meta:
+  id: test_file
+  title: Test File
+  file-extension: [tst, test]
+  xref:
+    mime: application/x-test
+  endian: be
+  encoding: UTF-8
+doc: A test grammar
+seq:
+  - id: magic
+    contents: [0xca, 0xfe]
+  - id: type
+    type: s2le
+    enum: type
+  - id: count
+    type: u1
+  - id: record
+    type: record
+    repeat: expr
+    repeat-expr: count
+  - id: name
+    type: strz
+  - id: label_len
+    type: u1
+  - id: label
+    type: str
+    size: label_len
+  - id: trailer
+    type: trailer
+    repeat: eos
+instances:
+  type_flags:
+    value: "type & 0xf0"
+types:
+  record:
+    seq:
+      - id: length
+        type: s4
+      - id: text
+        type: str
+        size: length
+        encoding: UTF-16LE
+      - id: values
+        type: f8
+        repeat: expr
+        repeat-expr: _parent.count
+  trailer:
+    meta:
+      endian: le
+    seq:
+      - id: size
+        size: 3
+      - id: data
+        size-eos: true
+        process: "xor([0xaa, 0x55])"
+enums:
+  type:
+    1: png
+    2: jpeg
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteKaitai(...) =\n%s\nwant:\n%s", got, want)
+	}
+
+	var got []string
+	for _, issue := range issues {
+		got = append(got, issue.Error())
+	}
+	wantIssues := []string{
+		`22:3: error: <*ufwb.Script id=13 name="Check">: scripts can't be expressed, omitting it`,
+		`17:4: warning: <*ufwb.Number id=8 name="Values">: repeatmin 0 can't be expressed, repeating repeatmax "prev.Count" times`,
+		`26:2: error: <*ufwb.Structure id=12 name="Trailer">: variable order can't be expressed, elements are decoded in fixed order`,
+		`27:3: error: <*ufwb.Number id=14 name="Size">: 24 bit integers can't be expressed, reading it as raw bytes`,
+	}
+	if diff := pretty.Compare(got, wantIssues); diff != "" {
+		t.Errorf("WriteKaitai(...) issues = -got +want:\n%s", diff)
+	}
+}
+
+func TestWriteKaitaiLargeEnum(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<number name="Id" id="1" type="integer" length="8">
+				<fixedvalue name="small" value="1"/>
+				<fixedvalue name="max" value="0xFFFFFFFFFFFFFFFF"/>
+			</number>
+		</structure>` + testFooter
+
+	u, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteKaitai(&buf, u); err != nil {
+		t.Fatalf("WriteKaitai(...) = %q want nil error", err)
+	}
+
+	want := `enums:
+  id:
+    1: small
+    0xffffffffffffffff: max
+`
+	if !strings.HasSuffix(buf.String(), want) {
+		t.Errorf("WriteKaitai(...) = %q want suffix %q", buf.String(), want)
+	}
+}
+
+func TestWriteKaitaiDoc(t *testing.T) {
+	xml := `<ufwb><grammar name="Test" start="99">
+		<description>The grammar</description>
+		<structure name="File" id="99" endian="big">
+			<description>The file</description>
+			<number name="Id" id="1" type="integer" length="1"/>
+		</structure>` + testFooter
+
+	u, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteKaitai(&buf, u); err != nil {
+		t.Fatalf("WriteKaitai(...) = %q want nil error", err)
+	}
+
+	// Only one top level doc is allowed, so the two descriptions are merged.
+	want := `meta:
+  id: test
+  title: Test
+  endian: be
+  encoding: UTF-8
+doc: "The grammar\n\nThe file"
+seq:
+  - id: id
+    type: s1
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteKaitai(...) =\n%s\nwant:\n%s", got, want)
+	}
+}
+
+func TestSnakeCase(t *testing.T) {
+	tests := map[string]string{
+		"PNG File":   "png_file",
+		"Count":      "count",
+		"a--b__c":    "a_b_c",
+		"1st":        "n1st",
+		"Größe":      "gr_e",
+		"":           "unnamed",
+		"  spaced  ": "spaced",
+	}
+	for name, want := range tests {
+		if got := snakeCase(name); got != want {
+			t.Errorf("snakeCase(%q) = %q want %q", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package ufwb
+
+import (
+	"bufio"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// GrammarsEnv is the environment variable listing the directories to load grammars from,
+// separated by the os.PathListSeparator.
+const GrammarsEnv = "DSECTOR_GRAMMARS"
+
+// Library is a set of grammars, indexed by name, file extension, UTI and mime type. Grammars
+// are only parsed when first used.
+//
+// Grammars can be loaded from directories, or embedded in the binary, for example:
+//
+//	//go:embed grammars/*.grammar
+//	var grammars embed.FS
+//
+//	lib := ufwb.NewLibrary()
+//	lib.AddFS(grammars, "grammars")
+type Library struct {
+	mu sync.Mutex
+
+	entries []*libraryEntry
+	byName  map[string]*libraryEntry // By lower cased file name and grammar name
+	byExt   map[string][]*libraryEntry
+	byUti   map[string][]*libraryEntry
+	byMime  map[string][]*libraryEntry
+}
+
+// libraryEntry is a single grammar in the Library.
+type libraryEntry struct {
+	name string // File name, without the .grammar extension
+	path string
+	fsys fs.FS // nil if path is on the OS filesystem
+
+	grammar string // Attributes from the <grammar> element
+	exts    []string
+	uti     string
+	mime    string
+
+	loaded bool
+	u      *Ufwb
+	err    error
+}
+
+// LibraryError is returned for a grammar in the Library that failed to load.
+type LibraryError struct {
+	Name string
+	Path string
+	Errs []error
+}
+
+func (e *LibraryError) Error() string {
+	if len(e.Errs) == 1 {
+		return fmt.Sprintf("grammar %q: %s", e.Path, e.Errs[0])
+	}
+	return fmt.Sprintf("grammar %q: %s (and %d more errors)", e.Path, e.Errs[0], len(e.Errs)-1)
+}
+
+// NewLibrary returns a empty Library.
+func NewLibrary() *Library {
+	return &Library{
+		byName: make(map[string]*libraryEntry),
+		byExt:  make(map[string][]*libraryEntry),
+		byUti:  make(map[string][]*libraryEntry),
+		byMime: make(map[string][]*libraryEntry),
+	}
+}
+
+// LibraryDirs returns the directories to load grammars from. These are taken from the
+// DSECTOR_GRAMMARS environment variable, otherwise the dsector/grammars config file, which
+// lists one directory per line, otherwise the "grammars" directory.
+func LibraryDirs() ([]string, error) {
+	if env := os.Getenv(GrammarsEnv); env != "" {
+		return filepath.SplitList(env), nil
+	}
+
+	if config, err := os.UserConfigDir(); err == nil {
+		dirs, err := readLibraryConfig(filepath.Join(config, "dsector", "grammars"))
+		if err == nil {
+			return dirs, nil
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	return []string{"grammars"}, nil
+}
+
+// readLibraryConfig returns the directories listed in the config file, ignoring blank lines
+// and comments starting with #.
+func readLibraryConfig(filename string) ([]string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var dirs []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dirs = append(dirs, line)
+	}
+	return dirs, scanner.Err()
+}
+
+// DefaultLibrary returns a Library of the grammars found in LibraryDirs. Directories that do
+// not exist are skipped.
+func DefaultLibrary() (*Library, error) {
+	dirs, err := LibraryDirs()
+	if err != nil {
+		return nil, err
+	}
+
+	lib := NewLibrary()
+	for _, dir := range dirs {
+		if err := lib.AddDir(dir); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	return lib, nil
+}
+
+// AddDir indexes every .grammar file in the directory.
+func (lib *Library) AddDir(dir string) error {
+	if _, err := os.Stat(dir); err != nil {
+		return err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.grammar"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		lib.addFile(nil, p)
+	}
+	return nil
+}
+
+// AddFS indexes every .grammar file in the directory of fsys, such as a embed.FS.
+func (lib *Library) AddFS(fsys fs.FS, dir string) error {
+	paths, err := fs.Glob(fsys, path.Join(dir, "*.grammar"))
+	if err != nil {
+		return err
+	}
+	for _, p := range paths {
+		lib.addFile(fsys, p)
+	}
+	return nil
+}
+
+// Add adds a already parsed grammar, such as one built in Go.
+func (lib *Library) Add(name string, u *Ufwb) {
+	e := &libraryEntry{
+		name:   name,
+		path:   name,
+		loaded: true,
+		u:      u,
+	}
+	if g := u.Grammar; g != nil {
+		e.grammar, e.exts, e.uti, e.mime = g.Name(), g.Extensions(), g.Uti, g.Mime
+	}
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+	lib.index(e)
+}
+
+func (lib *Library) addFile(fsys fs.FS, p string) {
+	e := &libraryEntry{
+		name: strings.TrimSuffix(path.Base(filepath.ToSlash(p)), ".grammar"),
+		path: p,
+		fsys: fsys,
+	}
+
+	err := e.readHeader()
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+	if err != nil {
+		e.loaded, e.err = true, &LibraryError{Name: e.name, Path: e.path, Errs: []error{err}}
+	}
+	lib.index(e)
+}
+
+// index adds the entry to the indexes. Must be called with mu held.
+func (lib *Library) index(e *libraryEntry) {
+	lib.entries = append(lib.entries, e)
+
+	for _, name := range []string{e.name, e.grammar} {
+		name = strings.ToLower(name)
+		if _, found := lib.byName[name]; name != "" && !found {
+			lib.byName[name] = e
+		}
+	}
+	for _, ext := range e.exts {
+		lib.byExt[ext] = append(lib.byExt[ext], e)
+	}
+	if e.uti != "" {
+		lib.byUti[e.uti] = append(lib.byUti[e.uti], e)
+	}
+	if e.mime != "" {
+		lib.byMime[e.mime] = append(lib.byMime[e.mime], e)
+	}
+}
+
+func (e *libraryEntry) open() (io.ReadCloser, error) {
+	if e.fsys != nil {
+		return e.fsys.Open(e.path)
+	}
+	return os.Open(e.path)
+}
+
+// readHeader reads the attributes of the <grammar> element, without parsing the whole file.
+func (e *libraryEntry) readHeader() error {
+	f, err := e.open()
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return fmt.Errorf("no grammar element found")
+		}
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "grammar" {
+			continue
+		}
+
+		for _, attr := range start.Attr {
+			switch attr.Name.Local {
+			case "name":
+				e.grammar = attr.Value
+			case "fileextension":
+				e.exts = (&Grammar{Ext: attr.Value}).Extensions()
+			case "uti":
+				e.uti = attr.Value
+			case "mimetype":
+				e.mime = attr.Value
+			}
+		}
+		return nil
+	}
+}
+
+// load parses the grammar, if it hasn't been already. Must be called with mu held.
+func (e *libraryEntry) load() (*Ufwb, error) {
+	if e.loaded {
+		return e.u, e.err
+	}
+	e.loaded = true
+
+	f, err := e.open()
+	if err != nil {
+		e.err = &LibraryError{Name: e.name, Path: e.path, Errs: []error{err}}
+		return nil, e.err
+	}
+	defer f.Close()
+
+	u, errs := ParseXmlGrammar(f)
+	if len(errs) > 0 {
+		e.err = &LibraryError{Name: e.name, Path: e.path, Errs: errs}
+		return nil, e.err
+	}
+	e.u = u
+	return u, nil
+}
+
+// Names returns the sorted file names of all the grammars.
+func (lib *Library) Names() []string {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var names []string
+	for _, e := range lib.entries {
+		names = append(names, e.name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Get returns the grammar with this file name (without the .grammar extension) or grammar
+// name, case insensitively, parsing it if needed.
+func (lib *Library) Get(name string) (*Ufwb, error) {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	e, found := lib.byName[strings.ToLower(name)]
+	if !found {
+		return nil, fmt.Errorf("grammar %q not found", name)
+	}
+	return e.load()
+}
+
+// ByExtension returns the names of the grammars for this file extension.
+func (lib *Library) ByExtension(ext string) []string {
+	return lib.names(lib.byExt, strings.ToLower(strings.TrimPrefix(ext, ".")))
+}
+
+// ByUti returns the names of the grammars for this Uniform Type Identifier.
+func (lib *Library) ByUti(uti string) []string {
+	return lib.names(lib.byUti, uti)
+}
+
+// ByMime returns the names of the grammars for this mime type.
+func (lib *Library) ByMime(mime string) []string {
+	return lib.names(lib.byMime, mime)
+}
+
+func (lib *Library) names(index map[string][]*libraryEntry, key string) []string {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var names []string
+	for _, e := range index[key] {
+		names = append(names, e.name)
+	}
+	return names
+}
+
+// LoadAll parses every grammar, returning a error for each that failed.
+func (lib *Library) LoadAll() []error {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var errs []error
+	for _, e := range lib.entries {
+		if _, err := e.load(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// Errors returns the errors for the grammars that have failed to load so far.
+func (lib *Library) Errors() []error {
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	var errs []error
+	for _, e := range lib.entries {
+		if e.err != nil {
+			errs = append(errs, e.err)
+		}
+	}
+	return errs
+}
+
+// Detector parses every grammar, and returns a Detector for those that loaded, along with the
+// errors for those that failed.
+func (lib *Library) Detector() (*Detector, []error) {
+	errs := lib.LoadAll()
+
+	lib.mu.Lock()
+	defer lib.mu.Unlock()
+
+	d := NewDetector()
+	for _, e := range lib.entries {
+		if e.u != nil {
+			d.Add(e.name, e.u)
+		}
+	}
+	return d, errs
+}
@@ -0,0 +1,132 @@
+package ufwb
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const libraryTestGrammar = `<ufwb><grammar name="Java Class" start="99" fileextension="class" uti="com.sun.java-class" mimetype="application/java-vm">
+	<structure name="File" id="99"/>
+</grammar></ufwb>`
+
+func TestLibrary(t *testing.T) {
+	dir, err := ioutil.TempDir("", "library")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"java.grammar":   libraryTestGrammar,
+		"broken.grammar": `<ufwb><grammar name="Broken" start="404" fileextension="bad"></grammar></ufwb>`,
+		"ignored.txt":    "not a grammar",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	lib := NewLibrary()
+	if err := lib.AddDir(dir); err != nil {
+		t.Fatalf("lib.AddDir(...) error = %q want nil error", err)
+	}
+
+	if diff := pretty.Compare(lib.Names(), []string{"broken", "java"}); diff != "" {
+		t.Errorf("lib.Names() = -got +want:\n%s", diff)
+	}
+
+	// Nothing is parsed until it is used
+	if errs := lib.Errors(); len(errs) != 0 {
+		t.Errorf("lib.Errors() = %q want no errors", errs)
+	}
+
+	for _, name := range []string{"java", "Java Class", "JAVA"} {
+		if g, err := lib.Get(name); err != nil || g.Grammar.Name() != "Java Class" {
+			t.Errorf("lib.Get(%q) = %v, %v want Java Class", name, g, err)
+		}
+	}
+	if _, err := lib.Get("missing"); err == nil {
+		t.Errorf("lib.Get(missing) error = nil want error")
+	}
+
+	if got := lib.ByExtension(".CLASS"); len(got) != 1 || got[0] != "java" {
+		t.Errorf("lib.ByExtension(.CLASS) = %q want [java]", got)
+	}
+	if got := lib.ByUti("com.sun.java-class"); len(got) != 1 || got[0] != "java" {
+		t.Errorf("lib.ByUti(...) = %q want [java]", got)
+	}
+	if got := lib.ByMime("application/java-vm"); len(got) != 1 || got[0] != "java" {
+		t.Errorf("lib.ByMime(...) = %q want [java]", got)
+	}
+	if got := lib.ByExtension("bad"); len(got) != 1 || got[0] != "broken" {
+		t.Errorf("lib.ByExtension(bad) = %q want [broken]", got)
+	}
+
+	errs := lib.LoadAll()
+	if len(errs) != 1 {
+		t.Fatalf("lib.LoadAll() = %q want one error", errs)
+	}
+	if err, ok := errs[0].(*LibraryError); !ok || err.Name != "broken" {
+		t.Errorf("lib.LoadAll() = %#v want a LibraryError for broken", errs[0])
+	}
+	if errs := lib.Errors(); len(errs) != 1 {
+		t.Errorf("lib.Errors() = %q want one error", errs)
+	}
+
+	d, errs := lib.Detector()
+	if d.Len() != 1 || len(errs) != 1 {
+		t.Errorf("lib.Detector() = %d grammars, %q want 1 grammar and 1 error", d.Len(), errs)
+	}
+}
+
+func TestLibraryFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"grammars/java.grammar": {Data: []byte(libraryTestGrammar)},
+		"other/skip.grammar":    {Data: []byte("<broken")},
+	}
+
+	lib := NewLibrary()
+	if err := lib.AddFS(fsys, "grammars"); err != nil {
+		t.Fatalf("lib.AddFS(...) error = %q want nil error", err)
+	}
+	if diff := pretty.Compare(lib.Names(), []string{"java"}); diff != "" {
+		t.Errorf("lib.Names() = -got +want:\n%s", diff)
+	}
+	if _, err := lib.Get("java"); err != nil {
+		t.Errorf("lib.Get(java) error = %q want nil error", err)
+	}
+}
+
+func TestLibraryDirs(t *testing.T) {
+	t.Setenv(GrammarsEnv, strings.Join([]string{"a", "b"}, string(os.PathListSeparator)))
+	if dirs, err := LibraryDirs(); err != nil || len(dirs) != 2 || dirs[0] != "a" || dirs[1] != "b" {
+		t.Errorf("LibraryDirs() = %q, %v want [a b]", dirs, err)
+	}
+
+	config, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(config)
+
+	if err := os.MkdirAll(filepath.Join(config, "dsector"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(config, "dsector", "grammars"), []byte("# Comment\n/x\n\n/y\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Setenv(GrammarsEnv, "")
+	t.Setenv("XDG_CONFIG_HOME", config)
+	t.Setenv("HOME", config)
+	t.Setenv("AppData", config)
+	if dirs, err := LibraryDirs(); err != nil || len(dirs) != 2 || dirs[0] != "/x" || dirs[1] != "/y" {
+		t.Errorf("LibraryDirs() = %q, %v want [/x /y]", dirs, err)
+	}
+}
@@ -0,0 +1,315 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/toerr"
+	"fmt"
+	"strings"
+)
+
+// Severity of a LintIssue.
+type Severity int
+
+const (
+	// Warning is for something that is likely a mistake, but the grammar can still decode.
+	Warning Severity = iota
+	// Error is for something that will cause decoding to fail, or decode incorrectly.
+	Error
+)
+
+func (s Severity) String() string {
+	switch s {
+	case Warning:
+		return "warning"
+	case Error:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// LintIssue is a problem found in a grammar by Lint.
+type LintIssue struct {
+	Severity Severity
+	Element  ElementId
+	Message  string
+}
+
+// Pos returns where in the grammar file the issue is, or nil if not known.
+func (i *LintIssue) Pos() *Position {
+	return posOf(i.Element)
+}
+
+func (i *LintIssue) Error() string {
+	prefix := ""
+	if pos := i.Pos(); pos != nil {
+		prefix = pos.String() + ": "
+	}
+	if i.Element == nil {
+		return fmt.Sprintf("%s%s: %s", prefix, i.Severity, i.Message)
+	}
+	return fmt.Sprintf("%s%s: <%T id=%d name=%q>: %s", prefix, i.Severity, i.Element, i.Element.Id(), i.Element.Name(), i.Message)
+}
+
+type linter struct {
+	u      *Ufwb
+	issues []*LintIssue
+
+	numbers map[string]bool // Names of all Numbers
+	others  map[string]bool // Names of all other Elements
+}
+
+func (l *linter) add(severity Severity, e ElementId, format string, args ...interface{}) {
+	l.issues = append(l.issues, &LintIssue{
+		Severity: severity,
+		Element:  e,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// Lint checks a parsed grammar for problems that ParseXmlGrammar does not catch, such as
+// expressions that reference missing elements, unreachable structures, impossible repeats,
+// fixed values too large for their number, and attributes the decoder ignores. Problems
+// ParseXmlGrammar already reports, such as extends loops, are not repeated.
+func Lint(u *Ufwb) []*LintIssue {
+	l := &linter{
+		u:       u,
+		numbers: make(map[string]bool),
+		others:  make(map[string]bool),
+	}
+
+	Walk(u, func(u *Ufwb, e Element, parent *Structure, _ *toerr.Errors) {
+		if _, ok := e.(*Number); ok {
+			l.numbers[e.Name()] = true
+		} else {
+			l.others[e.Name()] = true
+		}
+	})
+
+	l.unreachable()
+
+	Walk(u, func(u *Ufwb, e Element, parent *Structure, _ *toerr.Errors) {
+		if _, ok := e.(*Grammar); ok {
+			return
+		}
+		l.expressions(e, parent)
+		l.repeats(e)
+		l.fixedValues(e)
+		l.ignored(e)
+	})
+
+	return l.issues
+}
+
+// unreachable reports top level structures that can't be reached from the start structure.
+func (l *linter) unreachable() {
+	g := l.u.Grammar
+	if g.Start == nil {
+		return
+	}
+
+	reached := make(map[*Structure]bool)
+	var visit func(s *Structure)
+	visit = func(s *Structure) {
+		if s == nil || reached[s] {
+			return
+		}
+		reached[s] = true
+		visit(s.derives)
+
+		for _, e := range s.elements {
+			switch e := e.(type) {
+			case *Structure:
+				visit(e)
+			case *StructRef:
+				visit(e.structure)
+			case *Binary:
+				visit(e.structure)
+			}
+		}
+	}
+	visit(g.Start)
+
+	for _, e := range g.Elements {
+		if s, ok := e.(*Structure); ok && !reached[s] {
+			l.add(Warning, s, "structure is not reachable from the start structure")
+		}
+	}
+}
+
+// expressions reports expressions the decoder can't evaluate.
+func (l *linter) expressions(e Element, parent *Structure) {
+	check := func(attr string, expr Expression) {
+		str, ok := expr.(StringExpression)
+		if !ok {
+			return
+		}
+
+		switch s := string(str); {
+		case s == "unlimited":
+		case s == "remaining":
+			// Remaining is relative to the length of the enclosing structure
+			if parent == nil || parent.Length() == nil {
+				l.add(Error, e, "%s %q requires the enclosing structure to have a length", attr, s)
+			}
+		case strings.HasPrefix(s, "prev."):
+			name := strings.TrimPrefix(s, "prev.")
+			if !l.numbers[name] {
+				if l.others[name] {
+					l.add(Error, e, "%s %q references %q which is not a number", attr, s, name)
+				} else {
+					l.add(Error, e, "%s %q references %q which does not exist", attr, s, name)
+				}
+			}
+		default:
+			l.add(Error, e, "%s %q is not a expression the decoder supports", attr, s)
+		}
+	}
+
+	switch e.(type) {
+	case *StructRef, *GrammarRef, *Script:
+		// Length comes from the referenced element
+	default:
+		check("length", e.Length())
+	}
+	if _, ok := e.(*Custom); !ok {
+		check("repeatmin", e.RepeatMin())
+		check("repeatmax", e.RepeatMax())
+	}
+}
+
+// repeats reports repeats where the minimum is greater than the maximum.
+func (l *linter) repeats(e Element) {
+	if _, ok := e.(*Custom); ok {
+		return
+	}
+	min, ok1 := e.RepeatMin().(ConstExpression)
+	max, ok2 := e.RepeatMax().(ConstExpression)
+	if ok1 && ok2 && min > max {
+		l.add(Error, e, "repeatmin %d is greater than repeatmax %d", min, max)
+	}
+}
+
+// bitLength returns the length of the element in bits, if it is a constant.
+func bitLength(e Lengthable) (int64, bool) {
+	n, ok := e.Length().(ConstExpression)
+	if !ok {
+		return 0, false
+	}
+	if e.LengthUnit() == BitLengthUnit {
+		return int64(n), true
+	}
+	return int64(n) * 8, true
+}
+
+// fits returns true if the value can be stored in a number of this many bits. Negative
+// values are allowed for signed numbers, but otherwise the unsigned range is allowed, as
+// grammars often give signed values in hex.
+func fits(value interface{}, bits int64, signed bool) bool {
+	if bits >= 64 {
+		return true
+	}
+	switch v := value.(type) {
+	case int64:
+		if v < 0 {
+			return signed && v >= -(1<<uint(bits-1))
+		}
+		return uint64(v) < 1<<uint(bits)
+	case uint64:
+		return v < 1<<uint(bits)
+	}
+	return true
+}
+
+// fixedValues reports fixed values that don't fit their element.
+func (l *linter) fixedValues(e Element) {
+	switch e := e.(type) {
+	case *Number:
+		bits, ok := bitLength(e)
+		if !ok || e.Type != "integer" {
+			return
+		}
+		for _, v := range e.values {
+			if !fits(v.value, bits, e.Signed()) {
+				l.add(Error, e, "fixed value %q (%v) does not fit in %d bits", v.name, v.value, bits)
+			}
+		}
+		for _, m := range e.masks {
+			if bits < 64 && m.value >= 1<<uint(bits) {
+				l.add(Error, e, "mask %q (0x%X) does not fit in %d bits", m.name, m.value, bits)
+			}
+			for _, v := range m.values {
+				if !fits(v.value, bits, false) {
+					l.add(Error, e, "mask %q fixed value %q (%v) does not fit in %d bits", m.name, v.name, v.value, bits)
+				}
+			}
+		}
+
+	case *Binary:
+		bits, ok := bitLength(e)
+		if !ok || bits%8 != 0 {
+			return
+		}
+		for _, v := range e.values {
+			if int64(len(v.value))*8 != bits {
+				l.add(Error, e, "fixed value %q is %d bytes, but the binary is %d bytes", v.name, len(v.value), bits/8)
+			}
+		}
+
+	case *String:
+		bits, ok := bitLength(e)
+		if !ok || bits%8 != 0 || e.Typ() != "fixed-length" {
+			return
+		}
+		for _, v := range e.values {
+			if int64(len(v.value))*8 > bits {
+				l.add(Error, e, "fixed value %q is %d bytes, but the string is %d bytes", v.name, len(v.value), bits/8)
+			}
+		}
+	}
+}
+
+// ignored reports elements and attributes the decoder does not support yet.
+func (l *linter) ignored(e Element) {
+	attrs := func(names ...string) {
+		for i := 0; i < len(names); i += 2 {
+			if names[i+1] != "" {
+				l.add(Warning, e, "attribute %s=%q is ignored by the decoder", names[i], names[i+1])
+			}
+		}
+	}
+
+	switch e := e.(type) {
+	case *Structure:
+		if x := e.Xml; x != nil {
+			attrs("lengthoffset", x.LengthOffset, "alignment", x.Alignment, "floating", x.Floating,
+				"consists-of", x.ConsistsOf, "repeat", x.Repeat, "valueexpression", x.ValueExpression,
+				"debug", x.Debug, "disabled", x.Disabled)
+		}
+	case *Number:
+		if x := e.Xml; x != nil {
+			attrs("valueexpression", x.ValueExpression, "minval", x.MinVal, "maxval", x.MaxVal,
+				"disabled", x.Disabled)
+		}
+	case *Binary:
+		if x := e.Xml; x != nil {
+			attrs("unused", x.Unused, "disabled", x.Disabled)
+		}
+	case *StructRef:
+		if x := e.Xml; x != nil {
+			attrs("disabled", x.Disabled)
+		}
+	case *GrammarRef:
+		l.add(Warning, e, "grammarref elements are not supported by the decoder")
+	case *Offset:
+		l.add(Warning, e, "offset elements are not supported by the decoder")
+	}
+}
+
+// LintErrors returns true if any of the issues are errors.
+func LintErrors(issues []*LintIssue) bool {
+	for _, i := range issues {
+		if i.Severity == Error {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,85 @@
+package ufwb
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" length="16">
+			<number name="Size" id="1" type="integer" length="1" minval="0"/>
+			<binary name="Magic" id="2" length="2">
+				<fixedvalue name="magic" value="CAFEBA"/>
+			</binary>
+			<number name="Type" id="3" type="integer" length="1" signed="no" repeatmin="3" repeatmax="2">
+				<fixedvalue name="big" value="300"/>
+				<mask name="Flags" value="0x1F0"/>
+			</number>
+			<string name="Text" id="4" type="fixed-length" length="prev.Missing"/>
+			<binary name="Data" id="5" length="prev.Magic"/>
+			<binary name="More" id="6" length="Size*2"/>
+			<structure name="Inner" id="7">
+				<binary name="Rest" id="8" length="remaining"/>
+			</structure>
+		</structure>
+		<structure name="Unused" id="10">
+			<number name="Size" id="11" type="integer" length="1"/>
+		</structure>` + testFooter
+
+	u, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var got []string
+	for _, issue := range Lint(u) {
+		got = append(got, issue.Error())
+	}
+
+	want := []string{
+		`17:3: warning: <*ufwb.Structure id=10 name="Unused">: structure is not reachable from the start structure`,
+		`2:4: warning: <*ufwb.Number id=1 name="Size">: attribute minval="0" is ignored by the decoder`,
+		`3:4: error: <*ufwb.Binary id=2 name="Magic">: fixed value "magic" is 3 bytes, but the binary is 2 bytes`,
+		`6:4: error: <*ufwb.Number id=3 name="Type">: repeatmin 3 is greater than repeatmax 2`,
+		`6:4: error: <*ufwb.Number id=3 name="Type">: fixed value "big" (300) does not fit in 8 bits`,
+		`6:4: error: <*ufwb.Number id=3 name="Type">: mask "Flags" (0x1F0) does not fit in 8 bits`,
+		`10:4: error: <*ufwb.String id=4 name="Text">: length "prev.Missing" references "Missing" which does not exist`,
+		`11:4: error: <*ufwb.Binary id=5 name="Data">: length "prev.Magic" references "Magic" which is not a number`,
+		`12:4: error: <*ufwb.Binary id=6 name="More">: length "Size*2" is not a expression the decoder supports`,
+		`14:5: error: <*ufwb.Binary id=8 name="Rest">: length "remaining" requires the enclosing structure to have a length`,
+	}
+
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("Lint(...) = -got +want:\n%s", diff)
+	}
+	if !LintErrors(Lint(u)) {
+		t.Errorf("LintErrors(...) = false want true")
+	}
+}
+
+func TestLintClean(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(checksumTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+	if issues := Lint(u); len(issues) > 0 {
+		t.Errorf("Lint(...) = %q want no issues", issues)
+	}
+}
+
+func TestExtendsLoop(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" extends="id:1">
+			<number name="Size" id="2" type="integer" length="1"/>
+		</structure>
+		<structure name="Base" id="1" extends="id:99">
+			<number name="Size" id="3" type="integer" length="2"/>
+		</structure>` + testFooter
+
+	_, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "creates a loop") {
+		t.Errorf("ParseXmlGrammar(...) = %q want a extends loop error", errs)
+	}
+}
@@ -0,0 +1,235 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Position is a line and column in a grammar file, both starting at 1.
+type Position struct {
+	Line int
+	Col  int
+
+	Attrs map[string]Position // Position of each attribute, by name
+}
+
+func (p *Position) String() string {
+	if p == nil {
+		return "-"
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Col)
+}
+
+// Attr returns the position of the named attribute, or if it is not known, the position of
+// the element.
+func (p *Position) Attr(name string) *Position {
+	if p == nil {
+		return nil
+	}
+	if a, found := p.Attrs[name]; found {
+		return &a
+	}
+	return p
+}
+
+// positioned is implemented by Elements that know where they are in the grammar file.
+type positioned interface {
+	Pos() *Position
+}
+
+// posOf returns the position of the element, or nil if not known.
+func posOf(e interface{}) *Position {
+	if p, ok := e.(positioned); ok {
+		return p.Pos()
+	}
+	return nil
+}
+
+// lineIndex converts byte offsets in a file into line and columns.
+type lineIndex []int // Offset of the start of each line
+
+func newLineIndex(data []byte) lineIndex {
+	lines := lineIndex{0}
+	for i, b := range data {
+		if b == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return lines
+}
+
+func (lines lineIndex) pos(offset int) Position {
+	line := sort.Search(len(lines), func(i int) bool {
+		return lines[i] > offset
+	}) - 1
+	return Position{Line: line + 1, Col: offset - lines[line] + 1}
+}
+
+// attrOffsets returns the offset of each attribute name within the start tag.
+func attrOffsets(tag []byte) map[string]int {
+	offsets := make(map[string]int)
+
+	isSpace := func(b byte) bool {
+		return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+	}
+
+	// Skip over the "<name"
+	i := 1
+	for i < len(tag) && !isSpace(tag[i]) && tag[i] != '>' && tag[i] != '/' {
+		i++
+	}
+
+	for i < len(tag) {
+		for i < len(tag) && isSpace(tag[i]) {
+			i++
+		}
+		start := i
+		for i < len(tag) && tag[i] != '=' && !isSpace(tag[i]) && tag[i] != '>' && tag[i] != '/' {
+			i++
+		}
+		if i == start {
+			break
+		}
+		offsets[string(tag[start:i])] = start
+
+		// Skip to the end of the quoted value
+		j := bytes.IndexAny(tag[i:], `"'`)
+		if j < 0 {
+			break
+		}
+		i += j
+		k := bytes.IndexByte(tag[i+1:], tag[i])
+		if k < 0 {
+			break
+		}
+		i += k + 2
+	}
+
+	return offsets
+}
+
+// readPositions returns the position of every start element in data, keyed by the parent and
+// element name, e.g. "structure/number", in the order they appear.
+func readPositions(data []byte) (map[string][]*Position, error) {
+	lines := newLineIndex(data)
+	positions := make(map[string][]*Position)
+
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	stack := []string{""}
+	for {
+		start := int(decoder.InputOffset())
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return positions, nil
+		}
+		if err != nil {
+			return positions, err
+		}
+
+		switch token := token.(type) {
+		case xml.StartElement:
+			end := int(decoder.InputOffset())
+
+			pos := lines.pos(start)
+			pos.Attrs = make(map[string]Position)
+			for name, offset := range attrOffsets(data[start:end]) {
+				pos.Attrs[name] = lines.pos(start + offset)
+			}
+
+			parent := stack[len(stack)-1]
+			key := parent + "/" + token.Name.Local
+			positions[key] = append(positions[key], &pos)
+
+			if token.Name.Local == "fixedvalues" {
+				// The values inside a <fixedvalues> are merged with their parent's, so are keyed
+				// as if they were directly inside the parent.
+				stack = append(stack, parent)
+			} else {
+				stack = append(stack, token.Name.Local)
+			}
+
+		case xml.EndElement:
+			stack = stack[:len(stack)-1]
+		}
+	}
+}
+
+// positioner assigns the positions read by readPositions to the Xml elements. The elements
+// are visited in the same order they appear in the file, so the nth element of each key is
+// given the nth position.
+type positioner map[string][]*Position
+
+func (p positioner) next(key string) *Position {
+	positions := p[key]
+	if len(positions) == 0 {
+		return nil
+	}
+	p[key] = positions[1:]
+	return positions[0]
+}
+
+func (p positioner) ufwb(x *XmlUfwb) {
+	if g := x.Grammar; g != nil {
+		g.Pos = p.next("ufwb/grammar")
+		for _, s := range g.Scripts {
+			s.Pos = p.next("scripts/script")
+		}
+		for _, s := range g.Structures {
+			p.structure("grammar", s)
+		}
+	}
+}
+
+func (p positioner) structure(parent string, s *XmlStructure) {
+	s.Pos = p.next(parent + "/structure")
+
+	for _, e := range s.Elements {
+		switch e := e.(type) {
+		case *XmlStructure:
+			p.structure("structure", e)
+		case *XmlBinary:
+			e.Pos = p.next("structure/binary")
+			p.fixedValues("binary", e.Pos, e.Values)
+		case *XmlCustom:
+			e.Pos = p.next("structure/custom")
+		case *XmlGrammarRef:
+			e.Pos = p.next("structure/grammarref")
+		case *XmlNumber:
+			e.Pos = p.next("structure/number")
+			p.fixedValues("number", e.Pos, e.Values)
+			for _, m := range e.Masks {
+				m.Pos = p.next("number/mask")
+				p.fixedValues("mask", m.Pos, m.Values)
+			}
+		case *XmlOffset:
+			e.Pos = p.next("structure/offset")
+		case *XmlScriptElement:
+			e.Pos = p.next("structure/scriptelement")
+			if e.Script != nil {
+				e.Script.Pos = p.next("scriptelement/script")
+			}
+		case *XmlString:
+			e.Pos = p.next("structure/string")
+			p.fixedValues("string", e.Pos, e.Values)
+		case *XmlStructRef:
+			e.Pos = p.next("structure/structref")
+		}
+	}
+}
+
+// fixedValues assigns positions to the values of the parent element found at pos.
+func (p positioner) fixedValues(parent string, pos *Position, values []*XmlFixedValue) {
+	if (parent == "string" || parent == "binary") && pos != nil && len(values) > 0 {
+		// Strings and binaries read a fixedval attribute as their first value.
+		if a, found := pos.Attrs["fixedval"]; found {
+			values[0].Pos = &a
+			values = values[1:]
+		}
+	}
+	for _, v := range values {
+		v.Pos = p.next(parent + "/fixedvalue")
+	}
+}
@@ -0,0 +1,121 @@
+package ufwb
+
+import (
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+func TestPositions(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99">
+			<number name="Size" id="1" type="integer" length="1"/>
+			<structure name="Inner" id="2">
+				<string name="Text" id="3"
+					type="fixed-length" length="prev.Size"/>
+			</structure>
+			<structref name="Ref" id="4" structure="id:5"/>
+		</structure>
+		<structure name="Other" id="5">
+			<binary name="Data" id="6" length="2"/>
+		</structure>` + testFooter
+
+	u, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	tests := []struct {
+		id   string
+		attr string
+		want string
+	}{
+		{"id:99", "", "1:55"},
+		{"id:1", "", "2:4"},
+		{"id:1", "length", "2:46"},
+		{"id:2", "", "3:4"},
+		{"id:3", "", "4:5"},
+		{"id:3", "type", "5:6"},
+		{"id:3", "length", "5:26"},
+		{"id:3", "missing", "4:5"},
+		{"id:4", "structure", "7:33"},
+		{"id:5", "", "9:3"},
+		{"id:6", "", "10:4"},
+	}
+
+	for _, test := range tests {
+		e, found := u.Get(test.id)
+		if !found {
+			t.Errorf("Get(%q) not found", test.id)
+			continue
+		}
+		if got := posOf(e).Attr(test.attr).String(); got != test.want {
+			t.Errorf("Get(%q).Pos().Attr(%q) = %q want %q", test.id, test.attr, got, test.want)
+		}
+	}
+
+	if got := u.Grammar.Pos().String(); got != "1:7" {
+		t.Errorf("Grammar.Pos() = %q want %q", got, "1:7")
+	}
+}
+
+func TestPositionsInErrors(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99">
+			<structref name="Ref" id="1" structure="id:5"/>
+		</structure>` + testFooter
+
+	_, errs := ParseXmlGrammar(strings.NewReader(xml))
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+
+	want := []string{
+		`2:33: <*ufwb.StructRef id=1 name="Ref">: referenced struct "id:5" not found`,
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("ParseXmlGrammar(...) = -got +want:\n%s", diff)
+	}
+}
+
+func TestPositionsInTransformErrors(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99">
+			<number name="Type" id="1" type="integer" length="1" endian="sideways">
+				<mask name="Flags" value="0xZZ"/>
+			</number>
+			<binary name="Magic" id="2" length="2">
+				<fixedvalues>
+					<fixedvalue name="bad" value="XYZ"/>
+				</fixedvalues>
+			</binary>
+		</structure>` + testFooter
+
+	_, errs := ParseXmlGrammar(strings.NewReader(xml))
+	var got []string
+	for _, err := range errs {
+		got = append(got, err.Error())
+	}
+
+	want := []string{
+		`2:57: <*ufwb.Number id=1 name="Type">: unknown endian: "sideways"`,
+		`3:24: <*ufwb.Number id=1 name="Type">: invalid mask "0xZZ": strconv.ParseUint: parsing "0xZZ": invalid syntax`,
+		`7:29: <*ufwb.Binary id=2 name="Magic">: encoding/hex: invalid byte: U+0058 'X'`,
+	}
+	if diff := pretty.Compare(got, want); diff != "" {
+		t.Errorf("ParseXmlGrammar(...) = -got +want:\n%s", diff)
+	}
+}
+
+func TestAttrOffsets(t *testing.T) {
+	tag := `<number name="a>b" id='1' type = "it's"/>`
+	want := map[string]int{
+		"name": 8,
+		"id":   19,
+		"type": 26,
+	}
+	if diff := pretty.Compare(attrOffsets([]byte(tag)), want); diff != "" {
+		t.Errorf("attrOffsets(%q) = -got +want:\n%s", tag, diff)
+	}
+}
@@ -0,0 +1,373 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"bramp.net/dsector/input"
+)
+
+// Query selects Values by a path of element names, for example:
+//
+//	PNG File/Chunk[2]/Length
+//	PNG File/*[Type=0x49444154]/Data
+//
+// Each segment of the path matches the children of the previous segment's matches. A segment
+// is either a element name, or "*" to match any child, followed by zero or more filters:
+//
+//	[n]            the n-th (zero based) matching sibling, negative counts from the end
+//	[Field=value]  siblings with a child named Field that has this value
+//	[Field!=value] siblings without such a child
+//
+// Values are compared numerically for Numbers, otherwise against the formatted value, the
+// name of the matching fixed value, or the raw bytes in hex. Special characters can be
+// escaped with a backslash.
+//
+// The Value decoded from a transformed Binary is treated as the Binary's only child, so
+// "File/Packed/Payload/Text" selects Text from the Payload structure that Packed decompressed to.
+type Query struct {
+	path     string
+	segments []querySegment
+}
+
+type querySegment struct {
+	name    string
+	any     bool // Matches any name
+	filters []queryFilter
+}
+
+type queryFilter struct {
+	index   int
+	isIndex bool
+
+	field string
+	value string
+	not   bool
+}
+
+// Match is a Value found by a Query, along with its path from the queried Value.
+type Match struct {
+	*Value
+	Path string
+
+	// File is what the Value should be read from. This is the queried file, unless the
+	// Value is within a transformed Binary, then it is the transformed bytes.
+	File io.ReaderAt
+}
+
+// children returns a Match for each child of m, including any transformed Value.
+func (m *Match) children() []*Match {
+	var matches []*Match
+	for _, child := range m.Children {
+		matches = append(matches, &Match{
+			Value: child,
+			Path:  joinPath(m.Path, childPath(m.Value, child)),
+			File:  m.File,
+		})
+	}
+	if t := m.Transformed(); t != nil {
+		matches = append(matches, &Match{
+			Value: t.Value,
+			Path:  joinPath(m.Path, escapePath(t.Value.Name())),
+			File:  t.Input(),
+		})
+	}
+	return matches
+}
+
+// ParseQuery parses the query path.
+func ParseQuery(path string) (*Query, error) {
+	q := &Query{path: path}
+	p := &queryParser{s: strings.TrimPrefix(path, "/")}
+
+	for {
+		seg, err := p.segment()
+		if err != nil {
+			return nil, fmt.Errorf("invalid query %q: %s", path, err)
+		}
+		q.segments = append(q.segments, seg)
+
+		if p.eof() {
+			return q, nil
+		}
+		p.next() // Consume the '/'
+	}
+}
+
+// MustParseQuery is like ParseQuery but panics if the path is invalid.
+func MustParseQuery(path string) *Query {
+	q, err := ParseQuery(path)
+	if err != nil {
+		panic(err)
+	}
+	return q
+}
+
+func (q *Query) String() string {
+	return q.path
+}
+
+// Select returns all the Values under value that match this query, in file order.
+func (q *Query) Select(file io.ReaderAt, value *Value) ([]*Match, error) {
+	matches := []*Match{{Value: value, File: file}}
+
+	for _, seg := range q.segments {
+		var next []*Match
+		for _, m := range matches {
+			candidates := seg.children(m)
+			for _, f := range seg.filters {
+				var err error
+				if candidates, err = f.apply(candidates); err != nil {
+					return nil, err
+				}
+			}
+			next = append(next, candidates...)
+		}
+		matches = next
+	}
+
+	return matches, nil
+}
+
+// children returns the children of m that match this segment's name.
+func (seg *querySegment) children(m *Match) []*Match {
+	var matches []*Match
+	for _, child := range m.children() {
+		if seg.any || seg.name == child.Name() {
+			matches = append(matches, child)
+		}
+	}
+	return matches
+}
+
+func (f *queryFilter) apply(candidates []*Match) ([]*Match, error) {
+	if f.isIndex {
+		i := f.index
+		if i < 0 {
+			i += len(candidates)
+		}
+		if i < 0 || i >= len(candidates) {
+			return nil, nil
+		}
+		return candidates[i : i+1], nil
+	}
+
+	var matches []*Match
+	for _, m := range candidates {
+		found := false
+		for _, child := range m.children() {
+			if child.Name() != f.field {
+				continue
+			}
+			ok, err := matchesValue(child.File, child.Value, f.value)
+			if err != nil {
+				return nil, err
+			}
+			if ok {
+				found = true
+				break
+			}
+		}
+		if found != f.not {
+			matches = append(matches, m)
+		}
+	}
+	return matches, nil
+}
+
+// matchesValue returns true if the value is equal to s.
+func matchesValue(file io.ReaderAt, value *Value, s string) (bool, error) {
+	if n, ok := value.Element.(*Number); ok {
+		if want, err := strconv.ParseInt(s, 0, 64); err == nil {
+			got, err := n.Int(file, value)
+			return got == want, err
+		}
+		if want, err := strconv.ParseUint(s, 0, 64); err == nil {
+			got, err := n.Uint(file, value)
+			return got == want, err
+		}
+
+	}
+
+	name, err := fixedName(file, value)
+	if err != nil {
+		return false, err
+	}
+	if name != "" && name == s {
+		return true, nil
+	}
+
+	if len(value.Children) > 0 {
+		return false, nil
+	}
+
+	formatted, err := value.Format(file)
+	if err != nil {
+		return false, err
+	}
+	if formatted == s {
+		return true, nil
+	}
+
+	b := make([]byte, value.Len)
+	if _, err := input.ReadFullAt(file, b, value.Offset); err != nil {
+		return false, err
+	}
+	return strings.EqualFold(hex.EncodeToString(b), strings.TrimPrefix(s, "0x")), nil
+}
+
+// childPath returns the path segment that uniquely identifies child within parent.
+func childPath(parent, child *Value) string {
+	name := escapePath(child.Name())
+
+	i, count := 0, 0
+	for _, c := range parent.Children {
+		if c == child {
+			i = count
+		}
+		if c.Name() == child.Name() {
+			count++
+		}
+	}
+
+	if count > 1 {
+		return fmt.Sprintf("%s[%d]", name, i)
+	}
+	return name
+}
+
+func joinPath(parent, child string) string {
+	if parent == "" {
+		return child
+	}
+	return parent + "/" + child
+}
+
+func escapePath(name string) string {
+	if !strings.ContainsAny(name, `/[]\=!`) && name != "*" {
+		return name
+	}
+
+	var b bytes.Buffer
+	for _, r := range name {
+		if strings.ContainsRune(`/[]\=!*`, r) {
+			b.WriteRune('\\')
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// queryParser is a simple recursive descent parser for query paths.
+type queryParser struct {
+	s   string
+	pos int
+}
+
+func (p *queryParser) eof() bool {
+	return p.pos >= len(p.s)
+}
+
+func (p *queryParser) peek() byte {
+	return p.s[p.pos]
+}
+
+func (p *queryParser) next() byte {
+	b := p.s[p.pos]
+	p.pos++
+	return b
+}
+
+// token reads until one of the stop characters, handling escapes.
+func (p *queryParser) token(stop string) (string, error) {
+	var b bytes.Buffer
+	for !p.eof() && !strings.ContainsRune(stop, rune(p.peek())) {
+		c := p.next()
+		if c == '\\' {
+			if p.eof() {
+				return "", fmt.Errorf("trailing escape at %d", p.pos)
+			}
+			c = p.next()
+		}
+		b.WriteByte(c)
+	}
+	return b.String(), nil
+}
+
+func (p *queryParser) segment() (querySegment, error) {
+	var seg querySegment
+
+	start := p.pos
+	name, err := p.token("/[")
+	if err != nil {
+		return seg, err
+	}
+	if name == "" {
+		return seg, fmt.Errorf("empty name at %d", start)
+	}
+	seg.name = name
+	seg.any = p.s[start:p.pos] == "*" // But not an escaped "\*"
+
+	for !p.eof() && p.peek() == '[' {
+		p.next()
+		f, err := p.filter()
+		if err != nil {
+			return seg, err
+		}
+		seg.filters = append(seg.filters, f)
+	}
+
+	if !p.eof() && p.peek() != '/' {
+		return seg, fmt.Errorf("unexpected %q at %d", p.peek(), p.pos)
+	}
+	return seg, nil
+}
+
+func (p *queryParser) filter() (queryFilter, error) {
+	var f queryFilter
+
+	start := p.pos
+	field, err := p.token("]=!")
+	if err != nil {
+		return f, err
+	}
+	if p.eof() {
+		return f, fmt.Errorf("unterminated '[' at %d", start-1)
+	}
+
+	if p.peek() == ']' {
+		p.next()
+		i, err := strconv.Atoi(strings.TrimSpace(field))
+		if err != nil {
+			return f, fmt.Errorf("invalid index %q at %d", field, start)
+		}
+		f.index, f.isIndex = i, true
+		return f, nil
+	}
+
+	if p.next() == '!' {
+		if p.eof() || p.next() != '=' {
+			return f, fmt.Errorf("expected '!=' at %d", p.pos-1)
+		}
+		f.not = true
+	}
+	if field == "" {
+		return f, fmt.Errorf("empty field name at %d", start)
+	}
+
+	value, err := p.token("]")
+	if err != nil {
+		return f, err
+	}
+	if p.eof() {
+		return f, fmt.Errorf("unterminated '[' at %d", start-1)
+	}
+	p.next() // Consume the ']'
+
+	f.field, f.value = field, value
+	return f, nil
+}
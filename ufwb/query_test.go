@@ -0,0 +1,105 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"strings"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="big" signed="no">
+			<structure name="Chunk" id="1" repeatmax="unlimited">
+				<number name="Length" id="2" type="integer" length="1"/>
+				<number name="Type" id="3" type="integer" length="2" display="hex" mustmatch="no">
+					<fixedvalue name="end" value="0xFFFF"/>
+				</number>
+				<binary name="Data" id="4" length="prev.Length"/>
+			</structure>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	file := input.FromBytes([]byte(
+		"\x01\x00\x01A" +
+			"\x02\x00\x02BC" +
+			"\x01\x00\x01D" +
+			"\x01\xff\xffE"))
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	tests := []struct {
+		path string
+		want []string // Paths of the matches
+	}{
+		{"File/Chunk/Length", []string{"File/Chunk[0]/Length", "File/Chunk[1]/Length", "File/Chunk[2]/Length", "File/Chunk[3]/Length"}},
+		{"/File/Chunk[1]/Data", []string{"File/Chunk[1]/Data"}},
+		{"File/Chunk[-1]", []string{"File/Chunk[3]"}},
+		{"File/Chunk[9]", nil},
+		{"File/*[Type=1]/Data", []string{"File/Chunk[0]/Data", "File/Chunk[2]/Data"}},
+		{"File/*[Type=0x0002]", []string{"File/Chunk[1]"}},
+		{"File/*[Type=end]", []string{"File/Chunk[3]"}},
+		{"File/*[Type!=1][Data=4243]", []string{"File/Chunk[1]"}},
+		{"File/*[Type=1][1]/Data", []string{"File/Chunk[2]/Data"}},
+		{"File/Missing", nil},
+		{"*/*[Length=2]", []string{"File/Chunk[1]"}},
+	}
+
+	for _, test := range tests {
+		matches, err := value.Select(file, test.path)
+		if err != nil {
+			t.Errorf("value.Select(%q) error = %q want nil error", test.path, err)
+			continue
+		}
+
+		var got []string
+		for _, m := range matches {
+			got = append(got, m.Path)
+		}
+
+		if strings.Join(got, ",") != strings.Join(test.want, ",") {
+			t.Errorf("value.Select(%q) = %q want %q", test.path, got, test.want)
+		}
+	}
+
+	matches, err := value.Select(file, "File/Chunk[1]/Length")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("value.Select(...) = %v, %v want one match", matches, err)
+	}
+	if got, err := matches[0].Uint(file); got != 2 || err != nil {
+		t.Errorf("matches[0].Uint(...) = %d, %v want 2, nil", got, err)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	for _, path := range []string{
+		"",
+		"File//Chunk",
+		"File/Chunk[",
+		"File/Chunk[x]",
+		"File/Chunk[=1]",
+		"File/Chunk[Type!1]",
+		"File/Chunk[0]x",
+		`File\`,
+	} {
+		if _, err := ParseQuery(path); err == nil {
+			t.Errorf("ParseQuery(%q) = nil want error", path)
+		}
+	}
+
+	q, err := ParseQuery(`A\/B/\*`)
+	if err != nil {
+		t.Fatalf("ParseQuery(...) error = %q want nil error", err)
+	}
+	if got := q.segments[0].name; got != "A/B" {
+		t.Errorf("q.segments[0].name = %q want %q", got, "A/B")
+	}
+	if q.segments[1].any {
+		t.Errorf("q.segments[1].any = true want false for escaped *")
+	}
+}
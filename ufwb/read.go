@@ -15,7 +15,7 @@ import (
 
 // Dummy Element, that is not actually found in the Grammar, but is used to represent padding
 // through the file
-var padElement = &Padding{Base: Base{"Padding", 0, "", ""}}
+var padElement = &Padding{Base: Base{elemType: "Padding", id: 0, name: ""}}
 
 func (u *Ufwb) Read(d *Decoder) (*Value, error) {
 	return d.read(u.Grammar)
@@ -361,6 +361,12 @@ func (b *Binary) Read(d *Decoder) (*Value, error) {
 		}
 	}
 
+	if b.Transform() != "" || b.Structure() != nil {
+		if err := d.transform(b, v, bs); err != nil {
+			return v, err
+		}
+	}
+
 	return v, nil
 }
 
@@ -471,7 +477,19 @@ func (n *Number) Read(d *Decoder) (*Value, error) {
 }
 
 func (c *Custom) Read(d *Decoder) (*Value, error) {
-	panic("TODO")
+	t := c.Typ()
+	if t == nil {
+		return nil, &validationError{e: c, err: errCustomScript}
+	}
+
+	v, err := t.Read(d)
+	if v != nil {
+		v.Element = c
+	}
+	if err != nil && !isEof(err) {
+		err = &validationError{e: c, err: err}
+	}
+	return v, err
 }
 
 func (g *GrammarRef) Read(d *Decoder) (*Value, error) {
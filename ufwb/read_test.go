@@ -2,6 +2,7 @@ package ufwb
 
 import (
 	"bramp.net/dsector/input"
+	"bytes"
 	"github.com/kylelemons/godebug/pretty"
 	"io"
 	"strings"
@@ -69,6 +70,22 @@ func testFile(t *testing.T, grammar *Ufwb, filename string, expectErr bool) {
 		t.Errorf("got.Format() error = %q want nil error", err)
 		return
 	}
+
+	// Check writing the value reproduces the file
+	want := make([]byte, fileLen)
+	if _, err := input.ReadFullAt(file, want, 0); err != nil {
+		t.Errorf("input.ReadFullAt(%q) error = %q want nil error", filename, err)
+		return
+	}
+
+	var buf bytes.Buffer
+	if err := got.Write(&buf, file); err != nil {
+		t.Errorf("got.Write() error = %q want nil error", err)
+		return
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Errorf("got.Write() did not reproduce %q", filename)
+	}
 }
 
 func TestReadNumber(t *testing.T) {
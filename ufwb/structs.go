@@ -16,6 +16,11 @@ const (
 )
 
 type Colour uint32
+
+// RGB returns the red, green and blue components of this colour.
+func (c Colour) RGB() (r, g, b uint8) {
+	return uint8(c >> 16), uint8(c >> 8), uint8(c)
+}
 type Bool int8 // tri-state bool unset, false, true.
 
 type Expression interface {
@@ -136,6 +141,11 @@ type Formatter interface {
 	Format(file io.ReaderAt, value *Value) (string, error)
 }
 
+type Writer interface {
+	// Write writes the bytes that represent the Value to w.
+	Write(w io.Writer, file io.ReaderAt, value *Value) error
+}
+
 type Updatable interface {
 	// Updates/validates the Element
 	update(u *Ufwb, parent *Structure, errs *toerr.Errors)
@@ -173,10 +183,17 @@ type Element interface {
 	Updatable
 	Derivable
 	Formatter
+	Writer
 
 	// TODO Add Colourful here
 }
 
+// Coloured is implemented by Elements that have a fill and stroke colour.
+type Coloured interface {
+	FillColour() Colour
+	StrokeColour() Colour
+}
+
 type Colourful struct {
 	fillColour   *Colour `default:"White" dereference:"true" parent:"false"`
 	strokeColour *Colour `default:"Black" dereference:"true" parent:"false"`
@@ -198,6 +215,8 @@ type Base struct {
 	id          int    `parent:"false" derives:"false"`
 	name        string `parent:"false" derives:"false"`
 	description string `parent:"false" derives:"false"`
+
+	pos *Position `parent:"false" derives:"false"` // Where this element was found in the grammar file, if known
 }
 
 func (b *Base) Id() int {
@@ -237,6 +256,7 @@ type Grammar struct {
 	Email    string
 	Complete Bool
 	Uti      string
+	Mime     string
 
 	Start    *Structure
 	Scripts  []*Script
@@ -310,6 +330,7 @@ type Custom struct {
 	lengthUnit LengthUnit `default:"ByteLengthUnit"`
 
 	script *Script
+	typ    CustomType // Used when this element is implemented in Go
 }
 
 type StructRef struct {
@@ -366,6 +387,12 @@ type Binary struct {
 
 	mustMatch Bool `default:"True"`
 	values    []*FixedBinaryValue
+
+	checksum   string // Name of the checksum algorithm, see Checksums
+	checksumOf string // Comma separated names of the siblings covered by the checksum
+
+	transform string     // Name of the transform, see Transforms
+	structure *Structure // Structure to decode the transformed bytes with
 }
 
 type Number struct {
@@ -396,6 +423,9 @@ type Number struct {
 	mustMatch Bool `default:"True"`
 	values    []*FixedValue
 	masks     []*Mask
+
+	checksum   string // Name of the checksum algorithm, see Checksums
+	checksumOf string // Comma separated names of the siblings covered by the checksum
 }
 
 // TODO Support parsing the Offsets
@@ -478,6 +508,36 @@ type FixedStringValue struct {
 	description string
 }
 
+// Name returns the name of the fixed value.
+func (v *FixedValue) Name() string {
+	return v.name
+}
+
+// Value returns the fixed value, either a int64 or uint64.
+func (v *FixedValue) Value() interface{} {
+	return v.value
+}
+
+// Name returns the name of the fixed value.
+func (v *FixedBinaryValue) Name() string {
+	return v.name
+}
+
+// Value returns the fixed value.
+func (v *FixedBinaryValue) Value() []byte {
+	return v.value
+}
+
+// Name returns the name of the fixed value.
+func (v *FixedStringValue) Name() string {
+	return v.name
+}
+
+// Value returns the fixed value.
+func (v *FixedStringValue) Value() string {
+	return v.value
+}
+
 // Padding is a pseudo Element created to represent unspecified regions in a file.
 type Padding struct {
 	Base
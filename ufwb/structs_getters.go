@@ -2,6 +2,34 @@
 
 package ufwb
 
+func (b *Binary) Checksum() string {
+	if b.checksum != "" {
+		return b.checksum
+	}
+	if b.derives != nil {
+		return b.derives.Checksum()
+	}
+	return ""
+}
+
+func (b *Binary) SetChecksum(checksum string) {
+	b.checksum = checksum
+}
+
+func (b *Binary) ChecksumOf() string {
+	if b.checksumOf != "" {
+		return b.checksumOf
+	}
+	if b.derives != nil {
+		return b.derives.ChecksumOf()
+	}
+	return ""
+}
+
+func (b *Binary) SetChecksumOf(checksumOf string) {
+	b.checksumOf = checksumOf
+}
+
 func (b *Binary) Description() string {
 	if b.description != "" {
 		return b.description
@@ -101,6 +129,17 @@ func (b *Binary) SetName(name string) {
 	b.name = name
 }
 
+func (b *Binary) Pos() *Position {
+	if b.pos != nil {
+		return b.pos
+	}
+	return nil
+}
+
+func (b *Binary) SetPos(pos *Position) {
+	b.pos = pos
+}
+
 func (b *Binary) RepeatMax() Expression {
 	if b.repeatMax != nil {
 		return b.repeatMax
@@ -143,6 +182,34 @@ func (b *Binary) SetStrokeColour(strokeColour Colour) {
 	b.strokeColour = &strokeColour
 }
 
+func (b *Binary) Structure() *Structure {
+	if b.structure != nil {
+		return b.structure
+	}
+	if b.derives != nil {
+		return b.derives.Structure()
+	}
+	return nil
+}
+
+func (b *Binary) SetStructure(structure *Structure) {
+	b.structure = structure
+}
+
+func (b *Binary) Transform() string {
+	if b.transform != "" {
+		return b.transform
+	}
+	if b.derives != nil {
+		return b.derives.Transform()
+	}
+	return ""
+}
+
+func (b *Binary) SetTransform(transform string) {
+	b.transform = transform
+}
+
 func (b *Binary) Values() []*FixedBinaryValue {
 	if b.values != nil {
 		return b.values
@@ -239,6 +306,17 @@ func (c *Custom) SetName(name string) {
 	c.name = name
 }
 
+func (c *Custom) Pos() *Position {
+	if c.pos != nil {
+		return c.pos
+	}
+	return nil
+}
+
+func (c *Custom) SetPos(pos *Position) {
+	c.pos = pos
+}
+
 func (c *Custom) Script() *Script {
 	if c.script != nil {
 		return c.script
@@ -267,6 +345,20 @@ func (c *Custom) SetStrokeColour(strokeColour Colour) {
 	c.strokeColour = &strokeColour
 }
 
+func (c *Custom) Typ() CustomType {
+	if c.typ != nil {
+		return c.typ
+	}
+	if c.derives != nil {
+		return c.derives.Typ()
+	}
+	return nil
+}
+
+func (c *Custom) SetTyp(typ CustomType) {
+	c.typ = typ
+}
+
 func (g *Grammar) Description() string {
 	if g.description != "" {
 		return g.description
@@ -307,6 +399,17 @@ func (g *Grammar) SetName(name string) {
 	g.name = name
 }
 
+func (g *Grammar) Pos() *Position {
+	if g.pos != nil {
+		return g.pos
+	}
+	return nil
+}
+
+func (g *Grammar) SetPos(pos *Position) {
+	g.pos = pos
+}
+
 func (g *Grammar) RepeatMax() Expression {
 	if g.repeatMax != nil {
 		return g.repeatMax
@@ -411,6 +514,17 @@ func (g *GrammarRef) SetName(name string) {
 	g.name = name
 }
 
+func (g *GrammarRef) Pos() *Position {
+	if g.pos != nil {
+		return g.pos
+	}
+	return nil
+}
+
+func (g *GrammarRef) SetPos(pos *Position) {
+	g.pos = pos
+}
+
 func (g *GrammarRef) RepeatMax() Expression {
 	if g.repeatMax != nil {
 		return g.repeatMax
@@ -453,6 +567,34 @@ func (g *GrammarRef) SetUti(uti string) {
 	g.uti = uti
 }
 
+func (n *Number) Checksum() string {
+	if n.checksum != "" {
+		return n.checksum
+	}
+	if n.derives != nil {
+		return n.derives.Checksum()
+	}
+	return ""
+}
+
+func (n *Number) SetChecksum(checksum string) {
+	n.checksum = checksum
+}
+
+func (n *Number) ChecksumOf() string {
+	if n.checksumOf != "" {
+		return n.checksumOf
+	}
+	if n.derives != nil {
+		return n.derives.ChecksumOf()
+	}
+	return ""
+}
+
+func (n *Number) SetChecksumOf(checksumOf string) {
+	n.checksumOf = checksumOf
+}
+
 func (n *Number) Description() string {
 	if n.description != "" {
 		return n.description
@@ -628,6 +770,17 @@ func (n *Number) SetName(name string) {
 	n.name = name
 }
 
+func (n *Number) Pos() *Position {
+	if n.pos != nil {
+		return n.pos
+	}
+	return nil
+}
+
+func (n *Number) SetPos(pos *Position) {
+	n.pos = pos
+}
+
 func (n *Number) RepeatMax() Expression {
 	if n.repeatMax != nil {
 		return n.repeatMax
@@ -845,6 +998,17 @@ func (o *Offset) SetName(name string) {
 	o.name = name
 }
 
+func (o *Offset) Pos() *Position {
+	if o.pos != nil {
+		return o.pos
+	}
+	return nil
+}
+
+func (o *Offset) SetPos(pos *Position) {
+	o.pos = pos
+}
+
 func (o *Offset) ReferencedSize() ElementId {
 	if o.referencedSize != ElementId(nil) {
 		return o.referencedSize
@@ -983,6 +1147,17 @@ func (s *Script) SetName(name string) {
 	s.name = name
 }
 
+func (s *Script) Pos() *Position {
+	if s.pos != nil {
+		return s.pos
+	}
+	return nil
+}
+
+func (s *Script) SetPos(pos *Position) {
+	s.pos = pos
+}
+
 func (s *Script) RepeatMax() Expression {
 	if s.repeatMax != nil {
 		return s.repeatMax
@@ -1169,6 +1344,17 @@ func (s *String) SetName(name string) {
 	s.name = name
 }
 
+func (s *String) Pos() *Position {
+	if s.pos != nil {
+		return s.pos
+	}
+	return nil
+}
+
+func (s *String) SetPos(pos *Position) {
+	s.pos = pos
+}
+
 func (s *String) RepeatMax() Expression {
 	if s.repeatMax != nil {
 		return s.repeatMax
@@ -1307,6 +1493,17 @@ func (s *StructRef) SetName(name string) {
 	s.name = name
 }
 
+func (s *StructRef) Pos() *Position {
+	if s.pos != nil {
+		return s.pos
+	}
+	return nil
+}
+
+func (s *StructRef) SetPos(pos *Position) {
+	s.pos = pos
+}
+
 func (s *StructRef) RepeatMax() Expression {
 	if s.repeatMax != nil {
 		return s.repeatMax
@@ -1537,6 +1734,17 @@ func (s *Structure) SetOrder(order Order) {
 	s.order = order
 }
 
+func (s *Structure) Pos() *Position {
+	if s.pos != nil {
+		return s.pos
+	}
+	return nil
+}
+
+func (s *Structure) SetPos(pos *Position) {
+	s.pos = pos
+}
+
 func (s *Structure) RepeatMax() Expression {
 	if s.repeatMax != nil {
 		return s.repeatMax
@@ -0,0 +1,162 @@
+package ufwb
+
+import (
+	"bytes"
+	"compress/bzip2"
+	"compress/flate"
+	"compress/gzip"
+	"compress/lzw"
+	"compress/zlib"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"bramp.net/dsector/input"
+)
+
+// maxTransformLen is the largest number of bytes a transform may produce, to guard against
+// decompression bombs.
+const maxTransformLen = 64 << 20
+
+// transforms maps the names usable in a transform="..." attribute to a function that
+// transforms the reader. xor is handled separately as it takes a key.
+var transforms = map[string]func(r io.Reader) (io.Reader, error){
+	"bzip2":   func(r io.Reader) (io.Reader, error) { return bzip2.NewReader(r), nil },
+	"flate":   func(r io.Reader) (io.Reader, error) { return flate.NewReader(r), nil },
+	"gzip":    func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+	"lzw":     func(r io.Reader) (io.Reader, error) { return lzw.NewReader(r, lzw.LSB, 8), nil },
+	"lzw-msb": func(r io.Reader) (io.Reader, error) { return lzw.NewReader(r, lzw.MSB, 8), nil },
+	"zlib":    func(r io.Reader) (io.Reader, error) { return zlib.NewReader(r) },
+}
+
+// Transforms returns a sorted list of the supported transforms.
+func Transforms() []string {
+	names := []string{"xor:KEY"}
+	for name := range transforms {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Transformed is the Value.Extra of a Binary with a transform attribute, for example:
+//
+//	<binary name="Data" length="remaining" transform="zlib" structure="id:12"/>
+//
+// The Binary's bytes are transformed, and then decoded with the referenced structure. If there
+// is no structure the Value is just the transformed bytes as a Binary. The transform may be
+// omitted to decode the bytes as is, or be "xor:KEY" where KEY is the hex encoded key.
+//
+// Offsets within Value are relative to the transformed bytes, not the original file, so use
+// Input when reading the Value. Use Value.Transformed to find the Transformed of a Value.
+type Transformed struct {
+	Transform string
+	Data      []byte // The transformed bytes
+	Value     *Value // The decoded transformed bytes
+}
+
+// Input returns the transformed bytes, which the Value was decoded from.
+func (t *Transformed) Input() input.Input {
+	return input.FromBytes(t.Data)
+}
+
+// Transformed returns the decoded transformed bytes of a Binary with a transform or structure
+// attribute, or nil if the value was not transformed. The Transformed Value is not one of the
+// Children, as it is read from the transformed bytes, not the file.
+func (v *Value) Transformed() *Transformed {
+	if t, ok := v.Extra.(*Transformed); ok && t.Value != nil {
+		return t
+	}
+	return nil
+}
+
+// parseTransform returns the transform function for name, and the xor key if any.
+func parseTransform(name string) (func(r io.Reader) (io.Reader, error), []byte, error) {
+	if name == "" {
+		return nil, nil, nil
+	}
+	if strings.HasPrefix(name, "xor:") {
+		key, err := hex.DecodeString(strings.TrimPrefix(strings.TrimPrefix(name, "xor:"), "0x"))
+		if err != nil || len(key) == 0 {
+			return nil, nil, fmt.Errorf("invalid xor key in transform: %q", name)
+		}
+		return nil, key, nil
+	}
+	if t, found := transforms[name]; found {
+		return t, nil, nil
+	}
+	return nil, nil, fmt.Errorf("unknown transform: %q", name)
+}
+
+// transformBytes applies the named transform to b.
+func transformBytes(name string, b []byte) ([]byte, error) {
+	t, key, err := parseTransform(name)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		out := make([]byte, len(b))
+		for i := range b {
+			out[i] = b[i] ^ key[i%len(key)]
+		}
+		return out, nil
+	}
+	if t == nil {
+		return b, nil
+	}
+
+	r, err := t(bytes.NewReader(b))
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := r.(io.Closer); ok {
+		defer c.Close()
+	}
+
+	out, err := ioutil.ReadAll(io.LimitReader(r, maxTransformLen+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > maxTransformLen {
+		return nil, fmt.Errorf("%s transform produced more than %d bytes", name, maxTransformLen)
+	}
+	return out, nil
+}
+
+// transform transforms the Binary's bytes, and decodes them, setting value.Extra.
+func (d *Decoder) transform(b *Binary, value *Value, bs []byte) error {
+	data, err := transformBytes(b.Transform(), bs)
+	if err != nil {
+		return &validationError{e: b, err: err}
+	}
+
+	t := &Transformed{
+		Transform: b.Transform(),
+		Data:      data,
+	}
+	value.Extra = t
+
+	if b.Structure() == nil {
+		t.Value = &Value{
+			Len:     int64(len(data)),
+			Element: b,
+		}
+		return nil
+	}
+
+	if d.depth >= MAX_STACK {
+		return &validationError{e: b, err: fmt.Errorf("exceeded max transform depth of %d", MAX_STACK)}
+	}
+
+	sub := NewDecoder(d.u, t.Input())
+	sub.depth = d.depth + 1
+	sub.dynamicEndian = d.dynamicEndian
+	sub.debugFunc = d.debugFunc
+
+	t.Value, err = sub.decode(b.Structure())
+	return err
+}
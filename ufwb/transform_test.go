@@ -0,0 +1,219 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"github.com/kylelemons/godebug/pretty"
+	"strings"
+	"testing"
+)
+
+const transformTestGrammar = testHeader +
+	`<structure name="File" id="99" endian="big" signed="no">
+		<number name="Size" id="1" type="integer" length="1"/>
+		<binary name="Packed" id="2" length="prev.Size" transform="zlib" structure="id:10"/>
+		<binary name="Hidden" id="3" length="2" transform="xor:ff"/>
+	</structure>
+	<structure name="Payload" id="10" endian="big" signed="no">
+		<number name="Count" id="11" type="integer" length="1"/>
+		<string name="Text" id="12" type="fixed-length" length="prev.Count"/>
+	</structure>` + testFooter
+
+func zlibBytes(b []byte) []byte {
+	var buf bytes.Buffer
+	w := zlib.NewWriter(&buf)
+	w.Write(b)
+	w.Close()
+	return buf.Bytes()
+}
+
+func TestTransform(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(transformTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	packed := zlibBytes([]byte("\x05hello"))
+	data := append(append([]byte{byte(len(packed))}, packed...), 0x9e, 0x96)
+
+	value, err := NewDecoder(grammar, input.FromBytes(data)).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	elem, _ := grammar.Get("id:2")
+	v, _ := value.find(elem)
+	transformed, ok := v.Extra.(*Transformed)
+	if !ok {
+		t.Fatalf("Packed value.Extra = %T want *Transformed", v.Extra)
+	}
+	if got, want := string(transformed.Data), "\x05hello"; got != want {
+		t.Errorf("Packed transformed.Data = %q want %q", got, want)
+	}
+
+	text, _ := grammar.Get("id:12")
+	tv, found := transformed.Value.find(text)
+	if !found {
+		t.Fatalf("Packed transformed.Value missing Text")
+	}
+	if tv.Offset != 1 || tv.Len != 5 {
+		t.Errorf("Text value = %s want [0x1 len:5]", tv)
+	}
+	if s, err := tv.Format(transformed.Input()); err != nil || s != "hello" {
+		t.Errorf("Text.Format(...) = %q, %v want %q", s, err, "hello")
+	}
+
+	hidden, _ := grammar.Get("id:3")
+	hv, _ := value.find(hidden)
+	if transformed, ok := hv.Extra.(*Transformed); !ok || string(transformed.Data) != "ai" {
+		t.Errorf("Hidden value.Extra = %+v want transformed to %q", hv.Extra, "ai")
+	}
+
+	var buf bytes.Buffer
+	if err := FormatTo(&buf, input.FromBytes(data), value); err != nil {
+		t.Fatalf("FormatTo(...) error = %q want nil error", err)
+	}
+	if !strings.Contains(buf.String(), "=> Payload: (2 children)") || !strings.Contains(buf.String(), "Text: hello") {
+		t.Errorf("FormatTo(...) = %q want the transformed Payload", buf.String())
+	}
+
+	j, err := NewJsonValue(input.FromBytes(data), value)
+	if err != nil {
+		t.Fatalf("NewJsonValue(...) error = %q want nil error", err)
+	}
+	if p := j.Children[0].Children[1].Transformed; p == nil || p.Name != "Payload" || len(p.Children) != 2 {
+		t.Errorf("NewJsonValue(...) Packed.Transformed = %+v want the Payload", p)
+	}
+}
+
+func TestTransformedValues(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(transformTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	decode := func(text string) (input.Input, *Value) {
+		packed := zlibBytes([]byte(text))
+		data := append(append([]byte{byte(len(packed))}, packed...), 0x9e, 0x96)
+		file := input.FromBytes(data)
+		value, err := NewDecoder(grammar, file).Decode()
+		if err != nil {
+			t.Fatalf("decoder.Decode(%q) error = %q want nil error", text, err)
+		}
+		return file, value
+	}
+
+	// "lo" is left over in the Payload
+	file, value := decode("\x03hello")
+
+	matches, err := value.Select(file, "File/Packed/Payload[Count=3]/Text")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("value.Select(...) = %v, %v want one match", matches, err)
+	}
+	if s, err := matches[0].Format(matches[0].File); err != nil || s != "hel" {
+		t.Errorf("value.Select(...) Text = %q, %v want %q", s, err, "hel")
+	}
+	if got, want := matches[0].Path, "File/Packed/Payload/Text"; got != want {
+		t.Errorf("value.Select(...) Path = %q want %q", got, want)
+	}
+
+	idx := NewIndex(value)
+	packed := idx.At(1)[2]
+	if got := PathOf(idx.Transformed(packed).At(1)); got != "Text" {
+		t.Errorf("idx.Transformed(Packed).At(1) = %q want %q", got, "Text")
+	}
+
+	c := NewCoverage(value.Len, value)
+	want := []*Coverage{{
+		Path:    "File/Packed",
+		Size:    6,
+		Covered: 4,
+		Gaps:    []Gap{{Kind: GapTrailing, Offset: 4, Len: 2}},
+	}}
+	if diff := pretty.Compare(c.Transformed, want); diff != "" {
+		t.Errorf("NewCoverage(...).Transformed = -got +want:\n%s", diff)
+	}
+
+	newFile, newValue := decode("\x02hello")
+	changes, err := Diff(file, value, newFile, newValue)
+	if err != nil {
+		t.Fatalf("Diff(...) error = %q want nil error", err)
+	}
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	if diff := pretty.Compare(paths, []string{"File/Packed", "File/Packed/Payload/Count", "File/Packed/Payload/Text"}); diff != "" {
+		t.Errorf("Diff(...) paths = -got +want:\n%s", diff)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteHexDump(&buf, file, value, NoColours); err != nil {
+		t.Fatalf("WriteHexDump(...) error = %q want nil error", err)
+	}
+	if !strings.Contains(buf.String(), "Packed => Payload (6 bytes)\n00000000  03 68 65 6c 6c 6f") {
+		t.Errorf("WriteHexDump(...) = %q want the transformed Payload", buf.String())
+	}
+
+	buf.Reset()
+	if err := WriteHtml(&buf, file, value, "test"); err != nil {
+		t.Fatalf("WriteHtml(...) error = %q want nil error", err)
+	}
+	if !strings.Contains(buf.String(), `<ul class="transformed">`) || !strings.Contains(buf.String(), `data-name="Text" data-start="1" data-end="4" data-fixed="" data-desc="" data-detached="1"`) {
+		t.Errorf("WriteHtml(...) = %q want the transformed Payload", buf.String())
+	}
+}
+
+func TestTransformBytes(t *testing.T) {
+	var gz bytes.Buffer
+	w := gzip.NewWriter(&gz)
+	w.Write([]byte("gzipped"))
+	w.Close()
+
+	tests := []struct {
+		transform string
+		in        []byte
+		want      string
+	}{
+		{"", []byte("as is"), "as is"},
+		{"zlib", zlibBytes([]byte("zlibbed")), "zlibbed"},
+		{"gzip", gz.Bytes(), "gzipped"},
+		{"xor:0102", []byte{0x60, 0x60, 0x62}, "abc"},
+	}
+
+	for _, test := range tests {
+		got, err := transformBytes(test.transform, test.in)
+		if err != nil || string(got) != test.want {
+			t.Errorf("transformBytes(%q, ...) = %q, %v want %q", test.transform, got, err, test.want)
+		}
+	}
+
+	for _, transform := range []string{"zip", "xor:", "xor:zz"} {
+		if _, err := transformBytes(transform, nil); err == nil {
+			t.Errorf("transformBytes(%q, ...) error = nil want error", transform)
+		}
+	}
+	if _, err := transformBytes("zlib", []byte("not zlib")); err == nil {
+		t.Errorf("transformBytes(zlib, \"not zlib\") error = nil want error")
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	tests := []string{
+		`transform="zip"`,
+		`transform="zlib" structure="id:404"`,
+		`transform="zlib" structure="id:1"`,
+	}
+
+	for _, attrs := range tests {
+		xml := testHeader + `<structure name="File" id="99">
+			<binary name="Data" id="1" length="2" ` + attrs + `/>
+		</structure>` + testFooter
+
+		if _, errs := ParseXmlGrammar(strings.NewReader(xml)); len(errs) == 0 {
+			t.Errorf("ParseXmlGrammar(%s) = nil error want error", attrs)
+		}
+	}
+}
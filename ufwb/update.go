@@ -33,10 +33,10 @@ func (g *Grammar) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 		if s, ok := e.(*Structure); ok {
 			g.Start = s
 		} else {
-			errs.Append(&validationError{e: g, err: fmt.Errorf("start element %q is not a top level Structure", g.Xml.Start)})
+			errs.Append(&validationError{e: g, attr: "start", err: fmt.Errorf("start element %q is not a top level Structure", g.Xml.Start)})
 		}
 	} else {
-		errs.Append(&validationError{e: g, err: fmt.Errorf("start element %q not found", g.Xml.Start)})
+		errs.Append(&validationError{e: g, attr: "start", err: fmt.Errorf("start element %q not found", g.Xml.Start)})
 	}
 }
 
@@ -81,12 +81,20 @@ func (n *Number) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 	for _, v := range n.values {
 		bs, err := parseInt(v.Xml.Value, 0, 0, n.Signed())
 		if err != nil {
-			errs.Append(err)
+			errs.Append(&validationError{e: n, attr: "value", pos: v.Xml.Pos, err: err})
 		}
 		v.value = bs
 	}
 
-	// TODO Check Masks  []*Mask       `xml:"mask,omitempty"`
+	for _, m := range n.masks {
+		for _, v := range m.values {
+			bs, err := parseInt(v.Xml.Value, 0, 0, false)
+			if err != nil {
+				errs.Append(&validationError{e: n, attr: "value", pos: v.Xml.Pos, err: err})
+			}
+			v.value = bs
+		}
+	}
 }
 
 func (b *Binary) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
@@ -98,6 +106,18 @@ func (b *Binary) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 
 	//b.unused = yesno(b.Xml.Unused, errs)
 	b.parent = parent
+
+	if ref := b.Xml.Structure; ref != "" {
+		if e, found := u.Get(ref); found {
+			if structure, ok := e.(*Structure); ok {
+				b.structure = structure
+			} else {
+				errs.Append(&validationError{e: b, attr: "structure", err: fmt.Errorf("reference element %q is not a structure", ref)})
+			}
+		} else {
+			errs.Append(&validationError{e: b, attr: "structure", err: fmt.Errorf("referenced struct %q not found", ref)})
+		}
+	}
 }
 
 func (s *String) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
@@ -129,10 +149,19 @@ func (s *String) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 }
 
 func (c *Custom) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
+	if c.Xml.Type != "" {
+		if t, found := LookupCustom(c.Xml.Type); found {
+			c.typ = t
+		} else {
+			errs.Append(&validationError{e: c, attr: "type", err: fmt.Errorf("custom type %q not registered", c.Xml.Type)})
+		}
+		return
+	}
+
 	if s, found := u.GetScript(c.Xml.Script); found {
 		c.script = s
 	} else {
-		errs.Append(&validationError{e: c, err: fmt.Errorf("script %q not found", c.Xml.Script)})
+		errs.Append(&validationError{e: c, attr: "script", err: fmt.Errorf("script %q not found", c.Xml.Script)})
 	}
 }
 
@@ -147,7 +176,7 @@ func (o *Offset) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 		if e, found := u.Get(o.Xml.RelativeTo); found {
 			o.relativeTo = e
 		} else {
-			errs.Append(&validationError{e: o, err: fmt.Errorf("relativeTo %q not found", o.Xml.RelativeTo)})
+			errs.Append(&validationError{e: o, attr: "relative-to", err: fmt.Errorf("relativeTo %q not found", o.Xml.RelativeTo)})
 		}
 	}
 
@@ -155,7 +184,7 @@ func (o *Offset) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 		if e, found := u.Get(o.Xml.References); found {
 			o.references = e
 		} else {
-			errs.Append(&validationError{e: o, err: fmt.Errorf("references %q not found", o.Xml.References)})
+			errs.Append(&validationError{e: o, attr: "references", err: fmt.Errorf("references %q not found", o.Xml.References)})
 		}
 	}
 
@@ -163,7 +192,7 @@ func (o *Offset) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 		if e, found := u.Get(o.Xml.ReferencedSize); found {
 			o.referencedSize = e
 		} else {
-			errs.Append(&validationError{e: o, err: fmt.Errorf("referencedSize %q not found", o.Xml.ReferencedSize)})
+			errs.Append(&validationError{e: o, attr: "referenced-size", err: fmt.Errorf("referencedSize %q not found", o.Xml.ReferencedSize)})
 		}
 	}
 }
@@ -185,10 +214,10 @@ func (s *StructRef) update(u *Ufwb, parent *Structure, errs *toerr.Errors) {
 		if structure, ok := e.(*Structure); ok {
 			s.structure = structure
 		} else {
-			errs.Append(&validationError{e: s, err: fmt.Errorf("reference element %q is not a structure", ref)})
+			errs.Append(&validationError{e: s, attr: "structure", err: fmt.Errorf("reference element %q is not a structure", ref)})
 		}
 
 	} else {
-		errs.Append(&validationError{e: s, err: fmt.Errorf("referenced struct %q not found", ref)})
+		errs.Append(&validationError{e: s, attr: "structure", err: fmt.Errorf("referenced struct %q not found", ref)})
 	}
 }
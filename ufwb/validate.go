@@ -16,6 +16,8 @@ var (
 		"display":     {"dec", "hex", "binary"}, // TODO Maybe "offset"? // TODO "dec" was a guess
 		"string-type": {"zero-terminated", "fixed-length", "pascal"},
 		"number-type": {"integer", "float"},
+		"transform":   Transforms(),
+		"checksum":    Checksums(),
 	}
 )
 
@@ -26,17 +28,32 @@ type Eof interface {
 // TODO clean up validationError vs assertationError, vs whatever else
 // validationError represents a error validating this element
 type validationError struct {
-	e   ElementId
-	err error
+	e    ElementId
+	attr string    // Optional name of the attribute with the error
+	pos  *Position // Optional position of the child of e with the error, such as a <fixedvalue>
+	err  error
 }
 
 func (err *validationError) IsEof() bool {
 	return err.err == io.EOF
 }
 
+// Pos returns where in the grammar file the error is, or nil if not known.
+func (err *validationError) Pos() *Position {
+	pos := err.pos
+	if pos == nil {
+		pos = posOf(err.e)
+	}
+	return pos.Attr(err.attr)
+}
+
 func (err *validationError) Error() string {
 	elem := err.e
-	return fmt.Sprintf("<%T id=%d name=%q>: %s", elem, elem.Id(), elem.Name(), err.err.Error())
+	msg := fmt.Sprintf("<%T id=%d name=%q>: %s", elem, elem.Id(), elem.Name(), err.err.Error())
+	if pos := err.Pos(); pos != nil {
+		return pos.String() + ": " + msg
+	}
+	return msg
 }
 
 type assertationError struct {
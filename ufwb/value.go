@@ -1,7 +1,6 @@
 package ufwb
 
 import (
-	"bramp.net/dsector/input"
 	"encoding/binary"
 	"fmt"
 	"io"
@@ -15,6 +14,8 @@ type Value struct {
 	Element Element
 	Extra   interface{} // Extra info defined by the Element
 
+	Checksum *Checksum // Only set if the Element has a checksum attribute
+
 	Children []*Value
 
 	ByteOrder binary.ByteOrder // Only used for Number, TODO, and TODO. Why have this?
@@ -28,11 +29,44 @@ func (v *Value) Description() string {
 	return v.Element.Description()
 }
 
-// String returns this value's string representation (based on display, etc)
+// Format returns this value's string representation (based on display, etc). Values with
+// children only return a summary, use FormatTo to format the whole tree.
 func (v *Value) Format(file io.ReaderAt) (string, error) {
 	return v.Element.Format(file, v)
 }
 
+// FormatTo writes this value, and all its children, as a indented tree to w.
+func (v *Value) FormatTo(w io.Writer, file io.ReaderAt) error {
+	return FormatTo(w, file, v)
+}
+
+// Select returns the Values under this value that match the query path. See Query for the syntax.
+func (v *Value) Select(file io.ReaderAt, path string) ([]*Match, error) {
+	q, err := ParseQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	return q.Select(file, v)
+}
+
+// Int returns the value of a Number cast to a int64.
+func (v *Value) Int(file io.ReaderAt) (int64, error) {
+	n, ok := v.Element.(*Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is a %s not a Number", v.Name(), elemType(v.Element))
+	}
+	return n.Int(file, v)
+}
+
+// Uint returns the value of a Number cast to a uint64.
+func (v *Value) Uint(file io.ReaderAt) (uint64, error) {
+	n, ok := v.Element.(*Number)
+	if !ok {
+		return 0, fmt.Errorf("%s is a %s not a Number", v.Name(), elemType(v.Element))
+	}
+	return n.Uint(file, v)
+}
+
 func (v *Value) String() string {
 	if v == nil {
 		return "<nil>"
@@ -45,8 +79,10 @@ func (v *Value) String() string {
 	return fmt.Sprintf("[0x%x len:%d] %s", v.Offset, v.Len, elem)
 }
 
-func (v *Value) Write(f input.Input) {
-	panic("TODO")
+// Write writes the bytes this value represents to w, reading the value from file.
+// Writing the root Value reproduces the original file.
+func (v *Value) Write(w io.Writer, file io.ReaderAt) error {
+	return checkWrite(w, file, v)
 }
 
 // find does a depth-first search of this value looking for a value matching the given element.
@@ -0,0 +1,631 @@
+package ufwb
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// luaCode is a block of generated Lua code.
+type luaCode struct {
+	lines []string
+	depth int
+}
+
+func (c *luaCode) line(format string, args ...interface{}) {
+	c.lines = append(c.lines, strings.Repeat("\t", c.depth)+fmt.Sprintf(format, args...))
+}
+
+func (c *luaCode) indent() {
+	c.depth++
+}
+
+func (c *luaCode) dedent() {
+	c.depth--
+}
+
+// append adds the lines of other, indented to this block's depth.
+func (c *luaCode) append(other *luaCode) {
+	for _, l := range other.lines {
+		c.lines = append(c.lines, strings.Repeat("\t", c.depth)+l)
+	}
+}
+
+// hasLocals returns true if the block declares any top level locals.
+func (c *luaCode) hasLocals() bool {
+	for _, l := range c.lines {
+		if strings.HasPrefix(l, "local ") {
+			return true
+		}
+	}
+	return false
+}
+
+// wiresharkHelpers are Lua functions added to the dissector when used.
+var wiresharkHelpers = map[string][]string{
+	"find_delimiter": {
+		"-- find_delimiter returns the length of the string at offset, including the delimiter.",
+		"local function find_delimiter(buffer, offset, limit, delimiter)",
+		"\tfor i = offset, limit - 1 do",
+		"\t\tif buffer(i, 1):uint() == delimiter then",
+		"\t\t\treturn i - offset + 1",
+		"\t\tend",
+		"\tend",
+		"\treturn limit - offset",
+		"end",
+	},
+	"xor_bytes": {
+		"-- xor_bytes returns a new Tvb, named name, of the range xored with the key.",
+		"local function xor_bytes(range, key, name)",
+		"\tlocal data = range:bytes()",
+		"\tfor i = 0, data:len() - 1 do",
+		"\t\tdata:set_index(i, bit.bxor(data:get_index(i), key[i % #key + 1]))",
+		"\tend",
+		"\treturn data:tvb(name)",
+		"end",
+	},
+}
+
+// luaKeywords are reserved, so can't be used as names, even of a table field such as "f.end".
+var luaKeywords = []string{
+	"and", "break", "do", "else", "elseif", "end", "false", "for", "function", "goto", "if",
+	"in", "local", "nil", "not", "or", "repeat", "return", "then", "true", "until", "while",
+}
+
+// luaNames returns a set of used names, to be passed to unique, with the keywords reserved.
+func luaNames() map[string]bool {
+	used := make(map[string]bool)
+	for _, k := range luaKeywords {
+		used[k] = true
+	}
+	return used
+}
+
+// wiresharkWriter converts a grammar into a Wireshark Lua dissector.
+type wiresharkWriter struct {
+	u      *Ufwb
+	issues []*LintIssue
+	proto  string // Name of the protocol, and prefix of all field abbreviations
+
+	names map[*Structure]string // Name of the dissect function for each structure
+	queue []*Structure          // Structures referenced, but not yet written
+
+	// Names already used in the f, vs and dissect tables. The definitions are kept in tables,
+	// as Lua limits a function, including the main chunk, to 200 locals.
+	usedFields, usedValues, usedFuncs map[string]bool
+
+	fields  []string // Names of the ProtoFields
+	defs    luaCode  // value_string and ProtoField definitions
+	funcs   luaCode  // The dissect functions
+	helpers map[string]bool
+}
+
+// WriteWireshark writes the grammar as a Wireshark (https://www.wireshark.org) Lua dissector
+// to w. Each structure becomes a subtree, numbers, strings and binaries become ProtoFields,
+// fixed values become value_string tables, and masks become bitmask fields.
+//
+// The dissector is not registered on any port, instead it can be chosen for any TCP or UDP
+// port with "Decode As...". Constructs that can't be expressed, such as scripts and custom
+// elements, are omitted and returned as issues.
+func WriteWireshark(w io.Writer, u *Ufwb) ([]*LintIssue, error) {
+	g := u.Grammar
+	if g == nil || g.Start == nil {
+		return nil, errors.New("grammar has no start structure")
+	}
+
+	ws := &wiresharkWriter{
+		u:       u,
+		proto:   snakeCase(g.Name()),
+		names:   make(map[*Structure]string),
+		helpers: make(map[string]bool),
+
+		usedFields: luaNames(),
+		usedValues: luaNames(),
+		usedFuncs:  luaNames(),
+	}
+
+	start := ws.dissector(g.Start)
+	for len(ws.queue) > 0 {
+		s := ws.queue[0]
+		ws.queue = ws.queue[1:]
+		ws.structure(s)
+	}
+
+	var c luaCode
+	c.line("-- Wireshark dissector for the %s grammar, generated by dsector.", g.Name())
+	if d := g.Description(); d != "" {
+		c.line("--")
+		for _, l := range strings.Split(strings.TrimSpace(d), "\n") {
+			c.line("-- %s", strings.TrimSpace(l))
+		}
+	}
+	c.line("--")
+	c.line("-- Load it with \"wireshark -X lua_script:%s.lua\", and then select the protocol", ws.proto)
+	c.line("-- with \"Decode As...\".")
+	c.line("")
+	c.line("local proto = Proto(%s, %s)", luaString(ws.proto), luaString(g.Name()))
+	c.line("")
+	c.line("local f, vs, dissect = {}, {}, {}")
+	c.line("")
+	c.lines = append(c.lines, ws.defs.lines...)
+	c.line("")
+	c.line("proto.fields = {")
+	for _, f := range ws.fields {
+		c.line("\t%s,", f)
+	}
+	c.line("}")
+
+	var helpers []string
+	for name := range ws.helpers {
+		helpers = append(helpers, name)
+	}
+	sort.Strings(helpers)
+	for _, name := range helpers {
+		c.line("")
+		c.lines = append(c.lines, wiresharkHelpers[name]...)
+	}
+
+	c.lines = append(c.lines, ws.funcs.lines...)
+
+	c.line("")
+	c.line("function proto.dissector(buffer, pinfo, tree)")
+	c.line("\tpinfo.cols.protocol = proto.name")
+	c.line("\t%s(buffer, 0, tree, {}, buffer:len())", start)
+	c.line("end")
+	c.line("")
+	c.line("-- Allow the protocol to be chosen with \"Decode As...\" on any TCP or UDP port")
+	c.line("DissectorTable.get(\"tcp.port\"):add_for_decode_as(proto)")
+	c.line("DissectorTable.get(\"udp.port\"):add_for_decode_as(proto)")
+
+	_, err := io.WriteString(w, strings.Join(c.lines, "\n")+"\n")
+	return ws.issues, err
+}
+
+func (ws *wiresharkWriter) add(severity Severity, e ElementId, format string, args ...interface{}) {
+	ws.issues = append(ws.issues, &LintIssue{
+		Severity: severity,
+		Element:  e,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// omit reports the element can't be expressed, and adds a comment to the code.
+func (ws *wiresharkWriter) omit(c *luaCode, e ElementId, format string, args ...interface{}) {
+	msg := fmt.Sprintf(format, args...)
+	ws.add(Error, e, "%s", msg)
+	c.line("-- %s is omitted: %s", e.Name(), msg)
+}
+
+// luaString returns s as a quoted Lua string. Lua only has decimal \ddd escapes for bytes, so
+// they are always three digits, to not run into a following digit.
+func luaString(s string) string {
+	var buf bytes.Buffer
+	buf.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case c >= 0x20 && c < 0x7f:
+			buf.WriteByte(c)
+		default:
+			fmt.Fprintf(&buf, "\\%03d", c)
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// dissector returns the name of the dissect function for this structure, queuing it to be
+// written.
+func (ws *wiresharkWriter) dissector(s *Structure) string {
+	if name, found := ws.names[s]; found {
+		return "dissect." + name
+	}
+
+	name := unique(snakeCase(s.Name()), ws.usedFuncs)
+	ws.names[s] = name
+	ws.queue = append(ws.queue, s)
+	return "dissect." + name
+}
+
+// field defines a ProtoField, returning its Lua name.
+func (ws *wiresharkWriter) field(name string, format string, args ...interface{}) string {
+	name = "f." + unique(name, ws.usedFields)
+	ws.fields = append(ws.fields, name)
+	ws.defs.line("%s = %s", name, fmt.Sprintf(format, args...))
+	return name
+}
+
+// valueString defines a value_string table for the fixed values, returning its Lua name.
+func (ws *wiresharkWriter) valueString(name string, values []*FixedValue) string {
+	name = "vs." + unique(name, ws.usedValues)
+	ws.defs.line("%s = {", name)
+	for _, v := range values {
+		ws.defs.line("\t[%v] = %s,", v.value, luaString(v.name))
+	}
+	ws.defs.line("}")
+	return name
+}
+
+// structure writes the dissect function for this structure.
+func (ws *wiresharkWriter) structure(s *Structure) {
+	name := ws.names[s]
+	abbr := ws.proto + "." + name
+	tree := ws.field(name, "ProtoField.none(%s, %s)", luaString(abbr), luaString(s.Name()))
+
+	c := &ws.funcs
+	c.line("")
+	c.line("-- dissect.%s dissects the %s structure, returning the offset after it.", name, s.Name())
+	c.line("function dissect.%s(buffer, offset, tree, prev, limit)", name)
+	c.indent()
+	c.line("local start = offset")
+	c.line("local subtree = tree:add(%s, buffer(offset, 0))", tree)
+
+	if s.Order() == VariableOrder {
+		ws.add(Error, s, "variable order can't be expressed, elements are dissected in fixed order")
+	}
+	if s.Endian() == DynamicEndian {
+		ws.add(Error, s, "dynamic endian can't be expressed, using little endian")
+	}
+
+	length := ""
+	if s.Length() != nil {
+		if l, ok := ws.length(s, s); ok {
+			length = l
+			c.line("limit = offset + %s", length)
+		}
+	}
+
+	ids := make(map[string]string)
+	used := make(map[string]bool)
+	for _, e := range s.Elements() {
+		if _, found := ids[e.Name()]; !found {
+			ids[e.Name()] = unique(snakeCase(e.Name()), used)
+		}
+		ws.element(c, s, e, name+"_"+ids[e.Name()], abbr+"."+ids[e.Name()])
+	}
+
+	if length != "" {
+		c.line("offset = limit")
+	}
+	c.line("subtree:set_len(offset - start)")
+	c.line("return offset")
+	c.dedent()
+	c.line("end")
+}
+
+// element writes the code to dissect the element, repeating it as needed.
+func (ws *wiresharkWriter) element(c *luaCode, s *Structure, e Element, name, abbr string) {
+	body := &luaCode{}
+	if !ws.body(body, s, e, name, abbr) {
+		c.append(body)
+		return
+	}
+
+	if _, ok := e.(*Custom); ok || isOne(e) {
+		if body.hasLocals() {
+			c.line("do")
+			c.indent()
+			c.append(body)
+			c.dedent()
+			c.line("end")
+		} else {
+			c.append(body)
+		}
+		return
+	}
+
+	min, max := e.RepeatMin(), e.RepeatMax()
+	if max == StringExpression("unlimited") {
+		c.line("while offset < limit do")
+	} else {
+		if min != max {
+			ws.add(Warning, e, "repeatmin %s can't be expressed, repeating repeatmax %s times", exprString(min), exprString(max))
+		}
+		count, ok := ws.expr(e, "repeatmax", max)
+		if !ok {
+			c.line("-- %s is omitted: repeatmax %s can't be expressed", e.Name(), exprString(max))
+			return
+		}
+		c.line("for i = 1, %s do", count)
+	}
+	c.indent()
+	c.append(body)
+	c.dedent()
+	c.line("end")
+}
+
+// body writes the code to dissect a single instance of the element. It returns false if the
+// element was omitted.
+func (ws *wiresharkWriter) body(c *luaCode, s *Structure, e Element, name, abbr string) bool {
+	switch e := e.(type) {
+	case *Number:
+		return ws.number(c, s, e, name, abbr)
+	case *String:
+		return ws.string(c, e, name, abbr)
+	case *Binary:
+		return ws.binary(c, e, name, abbr)
+
+	case *Structure:
+		c.line("offset = %s(buffer, offset, subtree, prev, limit)", ws.dissector(e))
+
+	case *StructRef:
+		if e.Structure() == nil {
+			ws.omit(c, e, "reference to a missing structure")
+			return false
+		}
+		c.line("offset = %s(buffer, offset, subtree, prev, limit)", ws.dissector(e.Structure()))
+
+	case *Custom:
+		length, ok := ws.length(e, e)
+		if !ok {
+			ws.omit(c, e, "custom elements can't be expressed")
+			return false
+		}
+		ws.add(Error, e, "custom elements can't be expressed, adding it as bytes")
+		f := ws.field(name, "ProtoField.bytes(%s, %s)", luaString(abbr), luaString(e.Name()))
+		c.line("local len = %s", length)
+		c.line("subtree:add(%s, buffer(offset, len))", f)
+		c.line("offset = offset + len")
+
+	case *Script:
+		ws.omit(c, e, "scripts can't be expressed")
+		return false
+
+	default:
+		ws.omit(c, e, "%s elements can't be expressed", elemType(e))
+		return false
+	}
+	return true
+}
+
+// number writes the code to add a Number, and its masks, to the subtree.
+func (ws *wiresharkWriter) number(c *luaCode, s *Structure, n *Number, name, abbr string) bool {
+	bits, ok := bitLength(n)
+	if !ok {
+		ws.omit(c, n, "length %s can't be expressed for a number", exprString(n.Length()))
+		return false
+	}
+	if bits%8 != 0 {
+		ws.omit(c, n, "%d bit numbers can't be expressed", bits)
+		return false
+	}
+	size := bits / 8
+
+	add, le := "add", ""
+	switch n.Endian() {
+	case LittleEndian:
+		add, le = "add_le", "le_"
+	case DynamicEndian:
+		ws.add(Error, n, "dynamic endian can't be expressed, using little endian")
+		add, le = "add_le", "le_"
+	}
+
+	var typ, read string
+	switch {
+	case n.Type == "integer" && (size == 1 || size == 2 || size == 3 || size == 4 || size == 8):
+		typ, read = "uint", "uint"
+		if n.Signed() {
+			typ, read = "int", "int"
+		}
+		typ += strconv.FormatInt(bits, 10)
+		if size == 8 {
+			read += "64():tonumber"
+		}
+	case n.Type == "float" && (size == 4 || size == 8):
+		typ, read = "float", "float"
+		if size == 8 {
+			typ = "double"
+		}
+	default:
+		ws.add(Error, n, "%d byte %s numbers can't be expressed, adding it as bytes", size, n.Type)
+		f := ws.field(name, "ProtoField.bytes(%s, %s)", luaString(abbr), luaString(n.Name()))
+		c.line("subtree:add(%s, buffer(offset, %d))", f, size)
+		c.line("offset = offset + %d", size)
+		return true
+	}
+
+	var f string
+	if n.Type == "integer" {
+		base := "base.DEC"
+		if !n.Signed() && (n.Display() == HexDisplay || n.Display() == BinaryDisplay) {
+			base = "base.HEX"
+		}
+		vs := "nil"
+		if len(n.Values()) > 0 {
+			vs = ws.valueString(name, n.Values())
+		}
+		f = ws.field(name, "ProtoField.%s(%s, %s, %s, %s)", typ, luaString(abbr), luaString(n.Name()), base, vs)
+	} else {
+		f = ws.field(name, "ProtoField.%s(%s, %s)", typ, luaString(abbr), luaString(n.Name()))
+		if len(n.Values()) > 0 {
+			ws.add(Warning, n, "fixed values of %s numbers can't be expressed as a value_string, omitting them", n.Type)
+		}
+	}
+
+	masks := n.Masks()
+	if len(masks) > 0 && n.Type == "integer" {
+		// Masks are always unsigned
+		mtyp := typ
+		if strings.HasPrefix(typ, "int") {
+			mtyp = "u" + typ
+		}
+
+		c.line("local item = subtree:%s(%s, buffer(offset, %d))", add, f, size)
+		for _, m := range masks {
+			mname := name + "_" + snakeCase(m.name)
+			vs := "nil"
+			if len(m.values) > 0 {
+				vs = ws.valueString(mname, m.values)
+			}
+			mf := ws.field(mname, "ProtoField.%s(%s, %s, base.HEX, %s, 0x%X)", mtyp,
+				luaString(abbr+"."+snakeCase(m.name)), luaString(m.name), vs, m.value)
+			c.line("item:%s(%s, buffer(offset, %d))", add, mf, size)
+		}
+	} else {
+		if len(masks) > 0 {
+			ws.add(Warning, n, "masks of %s numbers can't be expressed, omitting them", n.Type)
+		}
+		c.line("subtree:%s(%s, buffer(offset, %d))", add, f, size)
+	}
+
+	if n.Checksum() != "" {
+		ws.add(Warning, n, "checksums can't be expressed, the %s won't be verified", n.Checksum())
+	}
+
+	c.line("prev[%s] = buffer(offset, %d):%s%s()", luaString(n.Name()), size, le, read)
+	c.line("offset = offset + %d", size)
+	return true
+}
+
+// string writes the code to add a String to the subtree.
+func (ws *wiresharkWriter) string(c *luaCode, str *String, name, abbr string) bool {
+	enc := ws.encoding(str)
+	if len(str.Values()) > 0 {
+		ws.add(Warning, str, "fixed values of strings can't be expressed as a value_string, omitting them")
+	}
+
+	typ := "string"
+	switch str.Typ() {
+	case "fixed-length":
+		length, ok := ws.length(str, str)
+		if !ok {
+			c.line("-- %s is omitted: its length can't be expressed", str.Name())
+			return false
+		}
+		c.line("local len = %s", length)
+	case "zero-terminated":
+		typ = "stringz"
+		c.line("local len = buffer(offset):strsize(%s)", enc)
+	case "delimiter-terminated":
+		ws.helpers["find_delimiter"] = true
+		c.line("local len = find_delimiter(buffer, offset, limit, 0x%02X)", str.Delimiter())
+	case "pascal":
+		typ = "uint_string"
+		c.line("local len = 1 + buffer(offset, 1):uint()")
+	default:
+		ws.omit(c, str, "%q strings can't be expressed", str.Typ())
+		return false
+	}
+
+	f := ws.field(name, "ProtoField.%s(%s, %s)", typ, luaString(abbr), luaString(str.Name()))
+	c.line("subtree:add_packet_field(%s, buffer(offset, len), %s)", f, enc)
+	c.line("offset = offset + len")
+	return true
+}
+
+// encoding returns the Wireshark encoding for the string.
+func (ws *wiresharkWriter) encoding(str *String) string {
+	switch strings.ToUpper(str.Encoding()) {
+	case "UTF-8":
+		return "ENC_UTF_8"
+	case "US-ASCII", "ASCII", "ANSI_X3.4-1968":
+		return "ENC_ASCII"
+	case "ISO-8859-1", "ISO_8859-1:1987":
+		return "ENC_ISO_8859_1"
+	case "UTF-16LE":
+		return "ENC_UTF_16 + ENC_LITTLE_ENDIAN"
+	case "UTF-16", "UTF-16BE":
+		return "ENC_UTF_16 + ENC_BIG_ENDIAN"
+	}
+	ws.add(Warning, str, "encoding %q can't be expressed, using UTF-8", str.Encoding())
+	return "ENC_UTF_8"
+}
+
+// binary writes the code to add a Binary to the subtree, and dissect its structure.
+func (ws *wiresharkWriter) binary(c *luaCode, b *Binary, name, abbr string) bool {
+	length, ok := ws.length(b, b)
+	if !ok {
+		c.line("-- %s is omitted: its length can't be expressed", b.Name())
+		return false
+	}
+
+	if len(b.Values()) > 0 {
+		ws.add(Warning, b, "fixed values of binaries can't be expressed, they won't be checked")
+	}
+	if b.Checksum() != "" {
+		ws.add(Warning, b, "checksums can't be expressed, the %s won't be verified", b.Checksum())
+	}
+
+	f := ws.field(name, "ProtoField.bytes(%s, %s)", luaString(abbr), luaString(b.Name()))
+	c.line("local len = %s", length)
+	if b.Structure() != nil {
+		c.line("local item = subtree:add(%s, buffer(offset, len))", f)
+	} else {
+		c.line("subtree:add(%s, buffer(offset, len))", f)
+	}
+
+	data := ""
+	switch t := b.Transform(); {
+	case t == "":
+	case t == "zlib" || t == "gzip":
+		data = "data"
+		c.line("local data = buffer(offset, len):uncompress(%s)", luaString(b.Name()))
+	case strings.HasPrefix(t, "xor:"):
+		_, key, err := parseTransform(t)
+		if err != nil {
+			ws.add(Error, b, "%s", err)
+			break
+		}
+		var bs []string
+		for _, k := range key {
+			bs = append(bs, fmt.Sprintf("0x%02X", k))
+		}
+		ws.helpers["xor_bytes"] = true
+		data = "data"
+		c.line("local data = xor_bytes(buffer(offset, len), {%s}, %s)", strings.Join(bs, ", "), luaString(b.Name()))
+	default:
+		ws.add(Error, b, "transform %q can't be expressed, the bytes won't be transformed", t)
+	}
+
+	if s := b.Structure(); s != nil {
+		if data != "" {
+			c.line("if data then")
+			c.line("\t%s(data, 0, item, prev, data:len())", ws.dissector(s))
+			c.line("end")
+		} else {
+			c.line("%s(buffer, offset, item, prev, offset + len)", ws.dissector(s))
+		}
+	}
+
+	c.line("offset = offset + len")
+	return true
+}
+
+// length returns the Lua expression for the element's length in bytes.
+func (ws *wiresharkWriter) length(e Element, l Lengthable) (string, bool) {
+	if l.LengthUnit() == BitLengthUnit {
+		bits, ok := l.Length().(ConstExpression)
+		if !ok || bits%8 != 0 {
+			ws.add(Error, e, "length of %s bits can't be expressed", exprString(l.Length()))
+			return "", false
+		}
+		return strconv.FormatInt(int64(bits/8), 10), true
+	}
+	return ws.expr(e, "length", l.Length())
+}
+
+// expr converts the expression to Lua.
+func (ws *wiresharkWriter) expr(e Element, attr string, expr Expression) (string, bool) {
+	switch expr := expr.(type) {
+	case ConstExpression:
+		return strconv.FormatInt(int64(expr), 10), true
+
+	case StringExpression:
+		switch str := string(expr); {
+		case str == "remaining":
+			return "limit - offset", true
+		case strings.HasPrefix(str, "prev."):
+			return "prev[" + luaString(strings.TrimPrefix(str, "prev.")) + "]", true
+		}
+	}
+
+	ws.add(Error, e, "%s %s can't be expressed", attr, exprString(expr))
+	return "", false
+}
@@ -0,0 +1,142 @@
+package ufwb
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/kylelemons/godebug/pretty"
+	"github.com/yuin/gopher-lua"
+	"strings"
+	"testing"
+)
+
+func TestWriteWireshark(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(kaitaiTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	issues, err := WriteWireshark(&buf, u)
+	if err != nil {
+		t.Fatalf("WriteWireshark(...) = %q want nil error", err)
+	}
+	got := buf.String()
+
+	// The generated dissector should at least be valid Lua
+	L := lua.NewState()
+	defer L.Close()
+	if _, err := L.LoadString(got); err != nil {
+		t.Errorf("WriteWireshark(...) is not valid Lua: %s\n%s", err, got)
+	}
+
+	for _, want := range []string{
+		`local proto = Proto("test_file", "Test File")`,
+		`local f, vs, dissect = {}, {}, {}`,
+		"vs.file_type = {\n\t[1] = \"PNG\",\n\t[2] = \"JPEG\",\n}",
+		`f.file_type = ProtoField.int16("test_file.file.type", "Type", base.DEC, vs.file_type)`,
+		`f.file_type_flags = ProtoField.uint16("test_file.file.type.flags", "Flags", base.HEX, nil, 0xF0)`,
+		`f.record_text = ProtoField.string("test_file.record.text", "Text")`,
+		`function dissect.record(buffer, offset, tree, prev, limit)`,
+
+		// Numbers are added with their endian, and remembered for later expressions
+		"\t\tlocal item = subtree:add_le(f.file_type, buffer(offset, 2))\n" +
+			"\t\titem:add_le(f.file_type_flags, buffer(offset, 2))\n" +
+			"\t\tprev[\"Type\"] = buffer(offset, 2):le_int()\n",
+
+		// Repeats and nested structures
+		"\tfor i = 1, prev[\"Count\"] do\n" +
+			"\t\toffset = dissect.record(buffer, offset, subtree, prev, limit)\n" +
+			"\tend\n",
+		"\twhile offset < limit do\n" +
+			"\t\toffset = dissect.trailer(buffer, offset, subtree, prev, limit)\n" +
+			"\tend\n",
+
+		// Strings and binaries
+		"\t\tlocal len = prev[\"Length\"]\n" +
+			"\t\tsubtree:add_packet_field(f.record_text, buffer(offset, len), ENC_UTF_16 + ENC_LITTLE_ENDIAN)\n",
+		"\t\tlocal len = buffer(offset):strsize(ENC_UTF_8)\n",
+		"\t\tlocal len = limit - offset\n" +
+			"\t\tsubtree:add(f.trailer_data, buffer(offset, len))\n" +
+			"\t\tlocal data = xor_bytes(buffer(offset, len), {0xAA, 0x55}, \"Data\")\n",
+
+		"\t-- Check is omitted: scripts can't be expressed\n",
+		"\tdissect.file(buffer, 0, tree, {}, buffer:len())\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("WriteWireshark(...) does not contain:\n%s\n\ngot:\n%s", want, got)
+		}
+	}
+
+	var gotIssues []string
+	for _, issue := range issues {
+		gotIssues = append(gotIssues, issue.Error())
+	}
+	wantIssues := []string{
+		`5:3: warning: <*ufwb.Binary id=2 name="Magic">: fixed values of binaries can't be expressed, they won't be checked`,
+		`22:3: error: <*ufwb.Script id=13 name="Check">: scripts can't be expressed`,
+		`17:4: warning: <*ufwb.Number id=8 name="Values">: repeatmin 0 can't be expressed, repeating repeatmax "prev.Count" times`,
+		`26:2: error: <*ufwb.Structure id=12 name="Trailer">: variable order can't be expressed, elements are dissected in fixed order`,
+	}
+	if diff := pretty.Compare(gotIssues, wantIssues); diff != "" {
+		t.Errorf("WriteWireshark(...) issues = -got +want:\n%s", diff)
+	}
+}
+
+func TestWriteWiresharkManyFields(t *testing.T) {
+	// Lua allows at most 200 locals in a function, so the fields can't each be a local
+	var elements bytes.Buffer
+	for i := 0; i < 250; i++ {
+		fmt.Fprintf(&elements, `<number name="N%d" type="integer" length="1">
+			<fixedvalue name="zero" value="0"/>
+		</number>`, i)
+	}
+	// and "end" is a keyword, so can't be used as the name of a dissect function either
+	xml := testHeader + `<structure name="File" id="99">` + elements.String() + `
+			<structref name="Tail" structure="id:100"/>
+		</structure>
+		<structure name="end" id="100"/>` + testFooter
+
+	u, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	var buf bytes.Buffer
+	if _, err := WriteWireshark(&buf, u); err != nil {
+		t.Fatalf("WriteWireshark(...) = %q want nil error", err)
+	}
+	got := buf.String()
+
+	L := lua.NewState()
+	defer L.Close()
+	if _, err := L.LoadString(got); err != nil {
+		t.Errorf("WriteWireshark(...) is not valid Lua: %s", err)
+	}
+
+	// gopher-lua doesn't enforce the limit, so count the top level locals
+	locals := 0
+	for _, line := range strings.Split(got, "\n") {
+		if strings.HasPrefix(line, "local ") {
+			locals++
+		}
+	}
+	if locals > 10 {
+		t.Errorf("WriteWireshark(...) has %d top level locals, want at most 10", locals)
+	}
+}
+
+func TestLuaString(t *testing.T) {
+	tests := map[string]string{
+		"abc":     `"abc"`,
+		`a"b\c`:   `"a\"b\\c"`,
+		"a\nb":    `"a\010b"`,
+		"\x001":   `"\0001"`,
+		"Größe":   `"Gr\195\182\195\159e"`,
+		"\u2028x": `"\226\128\168x"`,
+	}
+	for s, want := range tests {
+		if got := luaString(s); got != want {
+			t.Errorf("luaString(%q) = %s want %s", s, got, want)
+		}
+	}
+}
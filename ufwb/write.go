@@ -0,0 +1,158 @@
+package ufwb
+
+// This file writes decoded Values back out as bytes. Numbers are decoded from the file and
+// encoded again, while Strings, Binaries and any bytes not covered by a value are copied as is.
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// writeRaw copies the bytes of value from file to w.
+func writeRaw(w io.Writer, file io.ReaderAt, value *Value) error {
+	return copyRange(w, file, value.Offset, value.Offset+value.Len)
+}
+
+// copyRange copies the bytes [start, end) from file to w.
+func copyRange(w io.Writer, file io.ReaderAt, start, end int64) error {
+	if start >= end {
+		return nil
+	}
+	n, err := io.Copy(w, io.NewSectionReader(file, start, end-start))
+	if err != nil {
+		return err
+	}
+	if n != end-start {
+		return io.ErrUnexpectedEOF
+	}
+	return nil
+}
+
+// writeChildren writes each child in turn, copying any bytes between them that are not
+// covered by a child, so the whole of value is written.
+func writeChildren(w io.Writer, file io.ReaderAt, value *Value) error {
+	children := value.Children
+
+	// Values are normally in file order, but Offset elements can move around.
+	if !sort.SliceIsSorted(children, func(i, j int) bool {
+		return children[i].Offset < children[j].Offset
+	}) {
+		children = append([]*Value(nil), children...)
+		sort.SliceStable(children, func(i, j int) bool {
+			return children[i].Offset < children[j].Offset
+		})
+	}
+
+	pos := value.Offset
+	end := value.Offset + value.Len
+	for _, child := range children {
+		if child.Offset < pos {
+			return &validationError{e: child.Element, err: fmt.Errorf("value at 0x%x overlaps the previous value ending at 0x%x", child.Offset, pos)}
+		}
+		if child.Offset+child.Len > end {
+			return &validationError{e: child.Element, err: fmt.Errorf("value [0x%x, 0x%x) is outside its parent [0x%x, 0x%x)", child.Offset, child.Offset+child.Len, value.Offset, end)}
+		}
+		if err := copyRange(w, file, pos, child.Offset); err != nil {
+			return err
+		}
+		if err := child.Write(w, file); err != nil {
+			return err
+		}
+		pos = child.Offset + child.Len
+	}
+
+	return copyRange(w, file, pos, end)
+}
+
+func (g *Grammar) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeChildren(w, file, value)
+}
+
+func (s *Structure) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeChildren(w, file, value)
+}
+
+func (s *StructRef) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeChildren(w, file, value)
+}
+
+// Write copies the original bytes, as decoding and encoding the text again may not reproduce
+// them, for example with invalid characters or an unsupported encoding. Strings are only
+// encoded when edited or built, by the Editor and Encoder.
+func (s *String) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeRaw(w, file, value)
+}
+
+func (b *Binary) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	bs, err := b.Bytes(file, value)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(bs)
+	return err
+}
+
+func (n *Number) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	i, err := n.int(file, value)
+	if err != nil && err != io.EOF {
+		return err
+	}
+
+	b, err := encodeInt(i, value.Len, n.Signed(), value.ByteOrder)
+	if err != nil {
+		return &validationError{e: n, err: err}
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+func (g *GrammarRef) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeChildren(w, file, value)
+}
+
+func (o *Offset) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeChildren(w, file, value)
+}
+
+// Write writes nothing, as Scripts don't consume any bytes.
+func (s *Script) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return nil
+}
+
+func (p *Padding) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	return writeRaw(w, file, value)
+}
+
+// Write writes the value using the CustomType's Writer if it has one, otherwise the original
+// bytes are copied.
+func (c *Custom) Write(w io.Writer, file io.ReaderAt, value *Value) error {
+	if writer, ok := c.Typ().(Writer); ok {
+		return writer.Write(w, file, value)
+	}
+	return writeRaw(w, file, value)
+}
+
+// writeLen wraps a io.Writer counting the bytes written.
+type writeLen struct {
+	w io.Writer
+	n int64
+}
+
+func (w *writeLen) Write(b []byte) (int, error) {
+	n, err := w.w.Write(b)
+	w.n += int64(n)
+	return n, err
+}
+
+// checkWrite calls the element's Write, and checks exactly value.Len bytes were written.
+func checkWrite(w io.Writer, file io.ReaderAt, value *Value) error {
+	lw := &writeLen{w: w}
+	if err := value.Element.Write(lw, file, value); err != nil {
+		return err
+	}
+	if lw.n != value.Len {
+		return &validationError{e: value.Element, err: fmt.Errorf("wrote %d bytes want %d", lw.n, value.Len)}
+	}
+	return nil
+}
@@ -0,0 +1,182 @@
+package ufwb
+
+import (
+	"bramp.net/dsector/input"
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestValueWrite(t *testing.T) {
+	xml := testHeader +
+		`<structure name="File" id="99" endian="little" signed="no">
+			<binary name="Magic" id="1" length="2">
+				<fixedvalue name="magic" value="cafe"/>
+			</binary>
+			<structure name="Record" id="2" repeatmax="unlimited">
+				<number name="Length" id="3" type="integer" length="2"/>
+				<string name="Text" id="4" type="fixed-length" length="prev.Length"/>
+				<custom name="Size" id="5" type="test-varint"/>
+			</structure>
+		</structure>` + testFooter
+
+	grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	want := []byte("\xca\xfe\x02\x00hi\xac\x02\x05\x00hello\x01")
+	file := input.FromBytes(want)
+	value, err := NewDecoder(grammar, file).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := value.Write(&buf, file); err != nil {
+		t.Fatalf("value.Write(...) error = %q want nil error", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("value.Write(...) = %q want %q", got, want)
+	}
+}
+
+func TestValueWriteGaps(t *testing.T) {
+	blob := &Binary{Base: Base{elemType: "Binary", id: 2, name: "A"}}
+	value := &Value{
+		Offset:  1,
+		Len:     6,
+		Element: &Structure{Base: Base{elemType: "Structure", id: 1, name: "Root"}},
+		Children: []*Value{
+			// Out of order, with gaps between them
+			{Offset: 5, Len: 1, Element: blob},
+			{Offset: 2, Len: 2, Element: blob},
+		},
+	}
+
+	file := input.FromBytes([]byte("0123456789"))
+
+	var buf bytes.Buffer
+	if err := value.Write(&buf, file); err != nil {
+		t.Fatalf("value.Write(...) error = %q want nil error", err)
+	}
+	if got, want := buf.String(), "123456"; got != want {
+		t.Errorf("value.Write(...) = %q want %q", got, want)
+	}
+
+	// A value that claims to be longer than the file
+	value.Len = 20
+	if err := value.Write(&buf, file); err == nil {
+		t.Errorf("value.Write(...) = nil want error")
+	}
+
+	// Children that overlap, or are outside their parent
+	value.Len = 6
+	for _, child := range []*Value{
+		{Offset: 3, Len: 1, Element: blob},
+		{Offset: 6, Len: 2, Element: blob},
+	} {
+		value.Children = []*Value{{Offset: 2, Len: 2, Element: blob}, child}
+		if err := value.Write(&buf, file); err == nil {
+			t.Errorf("value.Write(...) with child [%d, %d) = nil want error", child.Offset, child.Offset+child.Len)
+		}
+	}
+}
+
+func TestValueWriteEdited(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(editTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	data := []byte("\x00\x06\x01\x02hiA\x00TG")
+	value, err := NewDecoder(grammar, input.FromBytes(data)).Decode()
+	if err != nil {
+		t.Fatalf("decoder.Decode() error = %q want nil error", err)
+	}
+
+	editor, err := NewEditor(input.FromBytes(data), value)
+	if err != nil {
+		t.Fatalf("NewEditor(...) error = %q want nil error", err)
+	}
+
+	matches, err := value.Select(editor, "File/Record/Body/Text")
+	if err != nil || len(matches) != 1 {
+		t.Fatalf("value.Select(...) = %v, %v want one match", matches, err)
+	}
+	if err := editor.Set(matches[0].Value, "hello"); err != nil {
+		t.Fatalf("editor.Set(...) error = %q want nil error", err)
+	}
+
+	// The edited tree should encode to the edited bytes
+	var buf bytes.Buffer
+	if err := editor.Root().Write(&buf, editor); err != nil {
+		t.Fatalf("value.Write(...) error = %q want nil error", err)
+	}
+	if got, want := buf.Bytes(), editor.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("value.Write(...) = %q want %q", got, want)
+	}
+}
+
+func TestValueWriteEncoded(t *testing.T) {
+	grammar, errs := ParseXmlGrammar(strings.NewReader(encodeTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	root := &JsonValue{
+		Name: "File",
+		Children: []*JsonValue{
+			{Name: "Record", Children: []*JsonValue{
+				{Name: "Title", Formatted: "Hé"},
+				{Name: "Note", Formatted: "café"},
+				{Name: "Delta", Value: "-2"},
+			}},
+		},
+	}
+
+	want, value, err := NewEncoder(grammar).Encode(root)
+	if err != nil {
+		t.Fatalf("encoder.Encode(...) error = %q want nil error", err)
+	}
+
+	var buf bytes.Buffer
+	if err := value.Write(&buf, input.FromBytes(want)); err != nil {
+		t.Fatalf("value.Write(...) error = %q want nil error", err)
+	}
+	if got := buf.Bytes(); !bytes.Equal(got, want) {
+		t.Errorf("value.Write(...) = %q want %q", got, want)
+	}
+}
+
+func TestValueWriteStrings(t *testing.T) {
+	// Bytes that aren't valid in, or can't be decoded from, each encoding
+	want := []byte("\x61\xe9\x00\xd8")
+
+	for _, encoding := range []string{"US-ASCII", "Shift_JIS", "UTF-16LE"} {
+		xml := testHeader +
+			`<structure name="File" id="99">
+				<string name="Text" id="1" type="fixed-length" length="4" encoding="` + encoding + `"/>
+			</structure>` + testFooter
+
+		grammar, errs := ParseXmlGrammar(strings.NewReader(xml))
+		if len(errs) > 0 {
+			t.Fatalf("ParseXmlGrammar(%s) = %q want nil error", encoding, errs)
+		}
+
+		file := input.FromBytes(want)
+		value, err := NewDecoder(grammar, file).Decode()
+		if err != nil {
+			t.Fatalf("decoder.Decode(%s) error = %q want nil error", encoding, err)
+		}
+
+		var buf bytes.Buffer
+		if err := value.Write(&buf, file); err != nil {
+			t.Errorf("value.Write(%s) error = %q want nil error", encoding, err)
+			continue
+		}
+		if got := buf.Bytes(); !bytes.Equal(got, want) {
+			t.Errorf("value.Write(%s) = %q want %q", encoding, got, want)
+		}
+	}
+}
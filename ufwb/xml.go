@@ -26,6 +26,8 @@ type XmlIdName struct {
 	Id          int    `xml:"id,attr,omitempty"`
 	Name        string `xml:"name,attr,omitempty"`
 	Description string `xml:"description,omitempty"`
+
+	Pos *Position `xml:"-"` // Where this element was found, set by ParseXmlGrammar
 }
 
 func (xml *XmlIdName) toBase(elemType string, errs *toerr.Errors) Base {
@@ -34,6 +36,7 @@ func (xml *XmlIdName) toBase(elemType string, errs *toerr.Errors) Base {
 		id:          xml.Id,
 		name:        xml.Name,
 		description: xml.Description,
+		pos:         xml.Pos,
 	}
 }
 
@@ -71,6 +74,9 @@ type XmlGrammar struct {
 	Complete string `xml:"complete,attr,omitempty" ufwb:"bool"`
 	Uti      string `xml:"uti,attr,omitempty"`
 
+	// Extensions, not found in Synalysis grammars
+	Mime string `xml:"mimetype,attr,omitempty"`
+
 	Start      string          `xml:"start,attr,omitempty" ufwb:"id"`
 	Scripts    XmlScripts      `xml:"scripts"`
 	Structures []*XmlStructure `xml:"structure,omitempty"`
@@ -130,6 +136,7 @@ type XmlCustom struct {
 	LengthUnit string `xml:"lengthunit,attr,omitempty" ufwb:"lengthunit"`
 
 	Script string `xml:"script,attr,omitempty" ufwb:"id"`
+	Type   string `xml:"type,attr,omitempty"` // Name of a registered CustomType
 
 	FillColour   string `xml:"fillcolor,attr,omitempty" ufwb:"colour"`
 	StrokeColour string `xml:"strokecolor,attr,omitempty" ufwb:"colour"`
@@ -184,6 +191,12 @@ type XmlBinary struct {
 	Unused    string `xml:"unused,attr,omitempty" ufwb:"bool"`
 	Disabled  string `xml:"disabled,attr,omitempty" ufwb:"bool"`
 
+	// Extensions, not found in Synalysis grammars
+	Checksum   string `xml:"checksum,attr,omitempty" ufwb:"checksum"`
+	ChecksumOf string `xml:"checksumof,attr,omitempty"`
+	Transform  string `xml:"transform,attr,omitempty" ufwb:"transform"`
+	Structure  string `xml:"structure,attr,omitempty" ufwb:"id"`
+
 	FillColour   string `xml:"fillcolor,attr,omitempty" ufwb:"colour"`
 	StrokeColour string `xml:"strokecolor,attr,omitempty" ufwb:"colour"`
 
@@ -214,6 +227,10 @@ type XmlNumber struct {
 
 	Disabled string `xml:"disabled,attr,omitempty" ufwb:"bool"`
 
+	// Extensions, not found in Synalysis grammars
+	Checksum   string `xml:"checksum,attr,omitempty" ufwb:"checksum"`
+	ChecksumOf string `xml:"checksumof,attr,omitempty"`
+
 	Values []*XmlFixedValue `xml:"fixedvalue,omitempty"`
 	Masks  []*XmlMask       `xml:"mask,omitempty"`
 }
@@ -257,6 +274,8 @@ type XmlMask struct {
 	Description string `xml:"description,omitempty"`
 
 	Values []*XmlFixedValue `xml:"fixedvalue,omitempty"`
+
+	Pos *Position `xml:"-"` // Where this element was found, set by ParseXmlGrammar
 }
 
 type XmlScripts []*XmlScript
@@ -296,6 +315,8 @@ type XmlFixedValue struct {
 	Value string `xml:"value,attr,omitempty"`
 
 	Description string `xml:"description,omitempty"`
+
+	Pos *Position `xml:"-"` // Where this element was found, set by ParseXmlGrammar
 }
 
 // Types of the original elements but without the MarshalXML / UnmarshalXML methods on them.
@@ -135,7 +135,7 @@ func TestXmlDecode(t *testing.T) {
                   </number>`,
 			want: &XmlNumber{
 				XMLName:   xml.Name{Local: "number"},
-				XmlIdName: XmlIdName{1, "number", ""},
+				XmlIdName: XmlIdName{Id: 1, Name: "number"},
 				Length:    "1",
 				Type:      "integer",
 				Values: []*XmlFixedValue{
@@ -157,7 +157,7 @@ func TestXmlDecode(t *testing.T) {
 				</string>`,
 			want: &XmlString{
 				XMLName:   xml.Name{Local: "string"},
-				XmlIdName: XmlIdName{1, "string", ""},
+				XmlIdName: XmlIdName{Id: 1, Name: "string"},
 				Values: []*XmlFixedValue{
 					{XMLName: xml.Name{Local: "fixedvalue"}, Name: "up", Value: "0"},
 					{XMLName: xml.Name{Local: "fixedvalue"}, Name: "down", Value: "1"},
@@ -169,14 +169,14 @@ func TestXmlDecode(t *testing.T) {
 			xml: `<structure name="structure" id="4" length="prev.size" />`,
 			want: &XmlStructure{
 				XMLName:   xml.Name{Local: "structure"},
-				XmlIdName: XmlIdName{4, "structure", ""},
+				XmlIdName: XmlIdName{Id: 4, Name: "structure"},
 				Length:    "prev.size",
 			},
 		}, {
 			xml: `<number name="number" id="3" type="integer" length="4"/>`,
 			want: &XmlNumber{
 				XMLName:   xml.Name{Local: "number"},
-				XmlIdName: XmlIdName{3, "number", ""},
+				XmlIdName: XmlIdName{Id: 3, Name: "number"},
 				Type:      "integer",
 				Length:    "4",
 			},
@@ -189,7 +189,7 @@ Line 3
 			      </grammar>`,
 			want: &XmlGrammar{
 				XMLName:   xml.Name{Local: "grammar"},
-				XmlIdName: XmlIdName{0, "multiline", "Line 1\nLine 2\nLine 3\n"},
+				XmlIdName: XmlIdName{Name: "multiline", Description: "Line 1\nLine 2\nLine 3\n"},
 			},
 		}, {
 			xml: `<grammar name="script">
@@ -203,10 +203,10 @@ Line 3
 
 			want: &XmlGrammar{
 				XMLName:   xml.Name{Local: "grammar"},
-				XmlIdName: XmlIdName{0, "script", ""},
+				XmlIdName: XmlIdName{Name: "script"},
 				Scripts: []*XmlScript{{
 					XMLName:   xml.Name{Local: "script"},
-					XmlIdName: XmlIdName{0, "", "A description"},
+					XmlIdName: XmlIdName{Description: "A description"},
 					Source: &XmlSource{
 						XMLName:  xml.Name{Local: "source"},
 						Language: "Python",
@@ -222,10 +222,10 @@ Line 3
 				</scriptelement>`,
 			want: &XmlScriptElement{
 				XMLName:   xml.Name{Local: "scriptelement"},
-				XmlIdName: XmlIdName{0, "scriptelement", ""},
+				XmlIdName: XmlIdName{Name: "scriptelement"},
 				Script: &XmlScript{
 					XMLName:   xml.Name{Local: "script"},
-					XmlIdName: XmlIdName{1, "script", ""},
+					XmlIdName: XmlIdName{Id: 1, Name: "script"},
 					Type:      "Generic",
 					Source: &XmlSource{
 						XMLName:  xml.Name{Local: "source"},
@@ -14,6 +14,9 @@ var (
 	colourRegex = regexp.MustCompile("^[0-9A-F]{6}$")
 )
 
+// The helpers below parse one attribute of element e, reporting errors against e and attr. The
+// transforms allocate each element before filling it in, so it can be passed to them.
+
 // yesno returns the boolean value of this "yes", "no" field.
 func yesno(s string, errs *toerr.Errors) Bool {
 	// TODO Be strict on "yes", "no", "" only
@@ -24,7 +27,7 @@ func yesno(s string, errs *toerr.Errors) Bool {
 }
 
 // byteOrder returns the binary.byteOrder for this string.
-func endian(s string, errs *toerr.Errors) Endian {
+func endian(e ElementId, attr, s string, errs *toerr.Errors) Endian {
 	switch s {
 	case "big":
 		return BigEndian
@@ -36,11 +39,11 @@ func endian(s string, errs *toerr.Errors) Endian {
 		return UnknownEndian
 	}
 
-	errs.Append(fmt.Errorf("unknown endian: %q", s))
+	errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("unknown endian: %q", s)})
 	return UnknownEndian
 }
 
-func display(s string, errs *toerr.Errors) Display {
+func display(e ElementId, attr, s string, errs *toerr.Errors) Display {
 	switch s {
 	case "decimal":
 		return DecDisplay
@@ -52,11 +55,11 @@ func display(s string, errs *toerr.Errors) Display {
 		return UnknownDisplay
 	}
 
-	errs.Append(fmt.Errorf("unknown display: %q", s))
+	errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("unknown display: %q", s)})
 	return UnknownDisplay
 }
 
-func lengthunit(s string, errs *toerr.Errors) LengthUnit {
+func lengthunit(e ElementId, attr, s string, errs *toerr.Errors) LengthUnit {
 	switch s {
 	case "bit":
 		return BitLengthUnit
@@ -66,23 +69,43 @@ func lengthunit(s string, errs *toerr.Errors) LengthUnit {
 		return UnknownLengthUnit
 	}
 
-	errs.Append(fmt.Errorf("unknown length unit: %q", s))
+	errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("unknown length unit: %q", s)})
 	return UnknownLengthUnit
 }
 
-func colour(s string, errs *toerr.Errors) *Colour {
+func checksumAlgorithm(e ElementId, attr, s string, errs *toerr.Errors) string {
+	if s == "" {
+		return ""
+	}
+	if _, found := checksums[s]; !found {
+		errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("unknown checksum: %q", s)})
+	}
+	return s
+}
+
+func transformName(e ElementId, attr, s string, errs *toerr.Errors) string {
+	if s == "" {
+		return ""
+	}
+	if _, _, err := parseTransform(s); err != nil {
+		errs.Append(&validationError{e: e, attr: attr, err: err})
+	}
+	return s
+}
+
+func colour(e ElementId, attr, s string, errs *toerr.Errors) *Colour {
 	if s == "" {
 		return nil
 	}
 
 	if !colourRegex.MatchString(s) {
-		errs.Append(fmt.Errorf("invalid colour: %q", s))
+		errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("invalid colour: %q", s)})
 		return nil
 	}
 
 	b, err := hex.DecodeString(s)
 	if err != nil {
-		errs.Append(err)
+		errs.Append(&validationError{e: e, attr: attr, err: err})
 		return nil
 	}
 
@@ -91,7 +114,7 @@ func colour(s string, errs *toerr.Errors) *Colour {
 	return &c
 }
 
-func order(s string, errs *toerr.Errors) Order {
+func order(e ElementId, attr, s string, errs *toerr.Errors) Order {
 	switch s {
 	case "fixed":
 		return FixedOrder
@@ -101,7 +124,7 @@ func order(s string, errs *toerr.Errors) Order {
 		return UnknownOrder
 	}
 
-	errs.Append(fmt.Errorf("unknown order: %q", s))
+	errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("unknown order: %q", s)})
 	return UnknownOrder
 }
 
@@ -128,6 +151,7 @@ func (xml *XmlGrammar) transform(errs *toerr.Errors) Element {
 		Email:    xml.Email,
 		Complete: yesno(xml.Complete, errs),
 		Uti:      xml.Uti,
+		Mime:     xml.Mime,
 	}
 
 	if g.Xml.Start == "" {
@@ -158,28 +182,29 @@ func (xml *XmlGrammarRef) transform(errs *toerr.Errors) Element {
 }
 
 func (xml *XmlStructure) transform(errs *toerr.Errors) Element {
-	s := &Structure{
+	s := new(Structure)
+	*s = Structure{
 		Xml:  xml,
 		Base: xml.toBase("Structure", errs),
 
 		length:       NewExpression(xml.Length),
 		lengthOffset: NewExpression(xml.LengthOffset),
-		lengthUnit:   lengthunit(xml.LengthUnit, errs),
+		lengthUnit:   lengthunit(s, "lengthunit", xml.LengthUnit, errs),
 
 		Repeats: xml.toRepeats(errs),
 
-		endian: endian(xml.Endian, errs),
+		endian: endian(s, "endian", xml.Endian, errs),
 		signed: yesno(xml.Signed, errs),
 
 		encoding: xml.Encoding, // TODO Validate
 
-		order: order(xml.Order, errs),
+		order: order(s, "order", xml.Order, errs),
 
-		display: display(xml.Display, errs),
+		display: display(s, "display", xml.Display, errs),
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(s, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(s, "strokecolor", xml.StrokeColour, errs),
 		},
 	}
 
@@ -191,22 +216,25 @@ func (xml *XmlStructure) transform(errs *toerr.Errors) Element {
 }
 
 func (xml *XmlCustom) transform(errs *toerr.Errors) Element {
-	return &Custom{
+	c := new(Custom)
+	*c = Custom{
 		Xml:  xml,
 		Base: xml.toBase("Custom", errs),
 
 		length:     NewExpression(xml.Length),
-		lengthUnit: lengthunit(xml.LengthUnit, errs),
+		lengthUnit: lengthunit(c, "lengthunit", xml.LengthUnit, errs),
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(c, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(c, "strokecolor", xml.StrokeColour, errs),
 		},
 	}
+	return c
 }
 
 func (xml *XmlStructRef) transform(errs *toerr.Errors) Element {
-	return &StructRef{
+	s := new(StructRef)
+	*s = StructRef{
 		Xml:  xml,
 		Base: xml.toBase("StructRef", errs),
 
@@ -215,45 +243,47 @@ func (xml *XmlStructRef) transform(errs *toerr.Errors) Element {
 		disabled: yesno(xml.Disabled, errs),
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(s, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(s, "strokecolor", xml.StrokeColour, errs),
 		},
 	}
+	return s
 }
 
 // Parses a delimiter and returns the byte it represents. Currently the delimiter is required to
 // be exact two hex characters, representing a single byte.
-func delimiterToByte(delimiter string, errs *toerr.Errors) byte {
+func delimiterToByte(e ElementId, attr, delimiter string, errs *toerr.Errors) byte {
 	if delimiter == "" {
 		return 0
 	}
 
 	b, err := strconv.ParseUint(delimiter, 16, 8)
 	if err != nil {
-		errs.Append(fmt.Errorf("invalid delimiter %q: %s", delimiter, err))
+		errs.Append(&validationError{e: e, attr: attr, err: fmt.Errorf("invalid delimiter %q: %s", delimiter, err)})
 	}
 	return byte(b)
 }
 
 func (xml *XmlString) transform(errs *toerr.Errors) Element {
-	s := &String{
+	s := new(String)
+	*s = String{
 		Xml:  xml,
 		Base: xml.toBase("String", errs),
 
 		typ:        xml.Type, // TODO Convert to "StringType" // "zero-terminated", "fixed-length", "pascal", "delimiter-terminated"
 		length:     NewExpression(xml.Length),
-		lengthUnit: lengthunit(xml.LengthUnit, errs),
+		lengthUnit: lengthunit(s, "lengthunit", xml.LengthUnit, errs),
 
 		encoding:  xml.Encoding,
 		mustMatch: yesno(xml.MustMatch, errs),
 
-		delimiter: delimiterToByte(xml.Delimiter, errs),
+		delimiter: delimiterToByte(s, "delimiter", xml.Delimiter, errs),
 
 		Repeats: xml.toRepeats(errs),
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(s, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(s, "strokecolor", xml.StrokeColour, errs),
 		},
 	}
 
@@ -274,21 +304,27 @@ func (xml *XmlString) transform(errs *toerr.Errors) Element {
 }
 
 func (xml *XmlBinary) transform(errs *toerr.Errors) Element {
-	b := &Binary{
+	b := new(Binary)
+	*b = Binary{
 		Xml:  xml,
 		Base: xml.toBase("Binary", errs),
 
 		length:     NewExpression(xml.Length),
-		lengthUnit: lengthunit(xml.LengthUnit, errs),
+		lengthUnit: lengthunit(b, "lengthunit", xml.LengthUnit, errs),
 
 		Repeats: xml.toRepeats(errs),
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(b, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(b, "strokecolor", xml.StrokeColour, errs),
 		},
 
 		mustMatch: yesno(xml.MustMatch, errs),
+
+		checksum:   checksumAlgorithm(b, "checksum", xml.Checksum, errs),
+		checksumOf: xml.ChecksumOf,
+
+		transform: transformName(b, "transform", xml.Transform, errs),
 	}
 
 	for _, x := range xml.Values {
@@ -296,7 +332,7 @@ func (xml *XmlBinary) transform(errs *toerr.Errors) Element {
 		bs := strings.TrimPrefix(strings.TrimPrefix(x.Value, "0x"), "0X")
 		value, err := hex.DecodeString(bs)
 		if err != nil {
-			errs.Append(err)
+			errs.Append(&validationError{e: b, attr: "value", pos: x.Pos, err: err})
 		}
 
 		b.values = append(b.values, &FixedBinaryValue{
@@ -311,28 +347,37 @@ func (xml *XmlBinary) transform(errs *toerr.Errors) Element {
 }
 
 func (xml *XmlNumber) transform(errs *toerr.Errors) Element {
-	n := &Number{
+	n := new(Number)
+	*n = Number{
 		Xml:  xml,
 		Base: xml.toBase("Number", errs),
 
 		Type: xml.Type, // TODO Convert to NumberType
 
 		length:     NewExpression(xml.Length),
-		lengthUnit: lengthunit(xml.LengthUnit, errs),
+		lengthUnit: lengthunit(n, "lengthunit", xml.LengthUnit, errs),
 
 		Repeats: xml.toRepeats(errs),
 
-		endian: endian(xml.Endian, errs),
+		endian: endian(n, "endian", xml.Endian, errs),
 		signed: yesno(xml.Signed, errs),
 
-		display: display(xml.Display, errs),
+		display: display(n, "display", xml.Display, errs),
+
+		valueExpression: xml.ValueExpression,
+
+		minVal: xml.MinVal,
+		maxVal: xml.MaxVal,
 
 		Colourful: Colourful{
-			fillColour:   colour(xml.FillColour, errs),
-			strokeColour: colour(xml.StrokeColour, errs),
+			fillColour:   colour(n, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(n, "strokecolor", xml.StrokeColour, errs),
 		},
 
 		mustMatch: yesno(xml.MustMatch, errs),
+
+		checksum:   checksumAlgorithm(n, "checksum", xml.Checksum, errs),
+		checksumOf: xml.ChecksumOf,
 	}
 
 	for _, x := range xml.Values {
@@ -344,29 +389,36 @@ func (xml *XmlNumber) transform(errs *toerr.Errors) Element {
 	}
 
 	for _, v := range xml.Masks {
-		n.masks = append(n.masks, v.transform(errs))
+		n.masks = append(n.masks, v.transform(n, errs))
 	}
 
 	return n
 }
 
 func (xml *XmlOffset) transform(errs *toerr.Errors) Element {
-	return &Offset{
+	o := new(Offset)
+	*o = Offset{
 		Xml:  xml,
 		Base: xml.toBase("Offset", errs),
 
 		length:     NewExpression(xml.Length),
-		lengthUnit: lengthunit(xml.LengthUnit, errs),
+		lengthUnit: lengthunit(o, "lengthunit", xml.LengthUnit, errs),
 
 		Repeats: xml.toRepeats(errs),
 
-		endian: endian(xml.Endian, errs),
+		endian: endian(o, "endian", xml.Endian, errs),
 
-		display: display(xml.Display, errs),
+		display: display(o, "display", xml.Display, errs),
+
+		Colourful: Colourful{
+			fillColour:   colour(o, "fillcolor", xml.FillColour, errs),
+			strokeColour: colour(o, "strokecolor", xml.StrokeColour, errs),
+		},
 
 		followNullReference: yesno(xml.FollowNullReference, errs),
 		additional:          xml.Additional, // TODO Validate
 	}
+	return o
 }
 
 // Both XmlScriptElement and XmlScript return a Script struct
@@ -407,13 +459,21 @@ func (xml *XmlScript) transformInto(s *Script, errs *toerr.Errors) {
 	}
 }
 
-func (xml *XmlMask) transform(errs *toerr.Errors) *Mask {
+func (xml *XmlMask) transform(n *Number, errs *toerr.Errors) *Mask {
 	m := &Mask{
 		Xml:         xml,
 		name:        xml.Name,
 		description: strings.TrimSpace(xml.Description),
 	}
 
+	if xml.Value != "" {
+		value, err := strconv.ParseUint(xml.Value, 0, 64)
+		if err != nil {
+			errs.Append(&validationError{e: n, attr: "value", pos: xml.Pos, err: fmt.Errorf("invalid mask %q: %s", xml.Value, err)})
+		}
+		m.value = value
+	}
+
 	for _, x := range xml.Values {
 		// TODO Do I need to change this to some other type?
 		m.values = append(m.values, &FixedValue{
@@ -0,0 +1,476 @@
+package ufwb
+
+// This file recreates the Xml structs from the native Elements, the reverse of xml_transform.go.
+// Only the fields set on each Element are written, so values inherited from a parent or a
+// derived Element are not repeated. Attributes that have no native field yet, such as
+// alignment, are copied from the original Xml if there is one.
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+func yesnoString(b Bool) string {
+	switch b {
+	case True:
+		return "yes"
+	case False:
+		return "no"
+	}
+	return ""
+}
+
+func endianString(e Endian) string {
+	switch e {
+	case BigEndian:
+		return "big"
+	case LittleEndian:
+		return "little"
+	case DynamicEndian:
+		return "dynamic"
+	}
+	return ""
+}
+
+func displayString(d Display) string {
+	switch d {
+	case DecDisplay:
+		return "decimal"
+	case HexDisplay:
+		return "hex"
+	case BinaryDisplay:
+		return "binary"
+	}
+	return ""
+}
+
+func lengthUnitString(l LengthUnit) string {
+	switch l {
+	case BitLengthUnit:
+		return "bit"
+	case ByteLengthUnit:
+		return "byte"
+	}
+	return ""
+}
+
+func orderString(o Order) string {
+	switch o {
+	case FixedOrder:
+		return "fixed"
+	case VariableOrder:
+		return "variable"
+	}
+	return ""
+}
+
+func colourString(c *Colour) string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("%06X", uint32(*c))
+}
+
+// expressionString returns the expression as written in a grammar.
+func expressionString(e Expression) string {
+	switch e := e.(type) {
+	case ConstExpression:
+		return strconv.FormatInt(int64(e), 10)
+	case StringExpression:
+		return string(e)
+	}
+	return ""
+}
+
+// refString returns a reference to the element, by id if it has one, otherwise by name.
+func refString(e ElementId) string {
+	if e == nil {
+		return ""
+	}
+	if id := e.Id(); id != 0 {
+		return "id:" + strconv.Itoa(id)
+	}
+	return e.Name()
+}
+
+func (b *Base) toXml() XmlIdName {
+	return XmlIdName{
+		Id:          b.id,
+		Name:        b.name,
+		Description: b.description,
+	}
+}
+
+func (r *Repeats) toXml() XmlRepeats {
+	return XmlRepeats{
+		RepeatMin: expressionString(r.repeatMin),
+		RepeatMax: expressionString(r.repeatMax),
+	}
+}
+
+// toXml returns a XmlUfwb representing the current state of u.
+func (u *Ufwb) toXml() *XmlUfwb {
+	x := &XmlUfwb{
+		Version: u.Version,
+	}
+	if u.Grammar != nil {
+		x.Grammar = u.Grammar.toXml()
+	}
+	return x
+}
+
+func (g *Grammar) toXml() *XmlGrammar {
+	x := &XmlGrammar{
+		XmlIdName: g.Base.toXml(),
+
+		Author:   g.Author,
+		Ext:      g.Ext,
+		Email:    g.Email,
+		Complete: yesnoString(g.Complete),
+		Uti:      g.Uti,
+		Mime:     g.Mime,
+	}
+
+	if g.Start != nil {
+		x.Start = refString(g.Start)
+	} else if g.Xml != nil {
+		x.Start = g.Xml.Start
+	}
+
+	for _, s := range g.Scripts {
+		x.Scripts = append(x.Scripts, s.toXmlScript(&s.Base))
+	}
+
+	for _, e := range g.Elements {
+		if s, ok := e.(*Structure); ok {
+			x.Structures = append(x.Structures, s.toXml())
+		}
+	}
+
+	return x
+}
+
+// elementToXml returns the Xml struct for this element, or nil if the element can't be
+// written to a grammar.
+func elementToXml(e Element) XmlElement {
+	switch e := e.(type) {
+	case *Structure:
+		return e.toXml()
+	case *GrammarRef:
+		return e.toXml()
+	case *Custom:
+		return e.toXml()
+	case *StructRef:
+		return e.toXml()
+	case *String:
+		return e.toXml()
+	case *Binary:
+		return e.toXml()
+	case *Number:
+		return e.toXml()
+	case *Offset:
+		return e.toXml()
+	case *Script:
+		return e.toXml()
+	}
+	return nil
+}
+
+func (s *Structure) toXml() *XmlStructure {
+	x := &XmlStructure{
+		XmlIdName:  s.Base.toXml(),
+		XmlRepeats: s.Repeats.toXml(),
+
+		Length:       expressionString(s.length),
+		LengthUnit:   lengthUnitString(s.lengthUnit),
+		LengthOffset: expressionString(s.lengthOffset),
+
+		Endian:   endianString(s.endian),
+		Signed:   yesnoString(s.signed),
+		Encoding: s.encoding,
+		Order:    orderString(s.order),
+		Display:  displayString(s.display),
+
+		FillColour:   colourString(s.fillColour),
+		StrokeColour: colourString(s.strokeColour),
+	}
+
+	if s.derives != nil {
+		x.Extends = refString(s.derives)
+	}
+
+	if s.Xml != nil {
+		x.Alignment = s.Xml.Alignment
+		x.Floating = s.Xml.Floating
+		x.ConsistsOf = s.Xml.ConsistsOf
+		x.Repeat = s.Xml.Repeat
+		x.ValueExpression = s.Xml.ValueExpression
+		x.Debug = s.Xml.Debug
+		x.Disabled = s.Xml.Disabled
+	}
+
+	for _, e := range s.elements {
+		if child := elementToXml(e); child != nil {
+			x.Elements = append(x.Elements, child)
+		}
+	}
+
+	return x
+}
+
+func (g *GrammarRef) toXml() *XmlGrammarRef {
+	return &XmlGrammarRef{
+		XmlIdName: g.Base.toXml(),
+
+		Uti:      g.uti,
+		Filename: g.filename,
+		Disabled: yesnoString(g.disabled),
+	}
+}
+
+func (c *Custom) toXml() *XmlCustom {
+	x := &XmlCustom{
+		XmlIdName: c.Base.toXml(),
+
+		Length:     expressionString(c.length),
+		LengthUnit: lengthUnitString(c.lengthUnit),
+
+		FillColour:   colourString(c.fillColour),
+		StrokeColour: colourString(c.strokeColour),
+	}
+
+	if c.script != nil {
+		x.Script = refString(c.script)
+	}
+	if c.typ != nil {
+		if name, found := customName(c.typ); found {
+			x.Type = name
+		}
+	}
+	if x.Script == "" && x.Type == "" && c.Xml != nil {
+		// Not resolved yet
+		x.Script, x.Type = c.Xml.Script, c.Xml.Type
+	}
+
+	return x
+}
+
+func (s *StructRef) toXml() *XmlStructRef {
+	x := &XmlStructRef{
+		XmlIdName:  s.Base.toXml(),
+		XmlRepeats: s.Repeats.toXml(),
+
+		Disabled: yesnoString(s.disabled),
+
+		FillColour:   colourString(s.fillColour),
+		StrokeColour: colourString(s.strokeColour),
+	}
+
+	if s.structure != nil {
+		x.Structure = refString(s.structure)
+	} else if s.Xml != nil {
+		x.Structure = s.Xml.Structure
+	}
+
+	return x
+}
+
+func (s *String) toXml() *XmlString {
+	x := &XmlString{
+		XmlIdName:  s.Base.toXml(),
+		XmlRepeats: s.Repeats.toXml(),
+
+		Type:       s.typ,
+		Length:     expressionString(s.length),
+		LengthUnit: lengthUnitString(s.lengthUnit),
+
+		Encoding:  s.encoding,
+		MustMatch: yesnoString(s.mustMatch),
+
+		FillColour:   colourString(s.fillColour),
+		StrokeColour: colourString(s.strokeColour),
+	}
+
+	if s.typ == "delimiter-terminated" {
+		x.Delimiter = fmt.Sprintf("%02X", s.delimiter)
+	}
+
+	for _, v := range s.values {
+		x.Values = append(x.Values, &XmlFixedValue{
+			Name:        v.name,
+			Value:       v.value,
+			Description: v.description,
+		})
+	}
+
+	return x
+}
+
+func (b *Binary) toXml() *XmlBinary {
+	x := &XmlBinary{
+		XmlIdName:  b.Base.toXml(),
+		XmlRepeats: b.Repeats.toXml(),
+
+		Length:     expressionString(b.length),
+		LengthUnit: lengthUnitString(b.lengthUnit),
+
+		MustMatch: yesnoString(b.mustMatch),
+
+		Checksum:   b.checksum,
+		ChecksumOf: b.checksumOf,
+		Transform:  b.transform,
+
+		FillColour:   colourString(b.fillColour),
+		StrokeColour: colourString(b.strokeColour),
+	}
+
+	if b.structure != nil {
+		x.Structure = refString(b.structure)
+	}
+
+	if b.Xml != nil {
+		x.Unused = b.Xml.Unused
+		x.Disabled = b.Xml.Disabled
+	}
+
+	for _, v := range b.values {
+		x.Values = append(x.Values, &XmlFixedValue{
+			Name:        v.name,
+			Value:       strings.ToUpper(hex.EncodeToString(v.value)),
+			Description: v.description,
+		})
+	}
+
+	return x
+}
+
+// fixedValueString returns the value of a FixedValue as written in a grammar.
+func fixedValueString(v *FixedValue) string {
+	if v.value == nil {
+		// Not parsed yet
+		if v.Xml != nil {
+			return v.Xml.Value
+		}
+		return ""
+	}
+	return fmt.Sprint(v.value)
+}
+
+func fixedValuesToXml(values []*FixedValue) []*XmlFixedValue {
+	var x []*XmlFixedValue
+	for _, v := range values {
+		x = append(x, &XmlFixedValue{
+			Name:        v.name,
+			Value:       fixedValueString(v),
+			Description: v.description,
+		})
+	}
+	return x
+}
+
+func (n *Number) toXml() *XmlNumber {
+	x := &XmlNumber{
+		XmlIdName:  n.Base.toXml(),
+		XmlRepeats: n.Repeats.toXml(),
+
+		Type:       n.Type,
+		Length:     expressionString(n.length),
+		LengthUnit: lengthUnitString(n.lengthUnit),
+
+		Endian:          endianString(n.endian),
+		Signed:          yesnoString(n.signed),
+		MustMatch:       yesnoString(n.mustMatch),
+		ValueExpression: n.valueExpression,
+
+		MinVal: n.minVal,
+		MaxVal: n.maxVal,
+
+		Display:      displayString(n.display),
+		FillColour:   colourString(n.fillColour),
+		StrokeColour: colourString(n.strokeColour),
+
+		Checksum:   n.checksum,
+		ChecksumOf: n.checksumOf,
+
+		Values: fixedValuesToXml(n.values),
+	}
+
+	if n.Xml != nil {
+		x.Disabled = n.Xml.Disabled
+	}
+
+	for _, m := range n.masks {
+		x.Masks = append(x.Masks, m.toXml())
+	}
+
+	return x
+}
+
+func (m *Mask) toXml() *XmlMask {
+	return &XmlMask{
+		Name:        m.name,
+		Value:       fmt.Sprintf("0x%X", m.value),
+		Description: m.description,
+		Values:      fixedValuesToXml(m.values),
+	}
+}
+
+func (o *Offset) toXml() *XmlOffset {
+	return &XmlOffset{
+		XmlIdName:  o.Base.toXml(),
+		XmlRepeats: o.Repeats.toXml(),
+
+		Length:     expressionString(o.length),
+		LengthUnit: lengthUnitString(o.lengthUnit),
+		Endian:     endianString(o.endian),
+
+		RelativeTo:          refString(o.relativeTo),
+		FollowNullReference: yesnoString(o.followNullReference),
+		References:          refString(o.references),
+		ReferencedSize:      refString(o.referencedSize),
+		Additional:          o.additional,
+
+		Display:      displayString(o.display),
+		FillColour:   colourString(o.fillColour),
+		StrokeColour: colourString(o.strokeColour),
+	}
+}
+
+func (s *Script) toXml() *XmlScriptElement {
+	var base *Base
+	if s.XmlScript != nil {
+		// The inner <script> has its own id and name
+		base = &Base{
+			id:          s.XmlScript.Id,
+			name:        s.XmlScript.Name,
+			description: s.XmlScript.Description,
+		}
+	}
+
+	x := &XmlScriptElement{
+		XmlIdName:  s.Base.toXml(),
+		XmlRepeats: s.Repeats.toXml(),
+		Script:     s.toXmlScript(base),
+	}
+	if s.Xml != nil {
+		x.Disabled = s.Xml.Disabled
+	}
+	return x
+}
+
+// toXmlScript returns the <script> element, with the id and name from base.
+func (s *Script) toXmlScript(base *Base) *XmlScript {
+	x := &XmlScript{
+		Type: s.typ,
+		Source: &XmlSource{
+			Language: s.language,
+			Text:     s.text,
+		},
+	}
+	if base != nil {
+		x.XmlIdName = base.toXml()
+	}
+	return x
+}
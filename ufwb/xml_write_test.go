@@ -0,0 +1,94 @@
+package ufwb
+
+import (
+	"bytes"
+	"encoding/xml"
+	"strings"
+	"testing"
+)
+
+// writeTestGrammar is written in the same form WriteXmlGrammar produces, so it should
+// round trip exactly.
+const writeTestGrammar = `<ufwb version="1.0">
+	<grammar name="Test" author="bramp@" fileextension="test" uti="net.bramp.test" mimetype="application/x-test" start="id:99">
+		<description>A test grammar</description>
+		<scripts>
+			<script id="50" name="Varint" type="DataType">
+				<source language="Lua">-- Some code</source>
+			</script>
+		</scripts>
+		<structure id="1" name="Base" endian="big" signed="no" fillcolor="FF0000">
+			<number id="2" name="Type" type="integer" length="1" display="hex">
+				<fixedvalue name="one" value="1">
+					<description>The first</description>
+				</fixedvalue>
+				<mask name="Flags" value="0xF0">
+					<fixedvalue name="high" value="16"></fixedvalue>
+				</mask>
+			</number>
+			<binary id="3" name="Magic" length="2">
+				<fixedvalue name="magic" value="CAFE"></fixedvalue>
+			</binary>
+		</structure>
+		<structure id="99" name="File" extends="id:1" length="prev.Size" lengthunit="bit" order="variable" alignment="4">
+			<number id="4" name="Type" type="integer" length="2" valueexpression="Type+1" minval="0" maxval="10"></number>
+			<string id="5" name="Text" repeatmax="unlimited" type="delimiter-terminated" delimiter="0A" encoding="UTF-8"></string>
+			<structref id="6" name="Ref" repeatmin="0" structure="id:1"></structref>
+			<binary id="7" name="Packed" length="remaining" checksum="crc32" checksumof="Ref" transform="zlib" structure="id:1"></binary>
+			<custom id="8" name="Size" script="id:50"></custom>
+			<scriptelement id="9" name="Run">
+				<script id="51" name="Inner" type="Generic">
+					<source language="Python"># More code</source>
+				</script>
+			</scriptelement>
+		</structure>
+	</grammar>
+</ufwb>`
+
+func TestWriteXmlGrammar(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(writeTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	// Drop the original Xml, to ensure it is recreated from the Elements
+	u.Xml = nil
+
+	var out bytes.Buffer
+	if err := WriteXmlGrammar(&out, u); err != nil {
+		t.Fatalf("WriteXmlGrammar(...) error = %q want nil error", err)
+	}
+
+	want := xml.Header + writeTestGrammar
+	if err := compareXML(bytes.NewReader(out.Bytes()), strings.NewReader(want)); err != nil {
+		t.Errorf("WriteXmlGrammar(...) = %s\n%s", err, out.String())
+	}
+
+	// Parse the output again
+	if _, errs := ParseXmlGrammar(&out); len(errs) > 0 {
+		t.Errorf("ParseXmlGrammar(WriteXmlGrammar(...)) = %q want nil error", errs)
+	}
+}
+
+func TestWriteXmlGrammarChanges(t *testing.T) {
+	u, errs := ParseXmlGrammar(strings.NewReader(writeTestGrammar))
+	if len(errs) > 0 {
+		t.Fatalf("ParseXmlGrammar(...) = %q want nil error", errs)
+	}
+
+	e, _ := u.Get("id:4")
+	n := e.(*Number)
+	n.SetName("Kind")
+	n.SetLength(ConstExpression(4))
+	n.SetEndian(LittleEndian)
+
+	var out bytes.Buffer
+	if err := WriteXmlGrammar(&out, u); err != nil {
+		t.Fatalf("WriteXmlGrammar(...) error = %q want nil error", err)
+	}
+
+	want := `<number id="4" name="Kind" type="integer" length="4" endian="little" valueexpression="Type+1" minval="0" maxval="10"></number>`
+	if got := out.String(); !strings.Contains(got, want) {
+		t.Errorf("WriteXmlGrammar(...) = %s\nwant it to contain %s", got, want)
+	}
+}